@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type AllocationComponent string
+
+const (
+	AllocationPenalties AllocationComponent = "penalties" // penalty interest
+	AllocationFees      AllocationComponent = "fees"      // fixed and percentage late fees
+	AllocationInterest  AllocationComponent = "interest"
+	AllocationPrincipal AllocationComponent = "principal"
+)
+
+// DefaultAllocationOrder settles what paying an installment late cost before
+// the installment itself, interest before principal.
+var DefaultAllocationOrder = []AllocationComponent{AllocationPenalties, AllocationFees, AllocationInterest, AllocationPrincipal}
+
+func validateAllocationOrder(order []AllocationComponent) (err error) {
+	seen := map[AllocationComponent]bool{}
+	for _, component := range order {
+		switch component {
+		case AllocationPenalties, AllocationFees, AllocationInterest, AllocationPrincipal:
+		default:
+			return fmt.Errorf("unknown allocation component %s", component)
+		}
+		if seen[component] {
+			return fmt.Errorf("duplicate allocation component %s", component)
+		}
+		seen[component] = true
+	}
+	if len(seen) != len(DefaultAllocationOrder) {
+		return fmt.Errorf("allocation order must list every component")
+	}
+	return
+}
+
+// Allocation splits an amount over the components a billable owes.
+type Allocation struct {
+	Principal int
+	Interest  int
+	Fees      int // fixed and percentage late fees
+	Penalties int // penalty interest
+}
+
+func (a Allocation) Total() int {
+	return a.Principal + a.Interest + a.Fees + a.Penalties
+}
+
+func (a Allocation) Add(other Allocation) Allocation {
+	return Allocation{
+		Principal: a.Principal + other.Principal,
+		Interest:  a.Interest + other.Interest,
+		Fees:      a.Fees + other.Fees,
+		Penalties: a.Penalties + other.Penalties,
+	}
+}
+
+func (a *Allocation) of(component AllocationComponent) *int {
+	switch component {
+	case AllocationPrincipal:
+		return &a.Principal
+	case AllocationInterest:
+		return &a.Interest
+	case AllocationFees:
+		return &a.Fees
+	default:
+		return &a.Penalties
+	}
+}
+
+// allocate spreads amount over what is owed on each installment, oldest
+// installment first and the components of an installment in the given order.
+// It returns the allocation and whatever could not be placed.
+func allocate(owed []Allocation, order []AllocationComponent, amount int) (out Allocation, unallocated int) {
+	left := amount
+	for _, inst := range owed {
+		for _, component := range order {
+			portion := *inst.of(component)
+			if left < portion {
+				portion = left
+			}
+			*out.of(component) += portion
+			left -= portion
+		}
+	}
+	unallocated = left
+	return
+}
+
+// owedOf returns what is left to pay on each installment of the schedule, its
+// late fees included. Each settled component pays installments oldest first,
+// the way payments are allocated.
+func owedOf(installments []Installment, fees []Fee, settled Allocation) (out []Allocation) {
+	out = make([]Allocation, len(installments))
+	for i, inst := range installments {
+		out[i] = Allocation{Principal: inst.AmountDue - inst.InterestDue, Interest: inst.InterestDue}
+	}
+	for _, fee := range fees {
+		i := fee.InstallmentSeq - 1
+		if i < 0 || i >= len(out) {
+			continue
+		}
+		if fee.Kind == LateFeePenaltyInterest {
+			out[i].Penalties += fee.Amount.Amount
+		} else {
+			out[i].Fees += fee.Amount.Amount
+		}
+	}
+
+	for _, component := range DefaultAllocationOrder {
+		left := *settled.of(component)
+		for i := range out {
+			owed := out[i].of(component)
+			portion := *owed
+			if left < portion {
+				portion = left
+			}
+			*owed -= portion
+			left -= portion
+		}
+	}
+	return
+}
+
+func totalOwed(owed []Allocation) (out Allocation) {
+	for _, inst := range owed {
+		out = out.Add(inst)
+	}
+	return
+}
+
+// settledAsOf totals how payment entries made up to asOf, or all of them when
+// zero, were allocated. Interest waived on early payoff counts as settled
+// interest.
+func settledAsOf(payments []Payment, asOf time.Time) (out Allocation) {
+	for _, p := range payments {
+		if !asOf.IsZero() && p.PaidAt.After(asOf) {
+			continue
+		}
+		out = out.Add(allocationOf(p))
+		out.Interest += p.AmountRebated.Amount
+	}
+	return
+}
+
+// allocationOf returns how the payment entry was allocated.
+func allocationOf(p Payment) Allocation {
+	return Allocation{
+		Principal: p.AmountPrincipal.Amount,
+		Interest:  p.AmountInterest.Amount,
+		Fees:      p.AmountFees.Amount,
+		Penalties: p.AmountPenalties.Amount,
+	}
+}
+
+// withAllocation returns the payment entry recording the allocation.
+func withAllocation(p Payment, allocation Allocation) Payment {
+	currency := p.Amount.Currency
+	p.AmountPrincipal = NewMoney(allocation.Principal, currency)
+	p.AmountInterest = NewMoney(allocation.Interest, currency)
+	p.AmountFees = NewMoney(allocation.Fees, currency)
+	p.AmountPenalties = NewMoney(allocation.Penalties, currency)
+	return p
+}
+
+// owedOn returns the schedule of the billable and what is left to pay on each
+// installment, counting payments made and fees charged up to asOf, or all of
+// them when zero.
+func (b *BillerEngine) owedOn(repo BillerRepository, bID string, asOf time.Time) (installments []Installment, owed []Allocation, err error) {
+	installments, err = repo.ListInstallments(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching installments: %w", err)
+		return
+	}
+	payments, err := repo.ListPayments(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching payments: %w", err)
+		return
+	}
+	fees, err := repo.ListFees(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching fees: %w", err)
+		return
+	}
+
+	var charged []Fee
+	for _, fee := range fees {
+		if asOf.IsZero() || !fee.AccruedTo.After(asOf) {
+			charged = append(charged, fee)
+		}
+	}
+	owed = owedOf(installments, charged, settledAsOf(payments, asOf))
+	return
+}
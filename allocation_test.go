@@ -0,0 +1,158 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocate(t *testing.T) {
+	owed := []Allocation{
+		{Principal: 100, Interest: 10, Fees: 5, Penalties: 2},
+		{Principal: 100, Interest: 10},
+	}
+
+	tests := []struct {
+		name            string
+		order           []AllocationComponent
+		amount          int
+		wantAllocation  Allocation
+		wantUnallocated int
+	}{
+		{"default_order", DefaultAllocationOrder, 150, Allocation{Principal: 123, Interest: 20, Fees: 5, Penalties: 2}, 0},
+		{"partial_installment", DefaultAllocationOrder, 12, Allocation{Interest: 5, Fees: 5, Penalties: 2}, 0},
+		{"principal_first", []AllocationComponent{AllocationPrincipal, AllocationInterest, AllocationFees, AllocationPenalties}, 105, Allocation{Principal: 100, Interest: 5}, 0},
+		{"overpaid", DefaultAllocationOrder, 300, Allocation{Principal: 200, Interest: 20, Fees: 5, Penalties: 2}, 73},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// act
+			out, unallocated := allocate(owed, tt.order, tt.amount)
+
+			// assert
+			assert.Equal(t, tt.wantAllocation, out)
+			assert.Equal(t, tt.wantUnallocated, unallocated)
+		})
+	}
+}
+
+func TestBillerEngine_PaymentAllocation(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC)
+	now := curdate.AddDate(0, 0, 8) // a day after the first installment was due
+	newEngine := func(order ...AllocationComponent) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+			LateFeeRules:                        []LateFeeRule{{Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyIDR)}},
+			AllocationOrder:                     order,
+		})
+		require.NoError(t, err)
+		return b
+	}
+	newBillable := func(t *testing.T, b *BillerEngine) string {
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 8)
+		_, err = b.ChargeLateFees(bid, time.Time{})
+		require.NoError(t, err)
+		return bid
+	}
+
+	t.Run("default_order", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		bid := newBillable(t, b)
+
+		// act
+		payment, err := b.MakePayment(bid, InputMakePayment{Amount: 15_000})
+		outstanding, errOutstanding := b.GetOutstanding(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(10_000, CurrencyIDR), payment.AmountFees)
+		assert.Equal(t, NewMoney(5_000, CurrencyIDR), payment.AmountInterest)
+		assert.Equal(t, NewMoney(0, CurrencyIDR), payment.AmountPrincipal)
+		assert.NoError(t, errOutstanding)
+		assert.Equal(t, NewMoney(5_000_000, CurrencyIDR), outstanding.OutstandingPrincipal)
+		assert.Equal(t, NewMoney(495_000, CurrencyIDR), outstanding.OutstandingInterest)
+		assert.Equal(t, NewMoney(0, CurrencyIDR), outstanding.OutstandingFees)
+		assert.Equal(t, NewMoney(5_495_000, CurrencyIDR), outstanding.Outstanding)
+
+		schedule, err := b.GetSchedule(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, 5_000, schedule[0].AmountPaid)
+	})
+
+	t.Run("configured_order", func(t *testing.T) {
+		// arrange
+		b := newEngine(AllocationPrincipal, AllocationInterest, AllocationFees, AllocationPenalties)
+		bid := newBillable(t, b)
+
+		// act
+		payment, err := b.MakePayment(bid, InputMakePayment{Amount: 115_000})
+		outstanding, errOutstanding := b.GetOutstanding(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(100_000, CurrencyIDR), payment.AmountPrincipal)
+		assert.Equal(t, NewMoney(10_000, CurrencyIDR), payment.AmountInterest)
+		assert.Equal(t, NewMoney(5_000, CurrencyIDR), payment.AmountFees)
+		assert.NoError(t, errOutstanding)
+		assert.Equal(t, NewMoney(4_900_000, CurrencyIDR), outstanding.OutstandingPrincipal)
+		assert.Equal(t, NewMoney(490_000, CurrencyIDR), outstanding.OutstandingInterest)
+		assert.Equal(t, NewMoney(5_000, CurrencyIDR), outstanding.OutstandingFees)
+	})
+
+	t.Run("reversal", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		bid := newBillable(t, b)
+		payment, err := b.MakePayment(bid, InputMakePayment{Amount: 130_000})
+		require.NoError(t, err)
+
+		// act
+		reversal, err := b.ReversePayment(payment.ID, InputReversePayment{Reason: "bounced"})
+		outstanding, errOutstanding := b.GetOutstanding(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, payment.AmountFees.Neg(), reversal.AmountFees)
+		assert.Equal(t, payment.AmountInterest.Neg(), reversal.AmountInterest)
+		assert.Equal(t, payment.AmountPrincipal.Neg(), reversal.AmountPrincipal)
+		assert.NoError(t, errOutstanding)
+		assert.Equal(t, NewMoney(5_000_000, CurrencyIDR), outstanding.OutstandingPrincipal)
+		assert.Equal(t, NewMoney(500_000, CurrencyIDR), outstanding.OutstandingInterest)
+		assert.Equal(t, NewMoney(10_000, CurrencyIDR), outstanding.OutstandingFees)
+	})
+
+	t.Run("bad_order", func(t *testing.T) {
+		for _, order := range [][]AllocationComponent{
+			{AllocationPrincipal, AllocationInterest},
+			{AllocationPrincipal, AllocationInterest, AllocationFees, AllocationFees},
+			{AllocationPrincipal, AllocationInterest, AllocationFees, "tax"},
+		} {
+			// act
+			_, err := NewBillerEngine(BillerEngineConfig{
+				Store:                               setupTestStore(),
+				GenerateCurrentDate:                 time.Now,
+				DefaultLoanDurationWeeks:            50,
+				DefaultInterestRatePercentage:       .1,
+				PaymentSkipCountDeliquencyThreshold: 2,
+				AllocationOrder:                     order,
+			})
+
+			// assert
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+
+	validator "github.com/avrebarra/minivalidator"
+	"github.com/rs/xid"
+)
+
+// billableTransitions lists the statuses each status may move to. Statuses
+// missing from the map are terminal.
+var billableTransitions = map[BillableStatus][]BillableStatus{
+	BillableStatusPending:    {BillableStatusActive, BillableStatusCancelled},
+	BillableStatusActive:     {BillableStatusDelinquent, BillableStatusPaidOff, BillableStatusWrittenOff, BillableStatusCancelled},
+	BillableStatusDelinquent: {BillableStatusActive, BillableStatusPaidOff, BillableStatusWrittenOff},
+	BillableStatusPaidOff:    {BillableStatusActive}, // reopened when a payment is reversed
+}
+
+// manualTransitions are the target statuses operators may request directly,
+// the rest are driven by payments and delinquency evaluation.
+var manualTransitions = map[BillableStatus]bool{
+	BillableStatusActive:     true,
+	BillableStatusWrittenOff: true,
+	BillableStatusCancelled:  true,
+}
+
+func canTransition(from, to BillableStatus) bool {
+	for _, s := range billableTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *BillerEngine) GetBillable(bID string) (out Billable, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	out, err = b.Conf.Store.GetBillable(bID)
+	if err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) TransitionBillable(bID string, in InputTransitionBillable) (out BillableTransition, err error) {
+	// validate inputs
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+	if !manualTransitions[in.Status] {
+		err = fmt.Errorf("bad input: status %s cannot be set manually", in.Status)
+		return
+	}
+
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		billable, err := tx.GetBillable(bID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", bID)
+			return
+		}
+
+		if in.Status == BillableStatusActive && billable.Status != BillableStatusPending {
+			err = fmt.Errorf("invalid status transition: only pending billables can be activated")
+			return
+		}
+
+		out, err = b.transitionBillable(tx, bID, billable.Status, in.Status, in.Reason)
+		return
+	})
+	return
+}
+
+func (b *BillerEngine) GetBillableTransitions(bID string) (out []BillableTransition, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	out, err = b.Conf.Store.ListTransitions(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching transitions: %w", err)
+		return
+	}
+	return
+}
+
+// transitionBillable moves the billable from one status to another and
+// records the change, rejecting moves the lifecycle does not allow.
+func (b *BillerEngine) transitionBillable(tx BillerRepository, bID string, from, to BillableStatus, reason string) (out BillableTransition, err error) {
+	if !canTransition(from, to) {
+		err = fmt.Errorf("invalid status transition: %s to %s", from, to)
+		return
+	}
+
+	out, err = b.recordTransition(tx, bID, from, to, reason)
+	if err != nil {
+		return
+	}
+
+	err = b.trackDelinquencyEpisode(tx, out)
+	return
+}
+
+func (b *BillerEngine) recordTransition(tx BillerRepository, bID string, from, to BillableStatus, reason string) (out BillableTransition, err error) {
+	out = BillableTransition{
+		ID:         xid.New().String(),
+		BillableID: bID,
+		FromStatus: from,
+		ToStatus:   to,
+		Reason:     reason,
+		CreatedAt:  b.Conf.GenerateCurrentDate(),
+	}
+	if err = b.recordEvent(tx, bID, EventStatusChanged, out); err != nil {
+		return
+	}
+	err = b.postJournal(tx, bID, fmt.Sprintf("status changed to %s", to), out.ID)
+	return
+}
+
+// syncDelinquencyStatus flips an open billable between active and delinquent
+// to match the latest evaluation and returns the resulting status. Callers
+// hold the billable lock.
+func (b *BillerEngine) syncDelinquencyStatus(tx BillerRepository, bID string, details DelinquencyDetails) (out BillableStatus, err error) {
+	billable, err := tx.GetBillable(bID)
+	if err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+	out = billable.Status
+
+	switch {
+	case out == BillableStatusActive && details.Delinquency:
+		out = BillableStatusDelinquent
+		_, err = b.transitionBillable(tx, bID, billable.Status, out, "delinquency policy breached")
+	case out == BillableStatusDelinquent && !details.Delinquency:
+		out = BillableStatusActive
+		_, err = b.transitionBillable(tx, bID, billable.Status, out, "arrears cured")
+	}
+	if err != nil || out != BillableStatusDelinquent {
+		return
+	}
+
+	err = b.recordDelinquencyPeak(tx, bID, details)
+	return
+}
+
+// ***
+
+type InputTransitionBillable struct {
+	Status BillableStatus `validate:"required"`
+	Reason string         `validate:"required"`
+}
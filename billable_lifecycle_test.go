@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from BillableStatus
+		to   BillableStatus
+		want bool
+	}{
+		{BillableStatusPending, BillableStatusActive, true},
+		{BillableStatusPending, BillableStatusDelinquent, false},
+		{BillableStatusActive, BillableStatusDelinquent, true},
+		{BillableStatusActive, BillableStatusPending, false},
+		{BillableStatusDelinquent, BillableStatusActive, true},
+		{BillableStatusDelinquent, BillableStatusCancelled, false},
+		{BillableStatusPaidOff, BillableStatusActive, true},
+		{BillableStatusPaidOff, BillableStatusDelinquent, false},
+		{BillableStatusWrittenOff, BillableStatusActive, false},
+		{BillableStatusCancelled, BillableStatusActive, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, canTransition(tt.from, tt.to), "%s to %s", tt.from, tt.to)
+	}
+}
+
+func TestBillerEngine_Lifecycle(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now()
+	getDate := func() time.Time { return curdate }
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return getDate() },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+		PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+	})
+	require.NoError(t, err)
+
+	t.Run("pending_until_activated", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		billable, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000, Pending: true})
+		require.NoError(t, err)
+		assert.Equal(t, BillableStatusPending, billable.Status)
+
+		// act
+		_, errPending := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate})
+		transition, errActivate := b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusActive, Reason: "disbursed"})
+		_, errActive := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate})
+
+		// assert
+		assert.Error(t, errPending)
+		assert.NoError(t, errActivate)
+		assert.Equal(t, BillableStatusPending, transition.FromStatus)
+		assert.Equal(t, BillableStatusActive, transition.ToStatus)
+		assert.NoError(t, errActive)
+	})
+
+	t.Run("delinquent_and_cured", func(t *testing.T) {
+		orig := getDate
+		defer func() { getDate = orig }()
+
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		getDate = func() time.Time { return curdate.AddDate(0, 0, 14) }
+		delinquency, err := b.IsDelinquent(bid, time.Time{})
+		require.NoError(t, err)
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 220_000, PaidAt: getDate()})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, BillableStatusDelinquent, delinquency.Status)
+
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusActive, billable.Status)
+
+		transitions, err := b.GetBillableTransitions(bid)
+		assert.NoError(t, err)
+		require.Len(t, transitions, 3)
+		assert.Equal(t, BillableStatusActive, transitions[0].ToStatus)
+		assert.Equal(t, BillableStatusDelinquent, transitions[1].ToStatus)
+		assert.Equal(t, BillableStatusActive, transitions[2].ToStatus)
+		assert.Equal(t, "arrears cured", transitions[2].Reason)
+	})
+
+	t.Run("past_evaluation_keeps_status", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		delinquency, err := b.IsDelinquent(bid, curdate.AddDate(0, 0, 21))
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, true, delinquency.Delinquency)
+		assert.Equal(t, BillableStatusActive, delinquency.Status)
+	})
+
+	t.Run("paid_off_is_closed", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		_, errPay := b.MakePayment(bid, InputMakePayment{Amount: 5_500_000, PaidAt: curdate})
+		_, errAfter := b.MakePayment(bid, InputMakePayment{Amount: 1, PaidAt: curdate})
+		_, errWriteOff := b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusWrittenOff, Reason: "uncollectible"})
+
+		// assert
+		assert.NoError(t, errPay)
+		assert.Error(t, errAfter)
+		assert.Error(t, errWriteOff)
+
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusPaidOff, billable.Status)
+	})
+
+	t.Run("manual_transitions", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		_, errPaidOff := b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusPaidOff, Reason: "manual"})
+		_, errNoReason := b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusWrittenOff})
+		_, errWriteOff := b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusWrittenOff, Reason: "uncollectible"})
+		_, errPay := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate})
+
+		// assert
+		assert.Error(t, errPaidOff)
+		assert.Error(t, errNoReason)
+		assert.NoError(t, errWriteOff)
+		assert.Error(t, errPay)
+	})
+}
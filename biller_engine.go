@@ -1,71 +1,377 @@
 package main
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
 	"math"
+	"sort"
+	"sync"
 	"time"
 
 	validator "github.com/avrebarra/minivalidator"
-	"github.com/mattn/go-sqlite3"
 	"github.com/rs/xid"
 )
 
 type BillerEngineConfig struct {
-	Storage             *sql.DB          `validate:"required"`
+	Store               BillerStore      `validate:"required"`
 	GenerateCurrentDate func() time.Time `validate:"required"`
 
-	DefaultLoanDurationWeeks            int     `validate:"required"`
+	DefaultLoanDurationWeeks            int     `validate:"required"` // converted to installments at the frequency of the billable
 	DefaultInterestRatePercentage       float64 `validate:"required"` // percentage in float
-	PaymentSkipCountDeliquencyThreshold int     `validate:"required"` // how many payments to skip until marked as delinquent
+	PaymentSkipCountDeliquencyThreshold int     `validate:"required"` // how many payments to skip until marked as delinquent by the default policy
+
+	DefaultCurrency      Currency          // currency of billables created without one, defaults to IDR
+	DefaultInterestModel InterestModelKind // interest model of billables created without one, defaults to flat
+	DefaultTimezone      string            // timezone of billables created without one, defaults to UTC
+
+	DefaultGraceDays   int    `validate:"gte=0"` // days past a due date installments may still be paid in
+	DefaultGraceCutoff string // local time of day, HH:MM, grace periods end at on their last day, none when empty
+
+	BusinessDayConvention BusinessDayConvention // how due dates on weekends and holidays move, defaults to unadjusted
+	Holidays              *HolidayCalendar      // dates besides weekends that are not business days, defaults to an empty calendar
+
+	// per-billable term bounds, zero max means unbounded
+	MinLoanDurationWeeks      int     `validate:"gte=0"`
+	MaxLoanDurationWeeks      int     `validate:"gte=0"`
+	MinInterestRatePercentage float64 `validate:"gte=0"`
+	MaxInterestRatePercentage float64 `validate:"gte=0"`
+
+	PaymentPolicy    PaymentPolicy // defaults to strict when empty
+	AllowOverpayment bool          // accept payments beyond the outstanding amount
+
+	PayoffInterestRebatePercentage float64 `validate:"gte=0,lte=1"` // portion of unearned interest waived on early payoff
+
+	LateFeeRules    []LateFeeRule         // fees charged on installments left unpaid past due, none when empty
+	AllocationOrder []AllocationComponent // order the components of an installment are paid in, defaults to DefaultAllocationOrder
+
+	DelinquencyPolicy          DelinquencyPolicy            // defaults to arrears of the skip count threshold of installments
+	ProductDelinquencyPolicies map[string]DelinquencyPolicy // by loan product, billables of other products follow DelinquencyPolicy
+
+	IdempotencyKeyTTL time.Duration `validate:"gte=0"` // how long idempotency keys are kept, zero keeps them forever
+
+	GLAccounts GLAccounts // accounts journal entries post to, defaults to DefaultGLAccounts when empty
 }
 
+type PaymentPolicy string
+
+const (
+	PaymentPolicyStrict                PaymentPolicy = "strict"                   // exactly one installment
+	PaymentPolicyAtLeastOneInstallment PaymentPolicy = "at_least_one_installment" // one installment or more
+	PaymentPolicyAnyPositiveAmount     PaymentPolicy = "any_positive_amount"      // partial payments allowed
+)
+
 type BillerEngine struct {
 	Conf BillerEngineConfig
+
+	billableLocks keyedMutex // by billable id
+	borrowerLocks keyedMutex // by borrower id
+	dueDates      DueDateCalculator
 }
 
 func NewBillerEngine(conf BillerEngineConfig) (out *BillerEngine, err error) {
+	if conf.GLAccounts == (GLAccounts{}) {
+		conf.GLAccounts = DefaultGLAccounts
+	}
 	if err = validator.Validate(conf); err != nil {
 		err = fmt.Errorf("bad config: %w", err)
 		return
 	}
-	out = &BillerEngine{Conf: conf}
+	if err = validator.Validate(conf.GLAccounts); err != nil {
+		err = fmt.Errorf("bad config: gl accounts: %w", err)
+		return
+	}
+	if conf.DefaultInterestModel == "" {
+		conf.DefaultInterestModel = InterestModelFlat
+	}
+	if !conf.DefaultInterestModel.IsSupported() {
+		err = fmt.Errorf("bad config: unsupported interest model %s", conf.DefaultInterestModel)
+		return
+	}
+	if conf.DefaultCurrency == "" {
+		conf.DefaultCurrency = CurrencyIDR
+	}
+	if !conf.DefaultCurrency.IsSupported() {
+		err = fmt.Errorf("bad config: unsupported currency %s", conf.DefaultCurrency)
+		return
+	}
+	if conf.DefaultTimezone == "" {
+		conf.DefaultTimezone = "UTC"
+	}
+	if _, errTZ := time.LoadLocation(conf.DefaultTimezone); errTZ != nil {
+		err = fmt.Errorf("bad config: unknown timezone %s", conf.DefaultTimezone)
+		return
+	}
+	if err = validateGraceCutoff(conf.DefaultGraceCutoff); err != nil {
+		err = fmt.Errorf("bad config: %w", err)
+		return
+	}
+	if conf.Holidays == nil {
+		conf.Holidays = NewHolidayCalendar()
+	}
+	if conf.BusinessDayConvention == "" {
+		conf.BusinessDayConvention = BusinessDayUnadjusted
+	}
+	if !conf.BusinessDayConvention.IsSupported() {
+		err = fmt.Errorf("bad config: unsupported business day convention %s", conf.BusinessDayConvention)
+		return
+	}
+	switch conf.PaymentPolicy {
+	case "", PaymentPolicyStrict, PaymentPolicyAtLeastOneInstallment, PaymentPolicyAnyPositiveAmount:
+	default:
+		err = fmt.Errorf("bad config: unknown payment policy %s", conf.PaymentPolicy)
+		return
+	}
+	if err = validateLateFeeRules(conf.LateFeeRules); err != nil {
+		err = fmt.Errorf("bad config: %w", err)
+		return
+	}
+	if len(conf.AllocationOrder) == 0 {
+		conf.AllocationOrder = DefaultAllocationOrder
+	}
+	if err = validateAllocationOrder(conf.AllocationOrder); err != nil {
+		err = fmt.Errorf("bad config: %w", err)
+		return
+	}
+	if conf.DelinquencyPolicy == nil {
+		conf.DelinquencyPolicy = ArrearsPolicy{Installments: conf.PaymentSkipCountDeliquencyThreshold}
+	}
+	if err = validateDelinquencyPolicy(conf.DelinquencyPolicy); err != nil {
+		err = fmt.Errorf("bad config: delinquency policy: %w", err)
+		return
+	}
+	for product, policy := range conf.ProductDelinquencyPolicies {
+		if err = validateDelinquencyPolicy(policy); err != nil {
+			err = fmt.Errorf("bad config: delinquency policy of product %s: %w", product, err)
+			return
+		}
+	}
+	if conf.MaxLoanDurationWeeks > 0 && conf.MinLoanDurationWeeks > conf.MaxLoanDurationWeeks {
+		err = fmt.Errorf("bad config: min loan duration exceeds max")
+		return
+	}
+	if conf.MaxInterestRatePercentage > 0 && conf.MinInterestRatePercentage > conf.MaxInterestRatePercentage {
+		err = fmt.Errorf("bad config: min interest rate exceeds max")
+		return
+	}
+	out = &BillerEngine{
+		Conf:     conf,
+		dueDates: DueDateCalculator{Convention: conf.BusinessDayConvention, Holidays: conf.Holidays},
+	}
 	return
 }
 
+// lockBillable serializes changes to the ledger of a single billable within
+// this engine and returns the func releasing it.
+func (b *BillerEngine) lockBillable(bID string) (unlock func()) {
+	return b.billableLocks.Lock(bID)
+}
+
+// keyedMutex holds a mutex per key for as long as someone holds or waits on
+// it, so keys seen once do not pile up. The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int // holders and waiters, guarded by keyedMutex.mu
+}
+
+// Lock blocks until the key is free and returns the func releasing it.
+func (m *keyedMutex) Lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = map[string]*keyedLock{}
+	}
+	lock, ok := m.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		m.locks[key] = lock
+	}
+	lock.refs++
+	m.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(m.locks, key)
+		}
+	}
+}
+
+// size returns how many keys are held or waited on.
+func (m *keyedMutex) size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.locks)
+}
+
 func (b *BillerEngine) MakeBillable(in InputMakeBillable) (out Billable, err error) {
+	if in.IdempotencyKey == "" {
+		return b.makeBillable(in)
+	}
+
+	key := in.IdempotencyKey
+	in.IdempotencyKey = ""
+	err = b.withIdempotency(key, idempotentRequest{Operation: "make_billable", Input: in}, &out, func() (err error) {
+		out, err = b.makeBillable(in)
+		return
+	})
+	return
+}
+
+func (b *BillerEngine) makeBillable(in InputMakeBillable) (out Billable, err error) {
 	// validate inputs
 	if err = validator.Validate(in); err != nil {
 		err = fmt.Errorf("bad input: %w", err)
 		return
 	}
 
-	curDate := b.Conf.GenerateCurrentDate()
-	dueDate := curDate.AddDate(0, b.Conf.DefaultLoanDurationWeeks, 0)
-	amount := int(math.Ceil(float64(in.Principal) * (b.Conf.DefaultInterestRatePercentage + 1)))
+	// resolve loan terms, falling back to configured defaults
+	interestRate := b.Conf.DefaultInterestRatePercentage
+	if in.InterestRatePercentage != nil {
+		interestRate = *in.InterestRatePercentage
+	}
+	frequency := in.Frequency
+	if frequency == "" {
+		frequency = FrequencyWeekly
+	}
+	if !frequency.IsSupported() {
+		err = fmt.Errorf("bad input: unsupported installment frequency: %s", frequency)
+		return
+	}
+	weeks := b.Conf.DefaultLoanDurationWeeks
+	if in.DurationWeeks > 0 {
+		weeks = in.DurationWeeks
+	}
+	tenor := in.Tenor
+	if tenor == 0 {
+		tenor = frequency.InstallmentsIn(weeks)
+	}
+	interestModel := in.InterestModel
+	if interestModel == "" {
+		interestModel = b.Conf.DefaultInterestModel
+	}
+	currency := in.Currency
+	if currency == "" {
+		currency = b.Conf.DefaultCurrency
+	}
+	if !currency.IsSupported() {
+		err = fmt.Errorf("bad input: unsupported currency %s", currency)
+		return
+	}
+
+	timezone := in.Timezone
+	if timezone == "" {
+		timezone = b.Conf.DefaultTimezone
+	}
+	graceDays := b.Conf.DefaultGraceDays
+	if in.GraceDays != nil {
+		graceDays = *in.GraceDays
+	}
+	graceCutoff := in.GraceCutoff
+	if graceCutoff == "" {
+		graceCutoff = b.Conf.DefaultGraceCutoff
+	}
+	if err = validateGraceCutoff(graceCutoff); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	status := BillableStatusActive
+	if in.Pending {
+		status = BillableStatusPending
+	}
 
 	// create and store the billable
 	billable := Billable{
-		ID:        in.BID,
-		Principal: in.Principal,
-		Amount:    amount,
-		DurWeek:   b.Conf.DefaultLoanDurationWeeks,
-		CreatedAt: curDate,
-		DueAt:     dueDate,
+		ID:            in.BID,
+		BorrowerID:    in.BorrowerID,
+		Principal:     NewMoney(in.Principal, currency),
+		Tenor:         tenor,
+		InterestRate:  interestRate,
+		InterestModel: interestModel,
+		Frequency:     frequency,
+		Timezone:      timezone,
+		GraceDays:     graceDays,
+		GraceCutoff:   graceCutoff,
+		Product:       in.Product,
+		Status:        status,
+		CreatedAt:     b.Conf.GenerateCurrentDate(),
 	}
 
-	_, err = b.Conf.Storage.Exec(
-		"INSERT INTO billables (id, amount, principal, dur_week, created_at, due_at) VALUES (?, ?, ?, ?, ?, ?);",
-		billable.ID, billable.Amount, billable.Principal, billable.DurWeek, billable.CreatedAt, billable.DueAt,
-	)
-	var dbErr sqlite3.Error
-	if errors.As(err, &dbErr) && dbErr.Code == sqlite3.ErrConstraint {
-		err = fmt.Errorf("unique id violation: %w", err)
+	// the billable is due on its last installment
+	dueDates, err := b.dueDates.DueDates(billable)
+	if err != nil {
+		err = fmt.Errorf("bad input: %w", err)
 		return
 	}
+	billable.DueAt = dueDates[len(dueDates)-1]
+	if err = b.validateTerms(billable.CreatedAt, billable.DueAt, interestRate, interestModel); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	// the interest model prices the schedule, the bill follows from it
+	installments, err := makeInstallments(billable, dueDates)
+	if err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+	interest := 0
+	for _, inst := range installments {
+		interest += inst.InterestDue
+	}
+	billable.Interest = NewMoney(interest, currency)
+	if billable.Amount, err = billable.Principal.Add(billable.Interest); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+	billable.EffectiveRate = effectiveRateOf(billable.Principal.Amount, billable.CreatedAt, installments)
+
+	// loans of a borrower are granted one at a time, against their exposure
+	// as of the transaction that stores the new one
+	unlock := b.borrowerLocks.Lock(in.BorrowerID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		// borrowers already delinquent on another billable get no new loans
+		if _, err = tx.GetBorrower(in.BorrowerID); err != nil {
+			err = fmt.Errorf("bad input: borrower not found: id %s", in.BorrowerID)
+			return
+		}
+		exposure, err := b.exposureOf(tx, in.BorrowerID, billable.CreatedAt)
+		if err != nil {
+			return
+		}
+		if exposure.Delinquent {
+			err = fmt.Errorf("%w: id %s", ErrBorrowerDelinquent, in.BorrowerID)
+			return
+		}
+
+		// store the amortization schedule along with the billable
+		err = b.recordEvent(tx, billable.ID, EventBillableCreated, BillableCreatedPayload{Billable: billable, Installments: installments})
+		if errors.Is(err, ErrStoreDuplicateID) {
+			err = fmt.Errorf("unique id violation: %w", err)
+			return
+		}
+		if err != nil {
+			return
+		}
+		if _, err = b.recordTransition(tx, billable.ID, "", billable.Status, "billable created"); err != nil {
+			return
+		}
+
+		// answer with the billable as its event recorded it
+		billable, err = tx.GetBillable(billable.ID)
+		return
+	})
 	if err != nil {
-		err = fmt.Errorf("insert failed: %w", err)
 		return
 	}
 
@@ -73,91 +379,393 @@ func (b *BillerEngine) MakeBillable(in InputMakeBillable) (out Billable, err err
 	return
 }
 
-func (b *BillerEngine) GetOutstanding(bID string) (out OutstandingDetails, err error) {
+// makeInstallments lays out an installment of the billable on each due date,
+// priced by its interest model from the principal and interest rate.
+func makeInstallments(billable Billable, dueDates []time.Time) (out []Installment, err error) {
+	model, err := interestModelOf(billable.InterestModel)
+	if err != nil {
+		return
+	}
+
+	terms := LoanTerms{Principal: billable.Principal, InterestRate: billable.InterestRate, StartAt: billable.CreatedAt, DueDates: dueDates}
+	amounts, err := model.Schedule(terms)
+	if err != nil {
+		err = fmt.Errorf("failed to price schedule: %w", err)
+		return
+	}
+
+	for i, amount := range amounts {
+		out = append(out, Installment{
+			BillableID:  billable.ID,
+			Seq:         i + 1,
+			DueAt:       terms.DueDates[i],
+			AmountDue:   amount.Principal + amount.Interest,
+			InterestDue: amount.Interest,
+			AmountPaid:  0,
+			Status:      InstallmentStatusUnpaid,
+		})
+	}
+	return
+}
+
+// validateTerms checks the terms against the configured bounds. The loan
+// duration is bounded by the time from start to its last due date, whatever
+// the frequency of its installments.
+func (b *BillerEngine) validateTerms(startAt, dueAt time.Time, interestRate float64, interestModel InterestModelKind) error {
+	days := int(math.Round(daysBetween(startAt, dueAt)))
+	if days < 7*b.Conf.MinLoanDurationWeeks || (b.Conf.MaxLoanDurationWeeks > 0 && days > 7*b.Conf.MaxLoanDurationWeeks) {
+		return fmt.Errorf("loan duration out of bounds: %d days", days)
+	}
+	if interestRate < b.Conf.MinInterestRatePercentage || (b.Conf.MaxInterestRatePercentage > 0 && interestRate > b.Conf.MaxInterestRatePercentage) {
+		return fmt.Errorf("interest rate out of bounds: %v", interestRate)
+	}
+	if !interestModel.IsSupported() {
+		return fmt.Errorf("unsupported interest model: %s", interestModel)
+	}
+	return nil
+}
+
+func (b *BillerEngine) GetSchedule(bID string) (out []Installment, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	// ensure billable exists
+	if _, err = b.Conf.Store.GetBillable(bID); err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+
+	out, err = b.Conf.Store.ListInstallments(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching installments: %w", err)
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) GetOutstanding(bID string, asOf time.Time) (out OutstandingDetails, err error) {
 	// validate required inputs
 	if bID == "" {
 		err = fmt.Errorf("bad input: billable id not defined")
 		return
 	}
+	if asOf.IsZero() {
+		asOf = b.Conf.GenerateCurrentDate()
+	}
 
+	out, err = b.outstandingOf(b.Conf.Store, bID, asOf)
+	return
+}
+
+// outstandingOf reads what is owed on the billable as of the date through the
+// given repository.
+func (b *BillerEngine) outstandingOf(repo BillerRepository, bID string, asOf time.Time) (out OutstandingDetails, err error) {
 	// find the billable
-	var billable Billable
-	err = b.Conf.Storage.QueryRow("SELECT amount, principal FROM billables WHERE id = ?", bID).Scan(&billable.Amount, &billable.Principal)
+	billable, err := repo.GetBillable(bID)
 	if err != nil {
 		err = fmt.Errorf("billable not found: id %s", bID)
 		return
 	}
+	if asOf.Before(billable.CreatedAt) {
+		err = fmt.Errorf("billable did not exist as of %s", asOf.Format(time.RFC3339))
+		return
+	}
 
-	// find last payment for the billable
-	var amountPaid int
-	var paidAt time.Time
-	err = b.Conf.Storage.QueryRow("SELECT amount_accumulated, paid_at FROM payments WHERE billable_id = ? ORDER BY created_at DESC, paid_at DESC LIMIT 1", bID).Scan(&amountPaid, &paidAt)
-	if errors.Is(err, sql.ErrNoRows) {
-		amountPaid = 0
-		err = nil
+	// sum up payments made until asOf, interest waived on early payoff is no longer owed
+	payments, err := b.getPayments(repo, bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching payments: %w", err)
+		return
 	}
+	amountPaid, amountRebated := sumPaymentsAsOf(payments, asOf)
+	currency := billable.Amount.Currency
+
+	// late fees charged until asOf are owed on top of the bill
+	fees, err := repo.ListFees(bID)
 	if err != nil {
-		err = fmt.Errorf("error fetching latest payment: %w", err)
+		err = fmt.Errorf("error fetching fees: %w", err)
 		return
 	}
+	amountFees := 0
+	for _, fee := range fees {
+		if !fee.AccruedTo.After(asOf) {
+			amountFees += fee.Amount.Amount
+		}
+	}
+
+	// what is left of each component as of the same date
+	_, owed, err := b.owedOn(repo, bID, asOf)
+	if err != nil {
+		return
+	}
+	remaining := totalOwed(owed)
 
-	outstanding := billable.Amount - amountPaid
 	out = OutstandingDetails{
-		Principal:   billable.Principal,
-		Bill:        billable.Amount,
-		Paid:        amountPaid,
-		Outstanding: outstanding,
+		Principal:            billable.Principal,
+		Interest:             billable.Interest,
+		Fees:                 NewMoney(amountFees, currency),
+		Bill:                 billable.Amount,
+		Paid:                 NewMoney(amountPaid, currency),
+		Rebated:              NewMoney(amountRebated, currency),
+		Outstanding:          NewMoney(billable.Amount.Amount+amountFees-amountPaid-amountRebated, currency),
+		OutstandingPrincipal: NewMoney(remaining.Principal, currency),
+		OutstandingInterest:  NewMoney(remaining.Interest, currency),
+		OutstandingFees:      NewMoney(remaining.Fees, currency),
+		OutstandingPenalties: NewMoney(remaining.Penalties, currency),
+		Status:               billable.Status,
 	}
 
 	return out, nil
 }
 
-func (b *BillerEngine) IsDelinquent(bID string) (out DelinquencyDetails, err error) {
+func (b *BillerEngine) IsDelinquent(bID string, asOf time.Time) (out DelinquencyDetails, err error) {
 	//  validate required inputs
 	if bID == "" {
 		err = fmt.Errorf("bad input: billable id not defined")
 		return
 	}
 
-	// retrieve billable
-	var billable Billable
-	err = b.Conf.Storage.QueryRow("SELECT amount, dur_week, created_at FROM billables WHERE id = ?", bID).
-		Scan(&billable.Amount, &billable.DurWeek, &billable.CreatedAt)
+	// evaluations of the current date keep the billable status in sync
+	current := asOf.IsZero()
+	if current {
+		asOf = b.Conf.GenerateCurrentDate()
+		unlock := b.lockBillable(bID)
+		defer unlock()
+	}
+
+	if !current {
+		out, err = b.evaluateDelinquency(b.Conf.Store, bID, asOf)
+		return
+	}
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		out, err = b.evaluateDelinquency(tx, bID, asOf)
+		if err != nil {
+			return
+		}
+		out.Status, err = b.syncDelinquencyStatus(tx, bID, out)
+		if err != nil {
+			err = fmt.Errorf("failed to sync billable status: %w", err)
+			return
+		}
+		return
+	})
+	return
+}
+
+func (b *BillerEngine) evaluateDelinquency(repo BillerRepository, bID string, asOf time.Time) (out DelinquencyDetails, err error) {
+	billable, _, out, snapshot, err := b.arrearsAsOf(repo, bID, asOf)
 	if err != nil {
-		return out, err
+		return
 	}
-	weeklyBillAmount := int(float64(billable.Amount) / float64(billable.DurWeek))
 
-	// retrieve latest payments
-	getWeeksSinceDate := func(startDate time.Time) int {
-		millisecondsInWeek := 7 * 24 * 60 * 60 * 1000
-		currentDate := b.Conf.GenerateCurrentDate()
-		diffInMilliseconds := int(currentDate.Sub(startDate).Milliseconds())
-		return diffInMilliseconds / millisecondsInWeek
+	out.Delinquency, err = b.isDelinquent(repo, billable, snapshot)
+	if err != nil {
+		return
 	}
+	out.CollectionStage, err = collectionStageOf(repo, snapshot)
+	if err != nil {
+		return
+	}
+	return
+}
 
-	var amountPaid int
-	err = b.Conf.Storage.QueryRow("SELECT amount_accumulated FROM payments WHERE billable_id = ? ORDER BY created_at DESC, paid_at DESC LIMIT 1", bID).
-		Scan(&amountPaid)
-	if errors.Is(err, sql.ErrNoRows) {
-		amountPaid = 0
-		err = nil
+// arrearsAsOf rebuilds the schedule of the billable as of asOf from the
+// payments made until then and works out its arrears, leaving the decisions
+// on them to the caller.
+func (b *BillerEngine) arrearsAsOf(repo BillerRepository, bID string, asOf time.Time) (billable Billable, installments []Installment, out DelinquencyDetails, snapshot DelinquencySnapshot, err error) {
+	// retrieve billable
+	billable, err = repo.GetBillable(bID)
+	if err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
 	}
+	if asOf.Before(billable.CreatedAt) {
+		err = fmt.Errorf("billable did not exist as of %s", asOf.Format(time.RFC3339))
+		return
+	}
+	loc, err := time.LoadLocation(billable.Timezone)
 	if err != nil {
-		err = fmt.Errorf("error fetching latest payment: %w", err)
+		err = fmt.Errorf("billable has unknown timezone: %s", billable.Timezone)
 		return
 	}
 
-	billableAgeInWeek := getWeeksSinceDate(billable.CreatedAt)
-	expectedAggregatedPaidAmount := weeklyBillAmount * billableAgeInWeek
-	delinquencyThreshold := b.Conf.PaymentSkipCountDeliquencyThreshold
+	// retrieve schedule
+	installments, err = repo.ListInstallments(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching installments: %w", err)
+		return
+	}
+	if len(installments) == 0 {
+		err = fmt.Errorf("billable has no installments: id %s", bID)
+		return
+	}
+
+	// retrieve payments made until asOf and rebuild the schedule state from them
+	payments, err := b.getPayments(repo, bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching payments: %w", err)
+		return
+	}
+	amountPaid, _ := sumPaymentsAsOf(payments, asOf)
+	settled := settledAsOf(payments, asOf)
+	installments = scheduleAsOf(installments, settled.Principal+settled.Interest)
 
 	// build output
-	out.Delinquency = expectedAggregatedPaidAmount-amountPaid >= delinquencyThreshold*int(weeklyBillAmount)
+	out, snapshot = b.arrearsOf(billable, installments, loc, asOf)
+	out.ActualPaidAmount = NewMoney(amountPaid, billable.Amount.Currency)
+	out.Status = billable.Status
 	return
 }
 
-func (b *BillerEngine) MakePayment(bID string, in InputMakePayment) (out Payment, err error) {
+// arrearsOf works out what the billable is behind on as of asOf from its
+// schedule, with the payments made until then already applied.
+func (b *BillerEngine) arrearsOf(billable Billable, installments []Installment, loc *time.Location, asOf time.Time) (out DelinquencyDetails, snapshot DelinquencySnapshot) {
+	expectedAggregatedPaidAmount := 0
+	missedCount, consecutiveMissed, arrears := 0, 0, 0
+	var firstMissedDueAt, graceEndsAt *time.Time
+	for _, inst := range installments {
+		graceEnd := b.graceEndOf(billable, inst.DueAt.In(loc))
+		if graceEndsAt == nil && inst.Status != InstallmentStatusPaid && !inst.DueAt.After(asOf) {
+			graceEndsAt = &graceEnd
+		}
+
+		// installments within their grace period may still be paid
+		if graceEnd.After(asOf) {
+			continue
+		}
+		expectedAggregatedPaidAmount += inst.AmountDue
+		if inst.Status == InstallmentStatusPaid {
+			consecutiveMissed = 0
+			continue
+		}
+		missedCount++
+		consecutiveMissed++
+		arrears += inst.AmountDue - inst.AmountPaid
+		if firstMissedDueAt == nil {
+			dueAt := inst.DueAt
+			firstMissedDueAt = &dueAt
+		}
+	}
+	daysPastDue := 0
+	if firstMissedDueAt != nil {
+		daysPastDue = int(asOf.Sub(*firstMissedDueAt).Hours() / 24)
+	}
+
+	out.MissedInstallments = missedCount
+	out.AmountInArrears = NewMoney(arrears, billable.Amount.Currency)
+	out.DaysPastDue = daysPastDue
+	out.FirstMissedDueAt = firstMissedDueAt
+	out.GraceEndsAt = graceEndsAt
+	out.ExpectedPaidAmount = NewMoney(expectedAggregatedPaidAmount, billable.Amount.Currency)
+	out.Bucket = delinquencyBucketOf(daysPastDue, missedCount)
+
+	snapshot = DelinquencySnapshot{
+		Product:            billable.Product,
+		Principal:          billable.Principal.Amount,
+		InstallmentAmount:  installments[0].AmountDue,
+		MissedInstallments: missedCount,
+		ConsecutiveMissed:  consecutiveMissed,
+		AmountInArrears:    arrears,
+		DaysPastDue:        daysPastDue,
+	}
+	return
+}
+
+// getPayments returns the payment entries of a billable in ledger order: by
+// payment date, then by time of recording, then by id. This is the only
+// ordering of payments, the latest payment is the last entry.
+func (b *BillerEngine) getPayments(repo BillerRepository, bID string) (out []Payment, err error) {
+	out, err = repo.ListPayments(bID)
+	if err != nil {
+		return
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return ledgerBefore(out[i], out[j])
+	})
+
+	// running totals follow the ledger order
+	accumulated := 0
+	for i := range out {
+		accumulated += out[i].Amount.Amount
+		out[i].AmountAccumulated = NewMoney(accumulated, out[i].Amount.Currency)
+	}
+	return
+}
+
+// ledgerBefore tells whether payment entry p comes before q in the ledger.
+func ledgerBefore(p, q Payment) bool {
+	if !p.PaidAt.Equal(q.PaidAt) {
+		return p.PaidAt.Before(q.PaidAt)
+	}
+	if !p.CreatedAt.Equal(q.CreatedAt) {
+		return p.CreatedAt.Before(q.CreatedAt)
+	}
+	return p.ID < q.ID
+}
+
+// sumPaymentsAsOf totals the cash paid and interest rebated by payments made up to asOf.
+func sumPaymentsAsOf(payments []Payment, asOf time.Time) (paid, rebated int) {
+	for _, p := range payments {
+		if p.PaidAt.After(asOf) {
+			continue
+		}
+		paid += p.Amount.Amount
+		rebated += p.AmountRebated.Amount
+	}
+	return
+}
+
+// scheduleAsOf resets the schedule and reallocates settled amount over it. Since
+// payments are always allocated oldest first the result only depends on the total.
+func scheduleAsOf(installments []Installment, settled int) (out []Installment) {
+	out = make([]Installment, len(installments))
+	for i, inst := range installments {
+		inst.AmountPaid = 0
+		inst.Status = InstallmentStatusUnpaid
+		out[i] = inst
+	}
+	touched, _ := allocatePayment(out, settled)
+	for _, inst := range touched {
+		out[inst.Seq-1] = inst
+	}
+	return
+}
+
+func delinquencyBucketOf(daysPastDue, missedCount int) DelinquencyBucket {
+	switch {
+	case missedCount == 0:
+		return DelinquencyBucketCurrent
+	case daysPastDue <= 30:
+		return DelinquencyBucket1To30
+	case daysPastDue <= 60:
+		return DelinquencyBucket31To60
+	case daysPastDue <= 90:
+		return DelinquencyBucket61To90
+	default:
+		return DelinquencyBucketOver90
+	}
+}
+
+func (b *BillerEngine) MakePayment(bID string, in InputMakePayment) (out PaymentReceipt, err error) {
+	if in.IdempotencyKey == "" {
+		return b.makePayment(bID, in)
+	}
+
+	key := in.IdempotencyKey
+	in.IdempotencyKey = ""
+	err = b.withIdempotency(key, idempotentRequest{Operation: "make_payment", BillableID: bID, Input: in}, &out, func() (err error) {
+		out, err = b.makePayment(bID, in)
+		return
+	})
+	return
+}
+
+func (b *BillerEngine) makePayment(bID string, in InputMakePayment) (out PaymentReceipt, err error) {
 	// validate inputs
 	if err = validator.Validate(in); err != nil {
 		err = fmt.Errorf("bad input: %w", err)
@@ -167,77 +775,402 @@ func (b *BillerEngine) MakePayment(bID string, in InputMakePayment) (out Payment
 	amount := in.Amount
 	paidAt := in.PaidAt
 	timestamp := b.Conf.GenerateCurrentDate()
+	if paidAt.IsZero() {
+		paidAt = timestamp
+	}
 
+	// serialize payments per billable and read the current state inside the
+	// same transaction that writes the new one
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	var payment Payment
+	var status BillableStatus
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		// retrieve billable
+		billable, err := tx.GetBillable(bID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", bID)
+			return
+		}
+		if !billable.Status.IsOpen() {
+			err = fmt.Errorf("billable is not accepting payments: status %s", billable.Status)
+			return
+		}
+		if err = validatePaidAt(billable, paidAt, timestamp); err != nil {
+			return
+		}
+		currency := billable.Amount.Currency
+		if in.Currency != "" && in.Currency != currency {
+			err = fmt.Errorf("bad input: %w: billable is in %s", ErrCurrencyMismatch, currency)
+			return
+		}
+
+		// retrieve what is left to pay on the schedule, late fees included
+		_, owed, err := b.owedOn(tx, bID, time.Time{})
+		if err != nil {
+			return
+		}
+
+		// validate amount against payment policy
+		remaining, nextAmount := 0, 0
+		for _, inst := range owed {
+			if nextAmount == 0 {
+				nextAmount = inst.Total()
+			}
+			remaining += inst.Total()
+		}
+		if nextAmount == 0 && !b.Conf.AllowOverpayment {
+			err = fmt.Errorf("billable already fully paid: id %s", bID)
+			return
+		}
+		if nextAmount > 0 {
+			switch b.Conf.PaymentPolicy {
+			case PaymentPolicyStrict, "":
+				if amount != nextAmount {
+					err = fmt.Errorf("wrong payment amount increment: expected %d", nextAmount)
+					return
+				}
+			case PaymentPolicyAtLeastOneInstallment:
+				if amount < nextAmount {
+					err = fmt.Errorf("payment amount too low: expected at least %d", nextAmount)
+					return
+				}
+			case PaymentPolicyAnyPositiveAmount:
+			}
+		}
+		if amount > remaining && !b.Conf.AllowOverpayment {
+			err = fmt.Errorf("payment exceeds outstanding amount: outstanding %d", remaining)
+			return
+		}
+
+		// allocate payment across installments oldest first, the components
+		// of each in the configured order
+		allocation, unallocated := allocate(owed, b.Conf.AllocationOrder, amount)
+
+		payment = withAllocation(Payment{
+			ID:                xid.New().String(),
+			BillableID:        bID,
+			Kind:              PaymentKindPayment,
+			Amount:            NewMoney(amount, currency),
+			AmountAccumulated: NewMoney(0, currency),
+			AmountUnallocated: NewMoney(unallocated, currency),
+			AmountRebated:     NewMoney(0, currency),
+			PaidAt:            paidAt,
+			CreatedAt:         timestamp,
+		}, allocation)
+
+		// save the new payment and settle the installments
+		if err = b.insertPayment(tx, payment); err != nil {
+			return
+		}
+		if payment, err = b.rebuildBillable(tx, payment, ""); err != nil {
+			return
+		}
+
+		if amount >= remaining {
+			status = BillableStatusPaidOff
+			_, err = b.transitionBillable(tx, bID, billable.Status, status, "fully paid")
+			return
+		}
+
+		// payments may cure arrears, the status changes along with the payment
+		status, err = b.resyncDelinquency(tx, bID)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	out = PaymentReceipt{Payment: payment, Status: status}
+	return
+}
+
+func (b *BillerEngine) GetPayoffQuote(bID string, asOf time.Time) (out PayoffQuote, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+	if asOf.IsZero() {
+		asOf = b.Conf.GenerateCurrentDate()
+	}
+
+	out, err = b.payoffQuoteOf(b.Conf.Store, bID, asOf)
+	return
+}
+
+func (b *BillerEngine) payoffQuoteOf(repo BillerRepository, bID string, asOf time.Time) (out PayoffQuote, err error) {
 	// retrieve billable
-	var billable Billable
-	err = b.Conf.Storage.QueryRow(
-		"SELECT amount, principal, dur_week FROM billables WHERE id = ?", bID).
-		Scan(&billable.Amount, &billable.Principal, &billable.DurWeek)
+	billable, err := repo.GetBillable(bID)
 	if err != nil {
 		err = fmt.Errorf("billable not found: id %s", bID)
 		return
 	}
+	if !billable.Status.IsOpen() {
+		err = fmt.Errorf("billable is closed: id %s", bID)
+		return
+	}
 
-	// validate amount
-	if amount != (billable.Amount / billable.DurWeek) {
-		err = fmt.Errorf("wrong payment amount increment: expected %d", billable.Amount/billable.DurWeek)
+	installments, owed, err := b.owedOn(repo, bID, time.Time{})
+	if err != nil {
 		return
 	}
 
-	// retrieve last payment aggregated amount
-	var amountPaid int
-	err = b.Conf.Storage.QueryRow("SELECT amount_accumulated FROM payments WHERE billable_id = ? ORDER BY id DESC, paid_at DESC", bID).Scan(&amountPaid)
-	if errors.Is(err, sql.ErrNoRows) {
-		amountPaid = 0
-		err = nil
+	out, err = b.computePayoffQuote(billable, installments, owed, asOf)
+	return
+}
+
+// computePayoffQuote prices closing the loan at asOf. Installments due by then
+// are owed in full, the interest left on later installments is rebated by the
+// configured percentage. Late fees are never rebated.
+func (b *BillerEngine) computePayoffQuote(billable Billable, installments []Installment, owed []Allocation, asOf time.Time) (out PayoffQuote, err error) {
+	remaining, feesDue, unearned := 0, 0, 0
+	for i, inst := range installments {
+		remaining += owed[i].Principal + owed[i].Interest
+		feesDue += owed[i].Fees + owed[i].Penalties
+		if inst.DueAt.After(asOf) {
+			unearned += owed[i].Interest
+		}
 	}
+	rebate, err := NewMoney(unearned, billable.Amount.Currency).MulRate(b.Conf.PayoffInterestRebatePercentage, RoundingDown)
 	if err != nil {
-		err = fmt.Errorf("failed getting latest payment: %w", err)
+		err = fmt.Errorf("failed to price rebate: %w", err)
+		return
+	}
+
+	out = PayoffQuote{
+		BillableID:     billable.ID,
+		AsOf:           asOf,
+		Outstanding:    NewMoney(remaining, rebate.Currency),
+		Fees:           NewMoney(feesDue, rebate.Currency),
+		InterestRebate: rebate,
+		PayoffAmount:   NewMoney(remaining+feesDue-rebate.Amount, rebate.Currency),
+		Status:         billable.Status,
+	}
+	return
+}
+
+func (b *BillerEngine) SettleBillable(bID string, in InputMakePayment) (out PaymentReceipt, err error) {
+	if in.IdempotencyKey == "" {
+		return b.settleBillable(bID, in)
+	}
+
+	key := in.IdempotencyKey
+	in.IdempotencyKey = ""
+	err = b.withIdempotency(key, idempotentRequest{Operation: "settle_billable", BillableID: bID, Input: in}, &out, func() (err error) {
+		out, err = b.settleBillable(bID, in)
+		return
+	})
+	return
+}
+
+func (b *BillerEngine) settleBillable(bID string, in InputMakePayment) (out PaymentReceipt, err error) {
+	// validate inputs
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
 		return
 	}
 
-	payment := Payment{
-		ID:                xid.New().String(),
-		BillableID:        bID,
-		Amount:            amount,
-		PaidAt:            paidAt,
-		CreatedAt:         timestamp,
-		AmountAccumulated: amountPaid + amount,
+	timestamp := b.Conf.GenerateCurrentDate()
+	if in.PaidAt.IsZero() {
+		in.PaidAt = timestamp
 	}
 
-	// save the new payment to the database
-	_, err = b.Conf.Storage.Exec(
-		"INSERT INTO payments (id, billable_id, amount, amount_accumulated, paid_at, created_at) VALUES (?, ?, ?, ?, ?, ?);",
-		payment.ID, payment.BillableID, payment.Amount, payment.AmountAccumulated, payment.PaidAt, payment.CreatedAt,
-	)
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	var payment Payment
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		billable, err := tx.GetBillable(bID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", bID)
+			return
+		}
+		if err = validatePaidAt(billable, in.PaidAt, timestamp); err != nil {
+			return
+		}
+		currency := billable.Amount.Currency
+		if in.Currency != "" && in.Currency != currency {
+			err = fmt.Errorf("bad input: %w: billable is in %s", ErrCurrencyMismatch, currency)
+			return
+		}
+
+		// price the payoff at the payment date
+		quote, err := b.payoffQuoteOf(tx, bID, in.PaidAt)
+		if err != nil {
+			return
+		}
+		if in.Amount != quote.PayoffAmount.Amount {
+			err = fmt.Errorf("wrong settlement amount: expected %d", quote.PayoffAmount.Amount)
+			return
+		}
+
+		// the settlement pays off everything left, less the waived interest
+		_, owed, err := b.owedOn(tx, bID, time.Time{})
+		if err != nil {
+			return
+		}
+		allocation := totalOwed(owed)
+		allocation.Interest -= quote.InterestRebate.Amount
+
+		payment = withAllocation(Payment{
+			ID:                xid.New().String(),
+			BillableID:        bID,
+			Kind:              PaymentKindPayment,
+			Amount:            NewMoney(in.Amount, currency),
+			AmountAccumulated: NewMoney(0, currency),
+			AmountUnallocated: NewMoney(0, currency),
+			AmountRebated:     quote.InterestRebate,
+			PaidAt:            in.PaidAt,
+			CreatedAt:         timestamp,
+		}, allocation)
+
+		// save the payment, settle every installment and close the billable
+		if err = b.insertPayment(tx, payment); err != nil {
+			return
+		}
+		if payment, err = b.rebuildBillable(tx, payment, ""); err != nil {
+			return
+		}
+		_, err = b.transitionBillable(tx, bID, billable.Status, BillableStatusPaidOff, "settled early")
+		return
+	})
 	if err != nil {
-		err = fmt.Errorf("failed to save payment: %w", err)
 		return
 	}
 
-	out = payment
+	out = PaymentReceipt{Payment: payment, Status: BillableStatusPaidOff}
+	return
+}
+
+// validatePaidAt checks a payment is dated within the life of the billable,
+// from its creation up to the current date.
+func validatePaidAt(billable Billable, paidAt, now time.Time) error {
+	if paidAt.Before(billable.CreatedAt) {
+		return fmt.Errorf("bad input: payment dated before the billable was created: %s", paidAt.Format(time.RFC3339))
+	}
+	if paidAt.After(now) {
+		return fmt.Errorf("bad input: payment dated in the future: %s", paidAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// allocatePayment spreads amount over unsettled installments oldest first. It
+// returns the installments that were touched and whatever could not be placed.
+func allocatePayment(installments []Installment, amount int) (touched []Installment, unallocated int) {
+	left := amount
+	for _, inst := range installments {
+		if left == 0 {
+			break
+		}
+		due := inst.AmountDue - inst.AmountPaid
+		if due <= 0 {
+			continue
+		}
+		portion := due
+		if left < due {
+			portion = left
+		}
+		inst.AmountPaid += portion
+		inst.Status = InstallmentStatusPartial
+		if inst.AmountPaid == inst.AmountDue {
+			inst.Status = InstallmentStatusPaid
+		}
+		touched = append(touched, inst)
+		left -= portion
+	}
+	unallocated = left
 	return
 }
 
 // ***
 
 type InputMakeBillable struct {
-	BID       string `validate:"required"`
-	Principal int    `validate:"required"`
+	BID        string   `validate:"required"`
+	BorrowerID string   `validate:"required"` // must not be delinquent on another billable
+	Principal  int      `validate:"required"` // in minor units of the currency
+	Currency   Currency // defaults to the engine default currency
+
+	// optional loan terms, engine defaults are used when omitted
+	Tenor                  int      `validate:"gte=0"` // number of installments, defaults to the loan duration at the frequency
+	DurationWeeks          int      `validate:"gte=0"` // loan duration used when tenor is omitted, defaults to the engine default
+	InterestRatePercentage *float64 `validate:"omitempty,gte=0"`
+	Frequency              InstallmentFrequency
+	InterestModel          InterestModelKind
+	Timezone               string // IANA name of the zone due dates fall in, defaults to the engine default timezone
+	GraceDays              *int   `validate:"omitempty,gte=0"` // defaults to the engine default grace days
+	GraceCutoff            string // HH:MM, defaults to the engine default grace cutoff
+	Product                string // loan product, billables without one follow the default delinquency policy
+
+	Pending bool // create without activating, e.g. while awaiting disbursement
+
+	IdempotencyKey string // replays with the same key return the original billable
 }
 
 type InputMakePayment struct {
-	Amount int       `validate:"required"`
-	PaidAt time.Time `validate:"required"`
+	Amount   int       `validate:"required,gt=0"` // in minor units of the billable currency
+	Currency Currency  // rejected unless it matches the billable, may be omitted
+	PaidAt   time.Time // defaults to the current date, must not precede the billable or be in the future
+
+	IdempotencyKey string // replays with the same key return the original payment
 }
 
 type OutstandingDetails struct {
-	Principal   int
-	Bill        int
-	Paid        int
-	Outstanding int
+	Principal   Money
+	Interest    Money
+	Fees        Money // late fees charged, owed on top of the bill
+	Bill        Money
+	Paid        Money
+	Rebated     Money
+	Outstanding Money // left to pay, less credit from overpayments
+
+	// left to pay per component
+	OutstandingPrincipal Money
+	OutstandingInterest  Money
+	OutstandingFees      Money
+	OutstandingPenalties Money
+
+	Status BillableStatus
+}
+
+// PaymentReceipt is a booked payment entry along with the status it left the
+// billable in.
+type PaymentReceipt struct {
+	Payment
+	Status BillableStatus
+}
+
+type PayoffQuote struct {
+	BillableID     string
+	AsOf           time.Time
+	Outstanding    Money
+	Fees           Money // late fees still owed
+	InterestRebate Money
+	PayoffAmount   Money
+	Status         BillableStatus
 }
 
 type DelinquencyDetails struct {
-	Delinquency bool
+	Delinquency        bool
+	MissedInstallments int
+	AmountInArrears    Money
+	DaysPastDue        int
+	FirstMissedDueAt   *time.Time
+	GraceEndsAt        *time.Time // end of the grace period of the oldest overdue installment
+	ExpectedPaidAmount Money
+	ActualPaidAmount   Money
+	Bucket             DelinquencyBucket
+	CollectionStage    string // decided by the active collection stage rule, empty when none is
+	Status             BillableStatus
 }
+
+type DelinquencyBucket string
+
+const (
+	DelinquencyBucketCurrent DelinquencyBucket = "current"
+	DelinquencyBucket1To30   DelinquencyBucket = "1-30"
+	DelinquencyBucket31To60  DelinquencyBucket = "31-60"
+	DelinquencyBucket61To90  DelinquencyBucket = "61-90"
+	DelinquencyBucketOver90  DelinquencyBucket = "90+"
+)
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"database/sql"
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -10,50 +11,30 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-const CreateTableQuery = `
-CREATE TABLE IF NOT EXISTS billables (
-    id VARCHAR(255) PRIMARY KEY,
-    amount INTEGER,
-    principal INTEGER,
-    dur_week INTEGER,
-    created_at DATETIME,
-    due_at DATETIME
-);
-
-CREATE TABLE IF NOT EXISTS payments (
-    id VARCHAR(255) PRIMARY KEY,
-    billable_id VARCHAR(255),
-    amount INTEGER,
-    amount_accumulated INTEGER,
-    paid_at DATETIME,
-    created_at DATETIME,
-    FOREIGN KEY (billable_id) REFERENCES billables(id)
-);
-`
-
-func setupTestDB() *sql.DB {
-	db, err := sql.Open("sqlite3", ":memory:")
-	if err != nil {
-		panic(err)
-	}
+const testBorrowerID = "test-borrower"
 
-	_, err = db.Exec(CreateTableQuery)
+func setupTestStore() *MemoryStore {
+	store := NewMemoryStore()
+	seedTestBorrower(store)
+	return store
+}
+
+// seedTestBorrower stores the borrower test billables are made for.
+func seedTestBorrower(store BillerRepository) {
+	err := store.InsertBorrower(Borrower{ID: testBorrowerID, Name: "Test Borrower", CreatedAt: time.Now(), UpdatedAt: time.Now()})
 	if err != nil {
 		panic(err)
 	}
-
-	return db
 }
 
 func TestNewBillerEngine(t *testing.T) {
 	t.Run("ok", func(t *testing.T) {
 		// arrange
-		db := setupTestDB()
-		defer db.Close()
+		store := setupTestStore()
 
 		// act
 		b, err := NewBillerEngine(BillerEngineConfig{
-			Storage:             db,
+			Store:               store,
 			GenerateCurrentDate: func() time.Time { return time.Now() },
 
 			DefaultLoanDurationWeeks:            50,
@@ -66,14 +47,32 @@ func TestNewBillerEngine(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("invalid_calendar", func(t *testing.T) {
+		for _, conf := range []BillerEngineConfig{
+			{DefaultTimezone: "Mars/Olympus_Mons"},
+			{BusinessDayConvention: "preceding"},
+		} {
+			// arrange
+			conf.Store = setupTestStore()
+			conf.GenerateCurrentDate = time.Now
+			conf.DefaultLoanDurationWeeks = 50
+			conf.DefaultInterestRatePercentage = .1
+			conf.PaymentSkipCountDeliquencyThreshold = 2
+
+			// act
+			b, err := NewBillerEngine(conf)
+
+			// assert
+			assert.Empty(t, b)
+			assert.Error(t, err)
+		}
+	})
+
 	t.Run("invalid_config", func(t *testing.T) {
 		// arrange
-		db := setupTestDB()
-		defer db.Close()
-
 		// act
 		b, err := NewBillerEngine(BillerEngineConfig{
-			// Storage:                        db,
+			// Store:                          store,
 			GenerateCurrentDate: func() time.Time { return time.Now() },
 
 			DefaultLoanDurationWeeks:            50,
@@ -88,16 +87,18 @@ func TestNewBillerEngine(t *testing.T) {
 }
 
 func TestBillerEngine_MakeBillable(t *testing.T) {
-	db := setupTestDB()
-	defer db.Close()
+	store := setupTestStore()
 
 	b, err := NewBillerEngine(BillerEngineConfig{
-		Storage:             db,
+		Store:               store,
 		GenerateCurrentDate: func() time.Time { return time.Now() },
 
 		DefaultLoanDurationWeeks:            50,
 		DefaultInterestRatePercentage:       .1,
 		PaymentSkipCountDeliquencyThreshold: 2,
+		MinLoanDurationWeeks:                4,
+		MaxLoanDurationWeeks:                104,
+		MaxInterestRatePercentage:           .5,
 	})
 	require.NoError(t, err)
 
@@ -107,20 +108,42 @@ func TestBillerEngine_MakeBillable(t *testing.T) {
 		// arrange
 		// act
 		out, err := b.MakeBillable(InputMakeBillable{
-			BID:       bid,
-			Principal: 5_000_000,
+			BID:        bid,
+			BorrowerID: testBorrowerID,
+			Principal:  5_000_000,
 		})
 
 		// assert
 		assert.NotEmpty(t, out)
 		assert.NoError(t, err)
 
-		var count int
-		query := "SELECT COUNT(*) FROM billables;"
-		err = db.QueryRow(query).Scan(&count)
+		stored, err := store.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, out, stored)
+		assert.Equal(t, NewMoney(5_500_000, CurrencyIDR), stored.Amount)
+		assert.Equal(t, NewMoney(5_000_000, CurrencyIDR), stored.Principal)
+		assert.Equal(t, "UTC", stored.Timezone)
+		assert.True(t, out.CreatedAt.AddDate(0, 0, 350).Equal(stored.DueAt)) // the last of 50 weekly installments
+	})
+
+	t.Run("currency", func(t *testing.T) {
+		// arrange
+		// act
+		out, err := b.MakeBillable(InputMakeBillable{
+			BID:        xid.New().String(),
+			BorrowerID: testBorrowerID,
+			Principal:  1_001,
+			Currency:   CurrencyJPY,
+		})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(1_001, CurrencyJPY), out.Principal)
+		assert.Equal(t, NewMoney(1_102, CurrencyJPY), out.Amount) // interest of 100.1 rounded up
 
+		stored, err := store.GetBillable(out.ID)
 		assert.NoError(t, err)
-		assert.Equal(t, 1, count)
+		assert.Equal(t, out, stored)
 	})
 
 	t.Run("invalid_input", func(t *testing.T) {
@@ -128,51 +151,750 @@ func TestBillerEngine_MakeBillable(t *testing.T) {
 		// act
 		out, err := b.MakeBillable(InputMakeBillable{
 			// BID:       bid,
-			Principal: 5_000_000,
+			BorrowerID: testBorrowerID,
+			Principal:  5_000_000,
 		})
 
 		// assert
 		assert.Empty(t, out)
 		assert.Error(t, err)
 
-		var count int
-		query := "SELECT COUNT(*) FROM billables;"
-		err = db.QueryRow(query).Scan(&count)
+		_, err = store.GetBillable("")
+		assert.ErrorIs(t, err, ErrStoreNotFound)
+	})
+
+	t.Run("custom_terms", func(t *testing.T) {
+		// arrange
+		rate := .2
 
+		// act
+		out, err := b.MakeBillable(InputMakeBillable{
+			BID:                    xid.New().String(),
+			BorrowerID:             testBorrowerID,
+			Principal:              1_000_000,
+			Tenor:                  10,
+			InterestRatePercentage: &rate,
+			Frequency:              FrequencyWeekly,
+		})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1_200_000, out.Amount.Amount)
+		assert.Equal(t, 10, out.Tenor)
+		assert.Equal(t, .2, out.InterestRate)
+		assert.Equal(t, FrequencyWeekly, out.Frequency)
+
+		stored, err := store.GetBillable(out.ID)
 		assert.NoError(t, err)
-		assert.Equal(t, 1, count)
+		assert.Equal(t, 10, stored.Tenor)
+		assert.Equal(t, .2, stored.InterestRate)
+		assert.Equal(t, FrequencyWeekly, stored.Frequency)
+	})
+
+	t.Run("interest_model", func(t *testing.T) {
+		// arrange
+		rate := .2
+
+		// act
+		out, err := b.MakeBillable(InputMakeBillable{
+			BID:                    xid.New().String(),
+			BorrowerID:             testBorrowerID,
+			Principal:              5_000_000,
+			InterestRatePercentage: &rate,
+			InterestModel:          InterestModelDecliningBalance,
+		})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, InterestModelDecliningBalance, out.InterestModel)
+		assert.Equal(t, NewMoney(504_321, CurrencyIDR), out.Interest)
+		assert.Equal(t, NewMoney(5_504_321, CurrencyIDR), out.Amount)
+		assert.InDelta(t, .2209, out.EffectiveRate, .0001)
+
+		schedule, err := b.GetSchedule(out.ID)
+		assert.NoError(t, err)
+		total, interest := 0, 0
+		for _, inst := range schedule {
+			total += inst.AmountDue
+			interest += inst.InterestDue
+		}
+		assert.Equal(t, out.Amount.Amount, total)
+		assert.Equal(t, out.Interest.Amount, interest)
+		assert.Greater(t, schedule[0].InterestDue, schedule[49].InterestDue)
+
+		stored, err := store.GetBillable(out.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, out, stored)
+	})
+
+	t.Run("frequency", func(t *testing.T) {
+		tests := []struct {
+			frequency InstallmentFrequency
+			tenor     int
+			weeks     int
+			want      int // installments
+		}{
+			{FrequencyDaily, 0, 0, 350},
+			{FrequencyWeekly, 0, 0, 50},
+			{FrequencyBiweekly, 0, 0, 25},
+			{FrequencyMonthly, 0, 0, 12},
+			{FrequencyMonthly, 6, 0, 6},
+			{FrequencyDaily, 0, 4, 28},
+			{FrequencyWeekly, 0, 10, 10},
+			{FrequencyBiweekly, 0, 26, 13},
+			{FrequencyMonthly, 0, 26, 6},
+			{FrequencyMonthly, 3, 26, 3},
+		}
+		for _, tt := range tests {
+			// act
+			out, err := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 5_000_000, Tenor: tt.tenor, DurationWeeks: tt.weeks, Frequency: tt.frequency})
+
+			// assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.frequency, out.Frequency)
+			assert.Equal(t, tt.want, out.Tenor)
+			assert.True(t, tt.frequency.DueAt(out.CreatedAt, tt.want).Equal(out.DueAt))
+			schedule, err := b.GetSchedule(out.ID)
+			assert.NoError(t, err)
+			require.Len(t, schedule, tt.want)
+			assert.Equal(t, out.DueAt, schedule[tt.want-1].DueAt)
+		}
+	})
+
+	t.Run("terms_out_of_bounds", func(t *testing.T) {
+		// arrange
+		rate := .9
+		inputs := []InputMakeBillable{
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Tenor: 2},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Tenor: 200},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Tenor: 25, Frequency: FrequencyMonthly},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Tenor: 20, Frequency: FrequencyDaily},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, InterestRatePercentage: &rate},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Frequency: "hourly"},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Currency: "XYZ"},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, InterestModel: "compound_hourly"},
+			{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_000, Timezone: "Mars/Olympus_Mons"},
+		}
+
+		for _, in := range inputs {
+			// act
+			out, err := b.MakeBillable(in)
+
+			// assert
+			assert.Empty(t, out)
+			assert.Error(t, err)
+		}
 	})
 
 	t.Run("duplicate_id", func(t *testing.T) {
 		// arrange
 		// act
 		out, err := b.MakeBillable(InputMakeBillable{
-			BID:       bid,
-			Principal: 5_000_000,
+			BID:        bid,
+			BorrowerID: testBorrowerID,
+			Principal:  5_000_000,
+		})
+
+		// assert
+		assert.Empty(t, out)
+		assert.Error(t, err)
+
+		stored, err := store.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, 5_500_000, stored.Amount.Amount)
+	})
+}
+
+func TestBillerEngine_GetSchedule(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now()
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return curdate },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+	})
+	require.NoError(t, err)
+
+	t.Run("ok", func(t *testing.T) {
+		// arrange
+		billable, err := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		out, err := b.GetSchedule(billable.ID)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Len(t, out, 50)
+		for i, inst := range out {
+			assert.Equal(t, i+1, inst.Seq)
+			assert.Equal(t, 110_000, inst.AmountDue)
+			assert.Equal(t, 0, inst.AmountPaid)
+			assert.Equal(t, InstallmentStatusUnpaid, inst.Status)
+			assert.True(t, inst.DueAt.Equal(curdate.AddDate(0, 0, 7*(i+1))))
+		}
+	})
+
+	t.Run("remainder_on_last_installment", func(t *testing.T) {
+		// arrange
+		billable, err := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 1_000_003, Tenor: 7})
+		require.NoError(t, err)
+
+		// act
+		out, err := b.GetSchedule(billable.ID)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Len(t, out, 7)
+
+		total := 0
+		for _, inst := range out {
+			total += inst.AmountDue
+		}
+		assert.Equal(t, billable.Amount.Amount, total)
+		assert.Equal(t, billable.Amount.Amount/7, out[0].AmountDue)
+		assert.Equal(t, billable.Amount.Amount/7+billable.Amount.Amount%7, out[6].AmountDue)
+	})
+
+	t.Run("not_found", func(t *testing.T) {
+		// act
+		out, err := b.GetSchedule("unknown")
+
+		// assert
+		assert.Empty(t, out)
+		assert.Error(t, err)
+	})
+}
+
+func TestBillerEngine_MakePayment(t *testing.T) {
+	newEngine := func(store BillerStore, policy PaymentPolicy, allowOverpayment bool) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               store,
+			GenerateCurrentDate: func() time.Time { return time.Now() },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			PaymentPolicy:                       policy,
+			AllowOverpayment:                    allowOverpayment,
 		})
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("strict_rejects_other_amounts", func(t *testing.T) {
+		// arrange
+		store := setupTestStore()
+		b := newEngine(store, PaymentPolicyStrict, false)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		_, errHalf := b.MakePayment(bid, InputMakePayment{Amount: 55_000, PaidAt: time.Now()})
+		_, errDouble := b.MakePayment(bid, InputMakePayment{Amount: 220_000, PaidAt: time.Now()})
+		_, errExact := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: time.Now()})
+
+		// assert
+		assert.Error(t, errHalf)
+		assert.Error(t, errDouble)
+		assert.NoError(t, errExact)
+	})
+
+	t.Run("at_least_one_installment", func(t *testing.T) {
+		// arrange
+		store := setupTestStore()
+		b := newEngine(store, PaymentPolicyAtLeastOneInstallment, false)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		_, errHalf := b.MakePayment(bid, InputMakePayment{Amount: 55_000, PaidAt: time.Now()})
+		payment, err := b.MakePayment(bid, InputMakePayment{Amount: 275_000, PaidAt: time.Now()})
+
+		// assert
+		assert.Error(t, errHalf)
+		assert.NoError(t, err)
+		assert.Equal(t, 275_000, payment.AmountAccumulated.Amount)
+
+		schedule, err := b.GetSchedule(bid)
+		require.NoError(t, err)
+		assert.Equal(t, InstallmentStatusPaid, schedule[0].Status)
+		assert.Equal(t, InstallmentStatusPaid, schedule[1].Status)
+		assert.Equal(t, InstallmentStatusPartial, schedule[2].Status)
+		assert.Equal(t, 55_000, schedule[2].AmountPaid)
+		assert.Equal(t, InstallmentStatusUnpaid, schedule[3].Status)
+
+		// remainder of a partial installment is accepted as the next installment
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 55_000, PaidAt: time.Now()})
+		assert.NoError(t, err)
+	})
+
+	t.Run("any_positive_amount", func(t *testing.T) {
+		// arrange
+		store := setupTestStore()
+		b := newEngine(store, PaymentPolicyAnyPositiveAmount, false)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		_, errZero := b.MakePayment(bid, InputMakePayment{Amount: -1, PaidAt: time.Now()})
+		_, errHalf := b.MakePayment(bid, InputMakePayment{Amount: 55_000, PaidAt: time.Now()})
+		_, errOver := b.MakePayment(bid, InputMakePayment{Amount: 5_500_000, PaidAt: time.Now()})
+		payment, errPayoff := b.MakePayment(bid, InputMakePayment{Amount: 5_445_000, PaidAt: time.Now()})
+		_, errAfter := b.MakePayment(bid, InputMakePayment{Amount: 1, PaidAt: time.Now()})
+
+		// assert
+		assert.Error(t, errZero)
+		assert.NoError(t, errHalf)
+		assert.Error(t, errOver)
+		assert.NoError(t, errPayoff)
+		assert.Equal(t, 5_500_000, payment.AmountAccumulated.Amount)
+		assert.Equal(t, BillableStatusPaidOff, payment.Status)
+		assert.Error(t, errAfter)
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, outstanding.Outstanding.Amount)
+
+		schedule, err := b.GetSchedule(bid)
+		require.NoError(t, err)
+		for _, inst := range schedule {
+			assert.Equal(t, InstallmentStatusPaid, inst.Status)
+		}
+	})
+
+	t.Run("overpayment_allowed", func(t *testing.T) {
+		// arrange
+		store := setupTestStore()
+		b := newEngine(store, PaymentPolicyAnyPositiveAmount, true)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		payment, err := b.MakePayment(bid, InputMakePayment{Amount: 5_600_000, PaidAt: time.Now()})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 100_000, payment.AmountUnallocated.Amount)
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, -100_000, outstanding.Outstanding.Amount)
+	})
+
+	t.Run("currency_mismatch", func(t *testing.T) {
+		// arrange
+		store := setupTestStore()
+		b := newEngine(store, PaymentPolicyStrict, false)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000, Currency: CurrencyUSD})
+		require.NoError(t, err)
+
+		// act
+		_, errOther := b.MakePayment(bid, InputMakePayment{Amount: 110_000, Currency: CurrencyEUR, PaidAt: time.Now()})
+		payment, errSame := b.MakePayment(bid, InputMakePayment{Amount: 110_000, Currency: CurrencyUSD, PaidAt: time.Now()})
+		_, errSettle := b.SettleBillable(bid, InputMakePayment{Amount: 110_000, Currency: CurrencyEUR, PaidAt: time.Now()})
+
+		// assert
+		assert.ErrorIs(t, errOther, ErrCurrencyMismatch)
+		assert.NoError(t, errSame)
+		assert.Equal(t, NewMoney(110_000, CurrencyUSD), payment.Amount)
+		assert.Error(t, errSettle)
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, NewMoney(5_390_000, CurrencyUSD), outstanding.Outstanding)
+	})
+}
+
+func TestKeyedMutex(t *testing.T) {
+	t.Run("exclusive_per_key", func(t *testing.T) {
+		// arrange
+		var locks keyedMutex
+		counts := map[string]int{}
+		var wg sync.WaitGroup
+
+		// act
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				unlock := locks.Lock(key)
+				defer unlock()
+				counts[key]++
+			}(fmt.Sprintf("key-%d", i%2))
+		}
+		wg.Wait()
+
+		// assert
+		assert.Equal(t, map[string]int{"key-0": 50, "key-1": 50}, counts)
+	})
+
+	t.Run("released_keys_are_dropped", func(t *testing.T) {
+		// arrange
+		var locks keyedMutex
+		unlockA := locks.Lock("a")
+		waited := make(chan struct{})
+		go func() {
+			unlock := locks.Lock("a")
+			unlock()
+			close(waited)
+		}()
+
+		// act
+		unlockB := locks.Lock("b")
+		unlockB()
+		sizeHeld := locks.size()
+		unlockA()
+		<-waited
+
+		// assert
+		assert.Equal(t, 1, sizeHeld)
+		assert.Zero(t, locks.size())
+	})
+}
+
+func TestBillerEngine_PayoffAndSettle(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now()
+	getDate := func() time.Time { return curdate }
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return getDate() },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+		PayoffInterestRebatePercentage:      1,
+	})
+	require.NoError(t, err)
+
+	bid := xid.New().String()
+	_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+	require.NoError(t, err)
+
+	t.Run("quote", func(t *testing.T) {
+		// act
+		out, err := b.GetPayoffQuote(bid, curdate.AddDate(0, 0, 14))
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 5_500_000, out.Outstanding.Amount)
+		assert.Equal(t, 480_000, out.InterestRebate.Amount)
+		assert.Equal(t, 5_020_000, out.PayoffAmount.Amount)
+		assert.Equal(t, BillableStatusActive, out.Status)
+	})
+
+	t.Run("quote_defaults_to_current_date", func(t *testing.T) {
+		// act
+		out, err := b.GetPayoffQuote(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.True(t, out.AsOf.Equal(curdate))
+		assert.Equal(t, 500_000, out.InterestRebate.Amount)
+	})
+
+	t.Run("quote_follows_interest_model", func(t *testing.T) {
+		// arrange
+		rate := .2
+		billable, err := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 5_000_000, InterestRatePercentage: &rate, InterestModel: InterestModelSimpleDaily})
+		require.NoError(t, err)
+		schedule, err := b.GetSchedule(billable.ID)
+		require.NoError(t, err)
+
+		// act
+		out, err := b.GetPayoffQuote(billable.ID, curdate.AddDate(0, 0, 14))
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, billable.Amount.Amount, out.Outstanding.Amount)
+		assert.Equal(t, billable.Interest.Amount-schedule[0].InterestDue-schedule[1].InterestDue, out.InterestRebate.Amount)
+	})
+
+	t.Run("wrong_amount", func(t *testing.T) {
+		orig := getDate
+		defer func() { getDate = orig }()
+		getDate = func() time.Time { return curdate.AddDate(0, 0, 14) }
+
+		// act
+		out, err := b.SettleBillable(bid, InputMakePayment{Amount: 5_000_000, PaidAt: curdate.AddDate(0, 0, 14)})
 
 		// assert
 		assert.Empty(t, out)
 		assert.Error(t, err)
+	})
+
+	t.Run("paid_at_out_of_range", func(t *testing.T) {
+		// act
+		_, errBefore := b.SettleBillable(bid, InputMakePayment{Amount: 5_500_000, PaidAt: curdate.AddDate(0, 0, -1)})
+		_, errAfter := b.SettleBillable(bid, InputMakePayment{Amount: 5_020_000, PaidAt: curdate.AddDate(0, 0, 14)})
+		_, errPayment := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate.AddDate(0, 0, 7)})
+
+		// assert
+		assert.ErrorContains(t, errBefore, "before the billable was created")
+		assert.ErrorContains(t, errAfter, "in the future")
+		assert.ErrorContains(t, errPayment, "in the future")
+	})
+
+	t.Run("settle", func(t *testing.T) {
+		orig := getDate
+		defer func() { getDate = orig }()
+		getDate = func() time.Time { return curdate.AddDate(0, 0, 14) }
+		in := InputMakePayment{Amount: 5_020_000, PaidAt: curdate.AddDate(0, 0, 14), IdempotencyKey: xid.New().String()}
+
+		// act
+		out, err := b.SettleBillable(bid, in)
+		replayed, errReplay := b.SettleBillable(bid, in)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 5_020_000, out.AmountAccumulated.Amount)
+		assert.Equal(t, 480_000, out.AmountRebated.Amount)
+		assert.Equal(t, BillableStatusPaidOff, out.Status)
+		assert.NoError(t, errReplay)
+		assert.Equal(t, out.ID, replayed.ID)
+		assert.Equal(t, out.Status, replayed.Status)
+
+		outstanding, err := b.GetOutstanding(bid, curdate.AddDate(0, 0, 14))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, outstanding.Outstanding.Amount)
+
+		stored, err := store.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusPaidOff, stored.Status)
+	})
+
+	t.Run("closed_billable", func(t *testing.T) {
+		orig := getDate
+		defer func() { getDate = orig }()
+		getDate = func() time.Time { return curdate.AddDate(0, 0, 100) }
+
+		_, err := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: getDate()})
+		assert.Error(t, err)
+
+		_, err = b.GetPayoffQuote(bid, getDate())
+		assert.Error(t, err)
+
+		delinquency, err := b.IsDelinquent(bid, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, false, delinquency.Delinquency)
+	})
+}
+
+func TestBillerEngine_IsDelinquent(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now().UTC()
+	getDate := func() time.Time { return curdate }
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return getDate() },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+	})
+	require.NoError(t, err)
+
+	bid := xid.New().String()
+	_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+	require.NoError(t, err)
+
+	t.Run("current", func(t *testing.T) {
+		// act
+		out, err := b.IsDelinquent(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, false, out.Delinquency)
+		assert.Equal(t, 0, out.MissedInstallments)
+		assert.Equal(t, 0, out.AmountInArrears.Amount)
+		assert.Equal(t, 0, out.DaysPastDue)
+		assert.Nil(t, out.FirstMissedDueAt)
+		assert.Equal(t, DelinquencyBucketCurrent, out.Bucket)
+	})
+
+	t.Run("missed_installments", func(t *testing.T) {
+		orig := getDate
+		defer func() { getDate = orig }()
+		getDate = func() time.Time { return curdate.AddDate(0, 0, 45) }
+
+		// act
+		out, err := b.IsDelinquent(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, true, out.Delinquency)
+		assert.Equal(t, 6, out.MissedInstallments)
+		assert.Equal(t, 660_000, out.AmountInArrears.Amount)
+		assert.Equal(t, 38, out.DaysPastDue)
+		assert.True(t, out.FirstMissedDueAt.Equal(curdate.AddDate(0, 0, 7)))
+		assert.Equal(t, 660_000, out.ExpectedPaidAmount.Amount)
+		assert.Equal(t, 0, out.ActualPaidAmount.Amount)
+		assert.Equal(t, DelinquencyBucket31To60, out.Bucket)
+	})
+
+	t.Run("daily", func(t *testing.T) {
+		// arrange
+		rate := .05
+		dailyID := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: dailyID, BorrowerID: testBorrowerID, Principal: 1_000_000, Tenor: 50, InterestRatePercentage: &rate, Frequency: FrequencyDaily})
+		require.NoError(t, err)
+		orig := getDate
+		getDate = func() time.Time { return curdate.AddDate(0, 0, 1) }
+		_, err = b.MakePayment(dailyID, InputMakePayment{Amount: 21_000, PaidAt: curdate.AddDate(0, 0, 1)})
+		getDate = orig
+		require.NoError(t, err)
+
+		// act
+		atTwoDays, err := b.IsDelinquent(dailyID, curdate.AddDate(0, 0, 2))
+		assert.NoError(t, err)
+		atThreeDays, err := b.IsDelinquent(dailyID, curdate.AddDate(0, 0, 3))
+		assert.NoError(t, err)
+
+		// assert
+		assert.Equal(t, false, atTwoDays.Delinquency)
+		assert.Equal(t, 1, atTwoDays.MissedInstallments)
+		assert.Equal(t, 42_000, atTwoDays.ExpectedPaidAmount.Amount)
+		assert.Equal(t, true, atThreeDays.Delinquency)
+		assert.Equal(t, 2, atThreeDays.MissedInstallments)
+		assert.Equal(t, 1, atThreeDays.DaysPastDue)
+	})
+}
 
-		var count int
-		query := "SELECT COUNT(*) FROM billables;"
-		err = db.QueryRow(query).Scan(&count)
+func TestBillerEngine_AsOf(t *testing.T) {
+	store := setupTestStore()
 
+	curdate := time.Now().UTC()
+	getDate := func() time.Time { return curdate }
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return getDate() },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+	})
+	require.NoError(t, err)
+
+	bid := xid.New().String()
+	_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+	require.NoError(t, err)
+
+	getDate = func() time.Time { return curdate.AddDate(0, 0, 70) }
+	for _, day := range []int{7, 14, 42} {
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate.AddDate(0, 0, day)})
+		require.NoError(t, err)
+	}
+
+	t.Run("outstanding", func(t *testing.T) {
+		// act
+		past, errPast := b.GetOutstanding(bid, curdate.AddDate(0, 0, 20))
+		now, errNow := b.GetOutstanding(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, errPast)
+		assert.Equal(t, 220_000, past.Paid.Amount)
+		assert.Equal(t, 5_280_000, past.Outstanding.Amount)
+		assert.NoError(t, errNow)
+		assert.Equal(t, 330_000, now.Paid.Amount)
+		assert.Equal(t, 5_170_000, now.Outstanding.Amount)
+	})
+
+	t.Run("delinquency", func(t *testing.T) {
+		// act
+		atTwoWeeks, err := b.IsDelinquent(bid, curdate.AddDate(0, 0, 14))
 		assert.NoError(t, err)
-		assert.Equal(t, 1, count)
+		atFiveWeeks, err := b.IsDelinquent(bid, curdate.AddDate(0, 0, 35))
+		assert.NoError(t, err)
+		atSixWeeks, err := b.IsDelinquent(bid, curdate.AddDate(0, 0, 42))
+		assert.NoError(t, err)
+
+		// assert
+		assert.Equal(t, false, atTwoWeeks.Delinquency)
+		assert.Equal(t, 0, atTwoWeeks.MissedInstallments)
+		assert.Equal(t, true, atFiveWeeks.Delinquency)
+		assert.Equal(t, 3, atFiveWeeks.MissedInstallments)
+		assert.Equal(t, 14, atFiveWeeks.DaysPastDue)
+		assert.Equal(t, true, atSixWeeks.Delinquency)
+		assert.Equal(t, 3, atSixWeeks.MissedInstallments)
+		assert.Equal(t, 330_000, atSixWeeks.ActualPaidAmount.Amount)
+	})
+
+	t.Run("before_creation", func(t *testing.T) {
+		// act
+		_, errOutstanding := b.GetOutstanding(bid, curdate.AddDate(0, 0, -1))
+		_, errDelinquency := b.IsDelinquent(bid, curdate.AddDate(0, 0, -1))
+
+		// assert
+		assert.Error(t, errOutstanding)
+		assert.Error(t, errDelinquency)
 	})
 }
 
+func TestDelinquencyBucketOf(t *testing.T) {
+	tests := []struct {
+		daysPastDue int
+		missedCount int
+		want        DelinquencyBucket
+	}{
+		{0, 0, DelinquencyBucketCurrent},
+		{0, 1, DelinquencyBucket1To30},
+		{30, 1, DelinquencyBucket1To30},
+		{31, 5, DelinquencyBucket31To60},
+		{60, 9, DelinquencyBucket31To60},
+		{61, 9, DelinquencyBucket61To90},
+		{90, 13, DelinquencyBucket61To90},
+		{91, 13, DelinquencyBucketOver90},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, delinquencyBucketOf(tt.daysPastDue, tt.missedCount))
+	}
+}
+
+func TestInstallmentFrequency_DueAt(t *testing.T) {
+	jan31 := time.Date(2024, 1, 31, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		frequency InstallmentFrequency
+		start     time.Time
+		seq       int
+		want      time.Time
+	}{
+		{FrequencyDaily, jan31, 1, time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{FrequencyWeekly, jan31, 2, time.Date(2024, 2, 14, 9, 30, 0, 0, time.UTC)},
+		{FrequencyBiweekly, jan31, 2, time.Date(2024, 2, 28, 9, 30, 0, 0, time.UTC)},
+		{FrequencyMonthly, jan31, 1, time.Date(2024, 2, 29, 9, 30, 0, 0, time.UTC)},
+		{FrequencyMonthly, jan31, 2, time.Date(2024, 3, 31, 9, 30, 0, 0, time.UTC)},
+		{FrequencyMonthly, jan31, 3, time.Date(2024, 4, 30, 9, 30, 0, 0, time.UTC)},
+		{FrequencyMonthly, jan31, 13, time.Date(2025, 2, 28, 9, 30, 0, 0, time.UTC)},
+		{FrequencyMonthly, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), 12, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.frequency.DueAt(tt.start, tt.seq), "%s #%d", tt.frequency, tt.seq)
+	}
+}
+
 func TestBillerEngine_Flows(t *testing.T) {
-	db := setupTestDB()
-	defer db.Close()
+	testBillerEngineFlows(t, setupTestStore())
+}
 
+// testBillerEngineFlows walks a billable through its life on the given store.
+func testBillerEngineFlows(t *testing.T, store BillerStore) {
 	curdate := time.Now()
 	getDate := func() time.Time { return curdate }
 	bid := xid.New().String()
 	eng, err := NewBillerEngine(BillerEngineConfig{
-		Storage:             db,
+		Store:               store,
 		GenerateCurrentDate: func() time.Time { return getDate() },
 
 		DefaultLoanDurationWeeks:            50,
@@ -182,15 +904,15 @@ func TestBillerEngine_Flows(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("initial_billable_state_okay", func(t *testing.T) {
-		_, err := eng.MakeBillable(InputMakeBillable{BID: bid, Principal: 5_000_000})
+		_, err := eng.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
 		assert.NoError(t, err)
 
-		outstanding, err := eng.GetOutstanding(bid)
+		outstanding, err := eng.GetOutstanding(bid, time.Time{})
 		assert.NoError(t, err)
-		assert.Equal(t, 5_000_000, outstanding.Principal)
-		assert.Equal(t, 5_500_000, outstanding.Bill)
+		assert.Equal(t, 5_000_000, outstanding.Principal.Amount)
+		assert.Equal(t, 5_500_000, outstanding.Bill.Amount)
 
-		delinquency, err := eng.IsDelinquent(bid)
+		delinquency, err := eng.IsDelinquent(bid, time.Time{})
 		assert.NoError(t, err)
 		assert.Equal(t, false, delinquency.Delinquency)
 	})
@@ -200,7 +922,7 @@ func TestBillerEngine_Flows(t *testing.T) {
 		defer func() { getDate = orig }()
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 14) }
-		delinquency, err := eng.IsDelinquent(bid)
+		delinquency, err := eng.IsDelinquent(bid, time.Time{})
 		assert.NoError(t, err)
 		assert.Equal(t, true, delinquency.Delinquency)
 	})
@@ -212,45 +934,238 @@ func TestBillerEngine_Flows(t *testing.T) {
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 14) }
 		payment, err := eng.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: getDate()})
 		assert.NoError(t, err)
-		assert.Equal(t, 110_000, payment.Amount)
-		assert.Equal(t, 110_000, payment.AmountAccumulated)
+		assert.Equal(t, 110_000, payment.Amount.Amount)
+		assert.Equal(t, 110_000, payment.AmountAccumulated.Amount)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 14) }
-		delinquency, err := eng.IsDelinquent(bid)
+		delinquency, err := eng.IsDelinquent(bid, time.Time{})
 		assert.NoError(t, err)
 		assert.Equal(t, false, delinquency.Delinquency)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 28) }
-		delinquency, err = eng.IsDelinquent(bid)
+		delinquency, err = eng.IsDelinquent(bid, time.Time{})
 		assert.NoError(t, err)
 		assert.Equal(t, true, delinquency.Delinquency)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 35) }
-		delinquency, err = eng.IsDelinquent(bid)
+		delinquency, err = eng.IsDelinquent(bid, time.Time{})
 		assert.NoError(t, err)
 		assert.Equal(t, true, delinquency.Delinquency)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 35) }
 		payment, err = eng.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: getDate()})
 		assert.NoError(t, err)
-		assert.Equal(t, 110_000, payment.Amount)
-		assert.Equal(t, 220_000, payment.AmountAccumulated)
+		assert.Equal(t, 110_000, payment.Amount.Amount)
+		assert.Equal(t, 220_000, payment.AmountAccumulated.Amount)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 35) }
 		payment, err = eng.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: getDate()})
 		assert.NoError(t, err)
-		assert.Equal(t, 110_000, payment.Amount)
-		assert.Equal(t, 330_000, payment.AmountAccumulated)
+		assert.Equal(t, 110_000, payment.Amount.Amount)
+		assert.Equal(t, 330_000, payment.AmountAccumulated.Amount)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 35) }
 		payment, err = eng.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: getDate()})
 		assert.NoError(t, err)
-		assert.Equal(t, 110_000, payment.Amount)
-		assert.Equal(t, 440_000, payment.AmountAccumulated)
+		assert.Equal(t, 110_000, payment.Amount.Amount)
+		assert.Equal(t, 440_000, payment.AmountAccumulated.Amount)
 
 		getDate = func() time.Time { return curdate.AddDate(0, 0, 35) }
-		delinquency, err = eng.IsDelinquent(bid)
+		delinquency, err = eng.IsDelinquent(bid, time.Time{})
 		assert.NoError(t, err)
 		assert.Equal(t, false, delinquency.Delinquency)
+
+		schedule, err := eng.GetSchedule(bid)
+		assert.NoError(t, err)
+		for _, inst := range schedule[:4] {
+			assert.Equal(t, InstallmentStatusPaid, inst.Status)
+			assert.Equal(t, inst.AmountDue, inst.AmountPaid)
+		}
+		assert.Equal(t, InstallmentStatusUnpaid, schedule[4].Status)
+	})
+	t.Run("concurrent_payments", func(t *testing.T) {
+		testBillerEngineConcurrentPayments(t, store)
+	})
+}
+
+// testBillerEngineConcurrentPayments hammers a billable with concurrent writes
+// on the given store and checks the ledger stays consistent.
+func testBillerEngineConcurrentPayments(t *testing.T, store BillerStore) {
+	newEngine := func(policy PaymentPolicy) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               store,
+			GenerateCurrentDate: func() time.Time { return time.Now() },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			PaymentPolicy:                       policy,
+			IdempotencyKeyTTL:                   time.Hour,
+		})
+		require.NoError(t, err)
+		return b
+	}
+
+	// hammer runs fn from n goroutines at once and collects their errors
+	hammer := func(n int, fn func(i int) error) (errs []error) {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		start := make(chan struct{})
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				err := fn(i)
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		return
+	}
+
+	// assertLedger checks that running totals follow ledger order and that the
+	// schedule matches the total paid
+	assertLedger := func(t *testing.T, b *BillerEngine, bid string) (total int) {
+		payments, err := b.GetPayments(bid)
+		require.NoError(t, err)
+		for _, p := range payments {
+			total += p.Amount.Amount
+			assert.Equal(t, total, p.AmountAccumulated.Amount, "payment %s", p.ID)
+		}
+
+		schedule, err := b.GetSchedule(bid)
+		require.NoError(t, err)
+		allocated := 0
+		for _, inst := range schedule {
+			assert.LessOrEqual(t, inst.AmountPaid, inst.AmountDue, "installment %d", inst.Seq)
+			allocated += inst.AmountPaid
+		}
+		assert.Equal(t, total, allocated)
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, total, outstanding.Paid.Amount)
+		assert.Zero(t, b.billableLocks.size(), "locks left behind")
+		return
+	}
+
+	t.Run("strict_installments", func(t *testing.T) {
+		// arrange
+		b := newEngine(PaymentPolicyStrict)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		errs := hammer(50, func(int) error {
+			_, err := b.MakePayment(bid, InputMakePayment{Amount: 110_000})
+			return err
+		})
+
+		// assert
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 5_500_000, assertLedger(t, b, bid))
+
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusPaidOff, billable.Status)
+	})
+
+	t.Run("no_overpayment", func(t *testing.T) {
+		// arrange
+		b := newEngine(PaymentPolicyAnyPositiveAmount)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		errs := hammer(80, func(i int) error {
+			_, err := b.MakePayment(bid, InputMakePayment{Amount: 70_000 + 10_000*(i%5)})
+			return err
+		})
+
+		// assert
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+			}
+		}
+		assert.Less(t, succeeded, 80)
+		total := assertLedger(t, b, bid)
+		assert.LessOrEqual(t, total, 5_500_000)
+
+		transitions, err := b.GetBillableTransitions(bid)
+		require.NoError(t, err)
+		paidOff := 0
+		for _, tr := range transitions {
+			if tr.ToStatus == BillableStatusPaidOff {
+				paidOff++
+			}
+		}
+		if total == 5_500_000 {
+			assert.Equal(t, 1, paidOff)
+		} else {
+			assert.Equal(t, 0, paidOff)
+		}
+	})
+
+	t.Run("same_idempotency_key", func(t *testing.T) {
+		// arrange
+		b := newEngine(PaymentPolicyStrict)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		in := InputMakePayment{Amount: 110_000, PaidAt: time.Now(), IdempotencyKey: xid.New().String()}
+
+		// act
+		errs := hammer(20, func(int) error {
+			_, err := b.MakePayment(bid, in)
+			return err
+		})
+
+		// assert
+		for _, err := range errs {
+			if err != nil {
+				assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+			}
+		}
+		assert.Equal(t, 110_000, assertLedger(t, b, bid))
+	})
+
+	t.Run("mixed_with_reversals", func(t *testing.T) {
+		// arrange
+		b := newEngine(PaymentPolicyAnyPositiveAmount)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		var seeded []Payment
+		for i := 0; i < 10; i++ {
+			p, err := b.MakePayment(bid, InputMakePayment{Amount: 55_000})
+			require.NoError(t, err)
+			seeded = append(seeded, p.Payment)
+		}
+
+		// act
+		errs := hammer(40, func(i int) (err error) {
+			if i < len(seeded) {
+				_, err = b.ReversePayment(seeded[i].ID, InputReversePayment{Reason: "bounced"})
+				return
+			}
+			_, err = b.MakePayment(bid, InputMakePayment{Amount: 55_000})
+			return
+		})
+
+		// assert
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 30*55_000, assertLedger(t, b, bid))
 	})
 }
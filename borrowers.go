@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	validator "github.com/avrebarra/minivalidator"
+)
+
+var ErrBorrowerDelinquent = errors.New("borrower is delinquent")
+
+func (b *BillerEngine) CreateBorrower(in InputCreateBorrower) (out Borrower, err error) {
+	// validate inputs
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	timestamp := b.Conf.GenerateCurrentDate()
+	out = Borrower{
+		ID:        in.ID,
+		Name:      in.Name,
+		CreatedAt: timestamp,
+		UpdatedAt: timestamp,
+	}
+	if err = b.Conf.Store.InsertBorrower(out); err != nil {
+		err = fmt.Errorf("failed to save borrower: %w", err)
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) GetBorrower(borrowerID string) (out Borrower, err error) {
+	// validate required inputs
+	if borrowerID == "" {
+		err = fmt.Errorf("bad input: borrower id not defined")
+		return
+	}
+
+	out, err = b.Conf.Store.GetBorrower(borrowerID)
+	if err != nil {
+		err = fmt.Errorf("borrower not found: id %s", borrowerID)
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) GetBorrowers() (out []Borrower, err error) {
+	out, err = b.Conf.Store.ListBorrowers()
+	if err != nil {
+		err = fmt.Errorf("error fetching borrowers: %w", err)
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) UpdateBorrower(borrowerID string, in InputUpdateBorrower) (out Borrower, err error) {
+	// validate inputs
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		out, err = tx.GetBorrower(borrowerID)
+		if err != nil {
+			err = fmt.Errorf("borrower not found: id %s", borrowerID)
+			return
+		}
+
+		out.Name, out.UpdatedAt = in.Name, b.Conf.GenerateCurrentDate()
+		if err = tx.UpdateBorrower(out); err != nil {
+			err = fmt.Errorf("failed to update borrower: %w", err)
+			return
+		}
+		return
+	})
+	return
+}
+
+// DeleteBorrower removes a borrower that has no billables.
+func (b *BillerEngine) DeleteBorrower(borrowerID string) (err error) {
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		if _, err = tx.GetBorrower(borrowerID); err != nil {
+			err = fmt.Errorf("borrower not found: id %s", borrowerID)
+			return
+		}
+
+		billables, err := tx.ListBorrowerBillables(borrowerID)
+		if err != nil {
+			err = fmt.Errorf("error fetching billables: %w", err)
+			return
+		}
+		if len(billables) > 0 {
+			err = fmt.Errorf("borrower has billables: id %s", borrowerID)
+			return
+		}
+
+		if err = tx.DeleteBorrower(borrowerID); err != nil {
+			err = fmt.Errorf("failed to delete borrower: %w", err)
+			return
+		}
+		return
+	})
+	return
+}
+
+// GetBorrowerExposure sums up the open billables of the borrower as of the
+// current date, by currency, and finds the one furthest past due.
+func (b *BillerEngine) GetBorrowerExposure(borrowerID string) (out BorrowerExposure, err error) {
+	if _, err = b.GetBorrower(borrowerID); err != nil {
+		return
+	}
+
+	out, err = b.exposureOf(b.Conf.Store, borrowerID, b.Conf.GenerateCurrentDate())
+	return
+}
+
+// exposureOf sums up the open billables of the borrower as of the date,
+// reading through the given repository.
+func (b *BillerEngine) exposureOf(repo BillerRepository, borrowerID string, asOf time.Time) (out BorrowerExposure, err error) {
+	billables, err := repo.ListBorrowerBillables(borrowerID)
+	if err != nil {
+		err = fmt.Errorf("error fetching billables: %w", err)
+		return
+	}
+
+	totals := map[Currency]*ExposureTotal{}
+	out.BorrowerID = borrowerID
+	out.Billables = len(billables)
+	out.WorstBucket = DelinquencyBucketCurrent
+	for _, billable := range billables {
+		if !billable.Status.IsOpen() {
+			continue
+		}
+		out.OpenBillables++
+
+		outstanding, errOutstanding := b.outstandingOf(repo, billable.ID, asOf)
+		if errOutstanding != nil {
+			err = fmt.Errorf("failed to compute outstanding of billable %s: %w", billable.ID, errOutstanding)
+			return
+		}
+		details, errDelinquency := b.evaluateDelinquency(repo, billable.ID, asOf)
+		if errDelinquency != nil {
+			err = fmt.Errorf("failed to evaluate delinquency of billable %s: %w", billable.ID, errDelinquency)
+			return
+		}
+
+		currency := billable.Principal.Currency
+		if totals[currency] == nil {
+			zero := NewMoney(0, currency)
+			totals[currency] = &ExposureTotal{Currency: currency, Principal: zero, Outstanding: zero, AmountInArrears: zero}
+		}
+		totals[currency].Principal.Amount += billable.Principal.Amount
+		totals[currency].Outstanding.Amount += outstanding.Outstanding.Amount
+		totals[currency].AmountInArrears.Amount += details.AmountInArrears.Amount
+
+		out.Delinquent = out.Delinquent || details.Delinquency
+		if details.DaysPastDue > out.WorstDaysPastDue || (out.WorstBillableID == "" && details.MissedInstallments > 0) {
+			out.WorstDaysPastDue = details.DaysPastDue
+			out.WorstBucket = details.Bucket
+			out.WorstBillableID = billable.ID
+		}
+	}
+
+	for _, total := range totals {
+		out.Totals = append(out.Totals, *total)
+	}
+	sort.Slice(out.Totals, func(i, j int) bool { return out.Totals[i].Currency < out.Totals[j].Currency })
+	return
+}
+
+// ***
+
+type InputCreateBorrower struct {
+	ID   string `validate:"required"`
+	Name string `validate:"required"`
+}
+
+type InputUpdateBorrower struct {
+	Name string `validate:"required"`
+}
+
+type BorrowerExposure struct {
+	BorrowerID       string
+	Billables        int             // every billable of the borrower
+	OpenBillables    int             // active or delinquent ones, the ones the rest sums up
+	Totals           []ExposureTotal // by currency
+	Delinquent       bool            // whether any open billable is delinquent
+	WorstDaysPastDue int
+	WorstBucket      DelinquencyBucket
+	WorstBillableID  string // billable furthest past due, empty when none has missed installments
+}
+
+type ExposureTotal struct {
+	Currency        Currency
+	Principal       Money
+	Outstanding     Money
+	AmountInArrears Money
+}
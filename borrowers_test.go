@@ -0,0 +1,202 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_Borrowers(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // installments of 110_000 due every Monday from Feb 12
+	now := curdate
+	newEngine := func() *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 1,
+			PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+		})
+		require.NoError(t, err)
+		return b
+	}
+	newBorrower := func(t *testing.T, b *BillerEngine) string {
+		borrowerID := xid.New().String()
+		_, err := b.CreateBorrower(InputCreateBorrower{ID: borrowerID, Name: "Borrower " + borrowerID})
+		require.NoError(t, err)
+		return borrowerID
+	}
+
+	t.Run("crud", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+
+		// act
+		created, errCreate := b.CreateBorrower(InputCreateBorrower{ID: "ani", Name: "Ani"})
+		_, errDuplicate := b.CreateBorrower(InputCreateBorrower{ID: "ani", Name: "Ani"})
+		_, errNoName := b.CreateBorrower(InputCreateBorrower{ID: "budi"})
+		now = curdate.AddDate(0, 0, 1)
+		updated, errUpdate := b.UpdateBorrower("ani", InputUpdateBorrower{Name: "Ani Wijaya"})
+		_, errUpdateMissing := b.UpdateBorrower("unknown", InputUpdateBorrower{Name: "Budi"})
+		stored, errGet := b.GetBorrower("ani")
+		borrowers, errList := b.GetBorrowers()
+		errDelete := b.DeleteBorrower("ani")
+		_, errGetDeleted := b.GetBorrower("ani")
+		errDeleteMissing := b.DeleteBorrower("ani")
+
+		// assert
+		assert.NoError(t, errCreate)
+		assert.Equal(t, "Ani", created.Name)
+		assert.Error(t, errDuplicate)
+		assert.Error(t, errNoName)
+		assert.NoError(t, errUpdate)
+		assert.Equal(t, "Ani Wijaya", updated.Name)
+		assert.Equal(t, curdate, updated.CreatedAt)
+		assert.Equal(t, now, updated.UpdatedAt)
+		assert.Error(t, errUpdateMissing)
+		assert.NoError(t, errGet)
+		assert.Equal(t, updated, stored)
+		assert.NoError(t, errList)
+		assert.Len(t, borrowers, 2) // along with the test borrower
+		assert.NoError(t, errDelete)
+		assert.Error(t, errGetDeleted)
+		assert.Error(t, errDeleteMissing)
+	})
+
+	t.Run("exposure", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		borrowerID := newBorrower(t, b)
+		behindID, paidOffID, usdID := xid.New().String(), xid.New().String(), xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: behindID, BorrowerID: borrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		_, err = b.MakeBillable(InputMakeBillable{BID: paidOffID, BorrowerID: borrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		_, err = b.MakePayment(paidOffID, InputMakePayment{Amount: 5_500_000, PaidAt: curdate})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 6)
+		_, err = b.MakeBillable(InputMakeBillable{BID: usdID, BorrowerID: borrowerID, Principal: 5_000_000, Currency: CurrencyUSD})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 8)
+
+		// act
+		exposure, err := b.GetBorrowerExposure(borrowerID)
+		_, errMissing := b.GetBorrowerExposure("unknown")
+
+		// assert
+		assert.NoError(t, err)
+		assert.Error(t, errMissing)
+		assert.Equal(t, borrowerID, exposure.BorrowerID)
+		assert.Equal(t, 3, exposure.Billables)
+		assert.Equal(t, 2, exposure.OpenBillables)
+		assert.Equal(t, []ExposureTotal{
+			{
+				Currency:        CurrencyIDR,
+				Principal:       NewMoney(5_000_000, CurrencyIDR),
+				Outstanding:     NewMoney(5_500_000, CurrencyIDR),
+				AmountInArrears: NewMoney(110_000, CurrencyIDR),
+			},
+			{
+				Currency:        CurrencyUSD,
+				Principal:       NewMoney(5_000_000, CurrencyUSD),
+				Outstanding:     NewMoney(5_500_000, CurrencyUSD),
+				AmountInArrears: NewMoney(0, CurrencyUSD),
+			},
+		}, exposure.Totals)
+		assert.Equal(t, true, exposure.Delinquent)
+		assert.Equal(t, 1, exposure.WorstDaysPastDue)
+		assert.Equal(t, DelinquencyBucket1To30, exposure.WorstBucket)
+		assert.Equal(t, behindID, exposure.WorstBillableID)
+	})
+
+	t.Run("blocks_delinquent_borrowers", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		borrowerID, otherID := newBorrower(t, b), newBorrower(t, b)
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: borrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 8)
+
+		// act
+		_, errBlocked := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: borrowerID, Principal: 1_000_000})
+		_, errOther := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: otherID, Principal: 1_000_000})
+		_, errPayment := b.MakePayment(bid, InputMakePayment{Amount: 110_000})
+		_, errCured := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: borrowerID, Principal: 1_000_000})
+
+		// assert
+		assert.ErrorIs(t, errBlocked, ErrBorrowerDelinquent)
+		assert.NoError(t, errOther)
+		assert.NoError(t, errPayment)
+		assert.NoError(t, errCured)
+	})
+
+	t.Run("concurrent_loans", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		borrowerID := newBorrower(t, b)
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+
+		// act
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: borrowerID, Principal: 1_000_000})
+			}(i)
+		}
+		wg.Wait()
+		exposure, err := b.GetBorrowerExposure(borrowerID)
+
+		// assert
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, 10, exposure.OpenBillables)
+		assert.Zero(t, b.borrowerLocks.size())
+	})
+
+	t.Run("requires_borrower", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+
+		// act
+		_, errMissing := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), Principal: 5_000_000})
+		_, errUnknown := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: "unknown", Principal: 5_000_000})
+
+		// assert
+		assert.Error(t, errMissing)
+		assert.Error(t, errUnknown)
+		assert.NotErrorIs(t, errUnknown, ErrBorrowerDelinquent)
+	})
+
+	t.Run("delete_with_billables", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		borrowerID := newBorrower(t, b)
+		_, err := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: borrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		errDelete := b.DeleteBorrower(borrowerID)
+		_, errGet := b.GetBorrower(borrowerID)
+
+		// assert
+		assert.Error(t, errDelete)
+		assert.NoError(t, errGet)
+	})
+}
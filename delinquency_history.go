@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rs/xid"
+)
+
+// GetDelinquencyHistory lists the episodes the billable spent delinquent,
+// oldest first. Episodes ended with an active status are cures.
+func (b *BillerEngine) GetDelinquencyHistory(bID string) (out []DelinquencyEpisode, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	if _, err = b.Conf.Store.GetBillable(bID); err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+
+	out, err = b.Conf.Store.ListDelinquencyEpisodes(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching delinquency episodes: %w", err)
+		return
+	}
+	return
+}
+
+// trackDelinquencyEpisode opens an episode when the transition enters
+// delinquency and closes the open one when it leaves it. An episode starts
+// when the grace period of the first missed installment ended, not when the
+// evaluation noticed it.
+func (b *BillerEngine) trackDelinquencyEpisode(tx BillerRepository, t BillableTransition) (err error) {
+	switch {
+	case t.ToStatus == BillableStatusDelinquent:
+		var details DelinquencyDetails
+		if _, _, details, _, err = b.arrearsAsOf(tx, t.BillableID, t.CreatedAt); err != nil {
+			return
+		}
+		startedAt := t.CreatedAt
+		if details.FirstMissedDueAt != nil && details.GraceEndsAt != nil {
+			startedAt = *details.GraceEndsAt
+		}
+
+		episode := DelinquencyEpisode{
+			ID:         xid.New().String(),
+			BillableID: t.BillableID,
+			StartedAt:  startedAt,
+		}
+		if err = tx.InsertDelinquencyEpisode(episode); err != nil {
+			err = fmt.Errorf("failed to record delinquency episode: %w", err)
+			return
+		}
+
+	case t.FromStatus == BillableStatusDelinquent:
+		var episode DelinquencyEpisode
+		var ok bool
+		if episode, ok, err = openEpisodeOf(tx, t.BillableID); err != nil || !ok {
+			return
+		}
+		endedAt := t.CreatedAt
+		episode.EndedAt = &endedAt
+		episode.EndStatus = t.ToStatus
+		if err = tx.UpdateDelinquencyEpisode(episode); err != nil {
+			err = fmt.Errorf("failed to close delinquency episode: %w", err)
+			return
+		}
+	}
+	return
+}
+
+// recordDelinquencyPeak raises the maxima of the open episode of the billable
+// to the arrears of the evaluation when they are worse.
+func (b *BillerEngine) recordDelinquencyPeak(tx BillerRepository, bID string, details DelinquencyDetails) (err error) {
+	episode, ok, err := openEpisodeOf(tx, bID)
+	if err != nil || !ok {
+		return
+	}
+	if details.DaysPastDue <= episode.MaxDaysPastDue && details.AmountInArrears.Amount <= episode.MaxArrears {
+		return
+	}
+
+	if details.DaysPastDue > episode.MaxDaysPastDue {
+		episode.MaxDaysPastDue = details.DaysPastDue
+	}
+	if details.AmountInArrears.Amount > episode.MaxArrears {
+		episode.MaxArrears = details.AmountInArrears.Amount
+	}
+	if err = tx.UpdateDelinquencyEpisode(episode); err != nil {
+		err = fmt.Errorf("failed to update delinquency episode: %w", err)
+		return
+	}
+	return
+}
+
+func openEpisodeOf(tx BillerRepository, bID string) (out DelinquencyEpisode, ok bool, err error) {
+	episodes, err := tx.ListDelinquencyEpisodes(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching delinquency episodes: %w", err)
+		return
+	}
+	for i := len(episodes) - 1; i >= 0; i-- {
+		if episodes[i].EndedAt == nil {
+			return episodes[i], true, nil
+		}
+	}
+	return
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_GetDelinquencyHistory(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // installments due every Monday from Feb 12
+	now := curdate
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               setupTestStore(),
+		GenerateCurrentDate: func() time.Time { return now },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 1,
+		PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+	})
+	require.NoError(t, err)
+
+	// arrange
+	bid := xid.New().String()
+	_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+	require.NoError(t, err)
+
+	// act
+	now = curdate.AddDate(0, 0, 8)
+	_, errFirstMiss := b.IsDelinquent(bid, time.Time{})
+	now = curdate.AddDate(0, 0, 15)
+	_, errSecondMiss := b.IsDelinquent(bid, time.Time{})
+	_, errCure := b.MakePayment(bid, InputMakePayment{Amount: 220_000})
+	curedAt := now
+	now = curdate.AddDate(0, 0, 22)
+	_, errRelapse := b.IsDelinquent(bid, time.Time{})
+	quote, errQuote := b.GetPayoffQuote(bid, time.Time{})
+	_, errSettle := b.SettleBillable(bid, InputMakePayment{Amount: quote.PayoffAmount.Amount})
+	history, err := b.GetDelinquencyHistory(bid)
+	_, errMissing := b.GetDelinquencyHistory("unknown")
+
+	// assert
+	assert.NoError(t, errFirstMiss)
+	assert.NoError(t, errSecondMiss)
+	assert.NoError(t, errCure)
+	assert.NoError(t, errRelapse)
+	assert.NoError(t, errQuote)
+	assert.NoError(t, errSettle)
+	assert.NoError(t, err)
+	assert.Error(t, errMissing)
+	require.Len(t, history, 2)
+
+	cured := history[0]
+	assert.True(t, curdate.AddDate(0, 0, 7).Equal(cured.StartedAt)) // grace of the first installment ended on its due date
+	require.NotNil(t, cured.EndedAt)
+	assert.True(t, curedAt.Equal(*cured.EndedAt))
+	assert.Equal(t, BillableStatusActive, cured.EndStatus)
+	assert.Equal(t, 8, cured.MaxDaysPastDue)
+	assert.Equal(t, 220_000, cured.MaxArrears)
+
+	settled := history[1]
+	assert.True(t, curdate.AddDate(0, 0, 21).Equal(settled.StartedAt)) // the third installment was missed after the cure
+	require.NotNil(t, settled.EndedAt)
+	assert.True(t, now.Equal(*settled.EndedAt))
+	assert.Equal(t, BillableStatusPaidOff, settled.EndStatus)
+	assert.Equal(t, 1, settled.MaxDaysPastDue)
+	assert.Equal(t, 110_000, settled.MaxArrears)
+}
+
+func TestBillerEngine_DelinquencyEpisodeStart(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // installments due every Monday from Feb 12
+	now := curdate
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               setupTestStore(),
+		GenerateCurrentDate: func() time.Time { return now },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		DefaultGraceDays:                    3,
+		PaymentSkipCountDeliquencyThreshold: 1,
+	})
+	require.NoError(t, err)
+
+	// arrange
+	bid := xid.New().String()
+	_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+	require.NoError(t, err)
+
+	// act
+	now = curdate.AddDate(0, 0, 12) // noticed two days after the grace period ended
+	_, errEvaluate := b.IsDelinquent(bid, time.Time{})
+	history, err := b.GetDelinquencyHistory(bid)
+
+	// assert
+	assert.NoError(t, errEvaluate)
+	assert.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.True(t, curdate.AddDate(0, 0, 10).Equal(history[0].StartedAt))
+	assert.Nil(t, history[0].EndedAt)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+
+	validator "github.com/avrebarra/minivalidator"
+)
+
+// DelinquencySnapshot is the state of a billable schedule at an evaluation
+// date, as judged by delinquency policies. Installments still within their
+// grace period are not missed yet.
+type DelinquencySnapshot struct {
+	Product            string
+	Principal          int
+	InstallmentAmount  int // amount due on the first installment
+	MissedInstallments int
+	ConsecutiveMissed  int // installments missed in a row up to the latest one past its grace period
+	AmountInArrears    int
+	DaysPastDue        int // days since the oldest missed installment was due
+}
+
+// DelinquencyPolicy decides when a billable is delinquent. The engine picks
+// the policy of the loan product of each billable.
+type DelinquencyPolicy interface {
+	IsDelinquent(s DelinquencySnapshot) bool
+	Validate() error
+}
+
+// ConsecutiveMissedPolicy marks billables delinquent once Count installments
+// in a row are missed.
+type ConsecutiveMissedPolicy struct {
+	Count int `validate:"gt=0"`
+}
+
+func (p ConsecutiveMissedPolicy) IsDelinquent(s DelinquencySnapshot) bool {
+	return s.ConsecutiveMissed >= p.Count
+}
+
+func (p ConsecutiveMissedPolicy) Validate() error {
+	return validator.Validate(p)
+}
+
+// ArrearsPolicy marks billables delinquent once their arrears reach Amount,
+// or Installments times the installment amount when no amount is set.
+type ArrearsPolicy struct {
+	Amount       int `validate:"gte=0"` // in minor units of the billable currency
+	Installments int `validate:"gte=0"`
+}
+
+func (p ArrearsPolicy) IsDelinquent(s DelinquencySnapshot) bool {
+	threshold := p.Amount
+	if threshold == 0 {
+		threshold = p.Installments * s.InstallmentAmount
+	}
+	return s.AmountInArrears > 0 && s.AmountInArrears >= threshold
+}
+
+func (p ArrearsPolicy) Validate() (err error) {
+	if err = validator.Validate(p); err != nil {
+		return
+	}
+	if (p.Amount == 0) == (p.Installments == 0) {
+		return fmt.Errorf("arrears policy needs either an amount or installments")
+	}
+	return
+}
+
+// DaysPastDuePolicy marks billables delinquent once their oldest missed
+// installment is Days past due.
+type DaysPastDuePolicy struct {
+	Days int `validate:"gt=0"`
+}
+
+func (p DaysPastDuePolicy) IsDelinquent(s DelinquencySnapshot) bool {
+	return s.MissedInstallments > 0 && s.DaysPastDue >= p.Days
+}
+
+func (p DaysPastDuePolicy) Validate() error {
+	return validator.Validate(p)
+}
+
+type CompositeOperator string
+
+const (
+	CompositeAll CompositeOperator = "all" // delinquent when every policy says so
+	CompositeAny CompositeOperator = "any" // delinquent when one of the policies says so
+)
+
+// CompositePolicy combines other policies with AND or OR.
+type CompositePolicy struct {
+	Operator CompositeOperator
+	Policies []DelinquencyPolicy
+}
+
+func (p CompositePolicy) IsDelinquent(s DelinquencySnapshot) bool {
+	for _, policy := range p.Policies {
+		delinquent := policy.IsDelinquent(s)
+		if p.Operator == CompositeAny && delinquent {
+			return true
+		}
+		if p.Operator == CompositeAll && !delinquent {
+			return false
+		}
+	}
+	return p.Operator == CompositeAll
+}
+
+func (p CompositePolicy) Validate() (err error) {
+	if p.Operator != CompositeAll && p.Operator != CompositeAny {
+		return fmt.Errorf("unsupported composite operator %s", p.Operator)
+	}
+	if len(p.Policies) == 0 {
+		return fmt.Errorf("composite policy has no policies")
+	}
+	for _, policy := range p.Policies {
+		if err = validateDelinquencyPolicy(policy); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func validateDelinquencyPolicy(policy DelinquencyPolicy) error {
+	if policy == nil {
+		return fmt.Errorf("delinquency policy not defined")
+	}
+	return policy.Validate()
+}
+
+// isDelinquent decides delinquency by the active delinquency rule, or by the
+// policy of the billable when no rule is active.
+func (b *BillerEngine) isDelinquent(repo BillerRepository, billable Billable, s DelinquencySnapshot) (out bool, err error) {
+	rule, ok, err := activeRuleOf(repo, RuleKindDelinquency)
+	if err != nil {
+		return
+	}
+	if !ok {
+		out = b.delinquencyPolicyOf(billable).IsDelinquent(s)
+		return
+	}
+
+	value, err := rule.eval(ruleValuesOf(s))
+	if err != nil {
+		err = fmt.Errorf("failed to evaluate delinquency rule: %w", err)
+		return
+	}
+	out = value.(bool)
+	return
+}
+
+// delinquencyPolicyOf returns the policy of the loan product of the billable,
+// falling back to the engine default.
+func (b *BillerEngine) delinquencyPolicyOf(billable Billable) DelinquencyPolicy {
+	if policy, ok := b.Conf.ProductDelinquencyPolicies[billable.Product]; ok {
+		return policy
+	}
+	return b.Conf.DelinquencyPolicy
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_DelinquencyPolicy(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // installments of 110_000 due every Monday from Feb 12
+	now := curdate
+	newEngine := func(policy DelinquencyPolicy, products map[string]DelinquencyPolicy) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 1,
+			DelinquencyPolicy:                   policy,
+			ProductDelinquencyPolicies:          products,
+		})
+		require.NoError(t, err)
+		return b
+	}
+	type check struct {
+		day  int // days after curdate
+		want bool
+	}
+
+	tests := []struct {
+		name   string
+		policy DelinquencyPolicy
+		checks []check
+	}{
+		{"default_policy", nil, []check{{6, false}, {8, true}}},
+		{"consecutive_missed", ConsecutiveMissedPolicy{Count: 2}, []check{{8, false}, {15, true}}},
+		{"arrears_amount", ArrearsPolicy{Amount: 150_000}, []check{{8, false}, {15, true}}},
+		{"arrears_installments", ArrearsPolicy{Installments: 3}, []check{{15, false}, {22, true}}},
+		{"days_past_due", DaysPastDuePolicy{Days: 10}, []check{{15, false}, {17, true}}},
+		{"composite_all", CompositePolicy{Operator: CompositeAll, Policies: []DelinquencyPolicy{
+			ConsecutiveMissedPolicy{Count: 1},
+			DaysPastDuePolicy{Days: 5},
+		}}, []check{{8, false}, {12, true}}},
+		{"composite_any", CompositePolicy{Operator: CompositeAny, Policies: []DelinquencyPolicy{
+			ArrearsPolicy{Amount: 300_000},
+			DaysPastDuePolicy{Days: 20},
+		}}, []check{{15, false}, {22, true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// arrange
+			b := newEngine(tt.policy, nil)
+			bid := xid.New().String()
+			now = curdate
+			_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+			require.NoError(t, err)
+
+			for _, c := range tt.checks {
+				// act
+				now = curdate.AddDate(0, 0, c.day)
+				out, err := b.IsDelinquent(bid, time.Time{})
+
+				// assert
+				assert.NoError(t, err)
+				assert.Equal(t, c.want, out.Delinquency, "day %d", c.day)
+			}
+		})
+	}
+
+	t.Run("per_product", func(t *testing.T) {
+		// arrange
+		b := newEngine(nil, map[string]DelinquencyPolicy{"paylater": DaysPastDuePolicy{Days: 10}})
+		defaultID, paylaterID := xid.New().String(), xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: defaultID, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		_, err = b.MakeBillable(InputMakeBillable{BID: paylaterID, BorrowerID: testBorrowerID, Principal: 5_000_000, Product: "paylater"})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 8)
+
+		// act
+		defaultOut, errDefault := b.IsDelinquent(defaultID, time.Time{})
+		paylaterOut, errPaylater := b.IsDelinquent(paylaterID, time.Time{})
+
+		// assert
+		assert.NoError(t, errDefault)
+		assert.Equal(t, true, defaultOut.Delinquency)
+		assert.Equal(t, BillableStatusDelinquent, defaultOut.Status)
+		assert.NoError(t, errPaylater)
+		assert.Equal(t, false, paylaterOut.Delinquency)
+		assert.Equal(t, BillableStatusActive, paylaterOut.Status)
+	})
+
+	t.Run("cured_by_payment", func(t *testing.T) {
+		// arrange
+		b := newEngine(ConsecutiveMissedPolicy{Count: 2}, nil)
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 15)
+		_, err = b.IsDelinquent(bid, time.Time{})
+		require.NoError(t, err)
+
+		// act
+		_, errPay := b.MakePayment(bid, InputMakePayment{Amount: 110_000})
+		out, err := b.IsDelinquent(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, errPay)
+		assert.NoError(t, err)
+		assert.Equal(t, false, out.Delinquency)
+		assert.Equal(t, 1, out.MissedInstallments)
+		assert.Equal(t, BillableStatusActive, out.Status)
+	})
+
+	t.Run("bad_policies", func(t *testing.T) {
+		for _, policy := range []DelinquencyPolicy{
+			ConsecutiveMissedPolicy{},
+			ArrearsPolicy{},
+			ArrearsPolicy{Amount: 100_000, Installments: 1},
+			DaysPastDuePolicy{Days: -1},
+			CompositePolicy{Operator: "xor", Policies: []DelinquencyPolicy{DaysPastDuePolicy{Days: 30}}},
+			CompositePolicy{Operator: CompositeAll},
+			CompositePolicy{Operator: CompositeAny, Policies: []DelinquencyPolicy{nil}},
+		} {
+			// act
+			_, errDefault := NewBillerEngine(BillerEngineConfig{
+				Store:                               setupTestStore(),
+				GenerateCurrentDate:                 time.Now,
+				DefaultLoanDurationWeeks:            50,
+				DefaultInterestRatePercentage:       .1,
+				PaymentSkipCountDeliquencyThreshold: 1,
+				DelinquencyPolicy:                   policy,
+			})
+			_, errProduct := NewBillerEngine(BillerEngineConfig{
+				Store:                               setupTestStore(),
+				GenerateCurrentDate:                 time.Now,
+				DefaultLoanDurationWeeks:            50,
+				DefaultInterestRatePercentage:       .1,
+				PaymentSkipCountDeliquencyThreshold: 1,
+				ProductDelinquencyPolicies:          map[string]DelinquencyPolicy{"paylater": policy},
+			})
+
+			// assert
+			assert.Error(t, errDefault, "%#v", policy)
+			assert.Error(t, errProduct, "%#v", policy)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// BusinessDayConvention tells how due dates falling on weekends or holidays
+// are moved to a business day.
+type BusinessDayConvention string
+
+const (
+	BusinessDayUnadjusted        BusinessDayConvention = "unadjusted"         // due dates stay where they fall
+	BusinessDayFollowing         BusinessDayConvention = "following"          // the next business day
+	BusinessDayModifiedFollowing BusinessDayConvention = "modified_following" // the next business day, unless it is in the next month, then the previous one
+)
+
+func (c BusinessDayConvention) IsSupported() bool {
+	switch c {
+	case BusinessDayUnadjusted, BusinessDayFollowing, BusinessDayModifiedFollowing:
+		return true
+	}
+	return false
+}
+
+// DueDateCalculator produces the dates of a billable. Dates follow the wall
+// clock of the billable timezone, so installments stay at the same local time
+// across DST changes, and are then moved off non-business days following the
+// convention.
+type DueDateCalculator struct {
+	Convention BusinessDayConvention // defaults to unadjusted when empty
+	Holidays   *HolidayCalendar
+}
+
+// DueDates returns the due date of each installment of the billable, from
+// its creation date, frequency, tenor and timezone.
+func (c DueDateCalculator) DueDates(billable Billable) (out []time.Time, err error) {
+	loc, err := time.LoadLocation(billable.Timezone)
+	if err != nil {
+		err = fmt.Errorf("unknown timezone: %s", billable.Timezone)
+		return
+	}
+
+	start := billable.CreatedAt.In(loc)
+	for seq := 1; seq <= billable.Tenor; seq++ {
+		out = append(out, c.Adjust(billable.Frequency.DueAt(start, seq)))
+	}
+	return
+}
+
+// Adjust moves the date to a business day following the convention, keeping
+// its local time.
+func (c DueDateCalculator) Adjust(date time.Time) time.Time {
+	switch c.Convention {
+	case BusinessDayFollowing:
+		return c.following(date)
+	case BusinessDayModifiedFollowing:
+		out := c.following(date)
+		if out.Month() != date.Month() {
+			out = c.preceding(date)
+		}
+		return out
+	default:
+		return date
+	}
+}
+
+// IsBusinessDay tells whether the calendar date of the given time, in its own
+// location, is neither a weekend nor a holiday.
+func (c DueDateCalculator) IsBusinessDay(date time.Time) bool {
+	switch date.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return !c.Holidays.IsHoliday(date)
+}
+
+// HolidayGraceEnd returns when an installment due at dueAt becomes late. A
+// due date on a holiday holds until the end of the next business day, also
+// for holidays added after the schedule was laid out.
+func (c DueDateCalculator) HolidayGraceEnd(dueAt time.Time) time.Time {
+	if !c.Holidays.IsHoliday(dueAt) {
+		return dueAt
+	}
+	year, month, day := c.following(dueAt).Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, dueAt.Location())
+}
+
+func (c DueDateCalculator) following(date time.Time) time.Time {
+	for !c.IsBusinessDay(date) {
+		date = date.AddDate(0, 0, 1)
+	}
+	return date
+}
+
+func (c DueDateCalculator) preceding(date time.Time) time.Time {
+	for !c.IsBusinessDay(date) {
+		date = date.AddDate(0, 0, -1)
+	}
+	return date
+}
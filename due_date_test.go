@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dueDatesOf lays out the unadjusted due dates of a billable.
+func dueDatesOf(t *testing.T, billable Billable) []time.Time {
+	out, err := DueDateCalculator{}.DueDates(billable)
+	require.NoError(t, err)
+	return out
+}
+
+func TestDueDateCalculator(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	holidays := NewHolidayCalendar(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC))
+	monthEnd := Billable{
+		CreatedAt: time.Date(2024, 1, 31, 3, 0, 0, 0, time.UTC),
+		Frequency: FrequencyMonthly,
+		Tenor:     3,
+		Timezone:  "Asia/Jakarta",
+	}
+	dateOf := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 0, 0, 0, jakarta)
+	}
+
+	t.Run("conventions", func(t *testing.T) {
+		tests := []struct {
+			convention BusinessDayConvention
+			want       []time.Time
+		}{
+			{BusinessDayUnadjusted, []time.Time{dateOf(2024, 2, 29), dateOf(2024, 3, 31), dateOf(2024, 4, 30)}},
+			{BusinessDayFollowing, []time.Time{dateOf(2024, 3, 1), dateOf(2024, 4, 1), dateOf(2024, 4, 30)}},
+			{BusinessDayModifiedFollowing, []time.Time{dateOf(2024, 2, 28), dateOf(2024, 3, 29), dateOf(2024, 4, 30)}},
+		}
+		for _, tt := range tests {
+			// act
+			out, err := DueDateCalculator{Convention: tt.convention, Holidays: holidays}.DueDates(monthEnd)
+
+			// assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out, tt.convention)
+		}
+	})
+
+	t.Run("dst", func(t *testing.T) {
+		// arrange
+		newYork, err := time.LoadLocation("America/New_York")
+		require.NoError(t, err)
+		billable := Billable{
+			CreatedAt: time.Date(2024, 3, 1, 14, 0, 0, 0, time.UTC), // 9 am EST, DST starts on Mar 10
+			Frequency: FrequencyWeekly,
+			Tenor:     2,
+			Timezone:  "America/New_York",
+		}
+
+		// act
+		out, err := DueDateCalculator{}.DueDates(billable)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []time.Time{
+			time.Date(2024, 3, 8, 9, 0, 0, 0, newYork),
+			time.Date(2024, 3, 15, 9, 0, 0, 0, newYork),
+		}, out)
+		assert.Equal(t, 13*time.Hour, out[1].UTC().Sub(out[1].UTC().Truncate(24*time.Hour)))
+	})
+
+	t.Run("unknown_timezone", func(t *testing.T) {
+		// arrange
+		billable := monthEnd
+		billable.Timezone = "Mars/Olympus_Mons"
+
+		// act
+		out, err := DueDateCalculator{}.DueDates(billable)
+
+		// assert
+		assert.Empty(t, out)
+		assert.Error(t, err)
+	})
+
+	t.Run("engine", func(t *testing.T) {
+		// arrange
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return monthEnd.CreatedAt },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			DefaultTimezone:                     "Asia/Jakarta",
+			BusinessDayConvention:               BusinessDayModifiedFollowing,
+			Holidays:                            holidays,
+		})
+		require.NoError(t, err)
+
+		// act
+		out, err := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 3_000_000, Frequency: FrequencyMonthly, Tenor: 3})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, "Asia/Jakarta", out.Timezone)
+		assert.True(t, dateOf(2024, 4, 30).Equal(out.DueAt))
+		schedule, err := b.GetSchedule(out.ID)
+		assert.NoError(t, err)
+		require.Len(t, schedule, 3)
+		assert.True(t, dateOf(2024, 2, 28).Equal(schedule[0].DueAt))
+		assert.True(t, dateOf(2024, 3, 29).Equal(schedule[1].DueAt))
+	})
+}
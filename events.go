@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+var ErrEventChainBroken = errors.New("event chain broken")
+
+func (b *BillerEngine) GetEvents(bID string) (out []BillableEvent, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	out, err = b.Conf.Store.ListEvents(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching events: %w", err)
+		return
+	}
+	if len(out) == 0 {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+	return
+}
+
+// VerifyEvents recomputes the hash chain of a billable's history and fails
+// with ErrEventChainBroken at the first event that does not match.
+func (b *BillerEngine) VerifyEvents(bID string) (err error) {
+	events, err := b.GetEvents(bID)
+	if err != nil {
+		return
+	}
+	err = verifyEventChain(events)
+	return
+}
+
+// RebuildProjections regenerates billables, schedules, payments, fees and
+// status history of every billable from its events and returns how many were
+// rebuilt. Billables stored before events were get their history recorded first.
+func (b *BillerEngine) RebuildProjections() (out int, err error) {
+	if _, err = b.BackfillEvents(); err != nil {
+		return
+	}
+
+	bIDs, err := b.Conf.Store.ListEventStreams()
+	if err != nil {
+		err = fmt.Errorf("error fetching event streams: %w", err)
+		return
+	}
+
+	for _, bID := range bIDs {
+		if err = b.RebuildProjection(bID); err != nil {
+			err = fmt.Errorf("failed to rebuild billable %s: %w", bID, err)
+			return
+		}
+		out++
+	}
+	return
+}
+
+// RebuildProjection drops the stored state of a billable and replays its
+// events over it, refusing to do so when the history was tampered with.
+func (b *BillerEngine) RebuildProjection(bID string) (err error) {
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		events, err := tx.ListEvents(bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching events: %w", err)
+			return
+		}
+		if len(events) == 0 || events[0].Type != EventBillableCreated {
+			err = fmt.Errorf("billable history incomplete: id %s", bID)
+			return
+		}
+		if err = verifyEventChain(events); err != nil {
+			return
+		}
+
+		if err = tx.DeleteProjections(bID); err != nil {
+			err = fmt.Errorf("failed to drop projections: %w", err)
+			return
+		}
+		err = b.replayEvents(tx, events)
+		return
+	})
+	return
+}
+
+// BackfillEvents records the history of billables stored before events were,
+// from their stored state, and returns how many it recorded. Their events
+// are recorded as of now, the payloads keep the original dates.
+func (b *BillerEngine) BackfillEvents() (out int, err error) {
+	bIDs, err := b.Conf.Store.ListBillablesWithoutEvents()
+	if err != nil {
+		err = fmt.Errorf("error fetching billables without events: %w", err)
+		return
+	}
+
+	for _, bID := range bIDs {
+		recorded, errBackfill := b.backfillEvents(bID)
+		if errBackfill != nil {
+			err = fmt.Errorf("failed to record history of billable %s: %w", bID, errBackfill)
+			return
+		}
+		if recorded {
+			out++
+		}
+	}
+	return
+}
+
+func (b *BillerEngine) backfillEvents(bID string) (recorded bool, err error) {
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		recorded = false
+		if _, err = tx.LastEvent(bID); !errors.Is(err, ErrStoreNotFound) {
+			return // recorded meanwhile
+		}
+
+		billable, err := tx.GetBillable(bID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", bID)
+			return
+		}
+		installments, err := tx.ListInstallments(bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching installments: %w", err)
+			return
+		}
+		transitions, err := tx.ListTransitions(bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching transitions: %w", err)
+			return
+		}
+		payments, err := b.getPayments(tx, bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching payments: %w", err)
+			return
+		}
+		fees, err := tx.ListFees(bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching fees: %w", err)
+			return
+		}
+
+		// the billable is created as it was before any transition, with the
+		// schedule it started with
+		if len(transitions) > 0 {
+			billable.Status = transitions[0].FromStatus
+			if billable.Status == "" {
+				billable.Status = transitions[0].ToStatus
+			}
+		}
+		for i := range installments {
+			installments[i].AmountPaid = 0
+			installments[i].Status = InstallmentStatusUnpaid
+		}
+
+		// then everything that happened to it, in the order it happened
+		type change struct {
+			at        time.Time
+			eventType EventType
+			payload   any
+		}
+		changes := []change{}
+		for _, t := range transitions {
+			if t.FromStatus == "" {
+				changes = append(changes, change{t.CreatedAt, EventStatusChanged, t})
+			}
+		}
+		for _, p := range payments {
+			changes = append(changes, change{p.CreatedAt, eventTypeOf(p.Kind), p})
+		}
+		for _, fee := range fees {
+			changes = append(changes, change{fee.CreatedAt, EventFeeCharged, fee})
+		}
+		for _, t := range transitions {
+			if t.FromStatus != "" {
+				changes = append(changes, change{t.CreatedAt, EventStatusChanged, t})
+			}
+		}
+		sort.SliceStable(changes, func(i, j int) bool {
+			return changes[i].at.Before(changes[j].at)
+		})
+
+		if _, err = b.appendEvent(tx, bID, EventBillableCreated, BillableCreatedPayload{Billable: billable, Installments: installments}); err != nil {
+			return
+		}
+		for _, c := range changes {
+			if _, err = b.appendEvent(tx, bID, c.eventType, c.payload); err != nil {
+				return
+			}
+		}
+		recorded = true
+		return
+	})
+	return
+}
+
+// replayEvents applies the history of a billable over its dropped projections.
+func (b *BillerEngine) replayEvents(tx BillerRepository, events []BillableEvent) (err error) {
+	for _, e := range events {
+		if err = applyEvent(tx, e); err != nil {
+			err = fmt.Errorf("failed to replay event %d: %w", e.Seq, err)
+			return
+		}
+	}
+
+	// installment state follows from the payments
+	_, _, err = b.projectLedger(tx, events[0].BillableID)
+	return
+}
+
+// recordEvent appends payload as the next event of the billable and applies
+// it to the stored state, the same way replaying the event would.
+func (b *BillerEngine) recordEvent(tx BillerRepository, bID string, eventType EventType, payload any) (err error) {
+	event, err := b.appendEvent(tx, bID, eventType, payload)
+	if err != nil {
+		return
+	}
+	err = applyEvent(tx, event)
+	return
+}
+
+// applyEvent stores what the event changed on the billable. Installment state
+// is left to projectLedger, which derives it from every payment at once.
+func applyEvent(tx BillerRepository, e BillableEvent) (err error) {
+	switch e.Type {
+	case EventBillableCreated:
+		var payload BillableCreatedPayload
+		if err = json.Unmarshal([]byte(e.Payload), &payload); err != nil {
+			break
+		}
+		if err = tx.InsertBillable(payload.Billable); err != nil {
+			err = fmt.Errorf("insert failed: %w", err)
+			break
+		}
+		if err = tx.InsertInstallments(payload.Installments); err != nil {
+			err = fmt.Errorf("insert installment failed: %w", err)
+		}
+	case EventStatusChanged:
+		var transition BillableTransition
+		if err = json.Unmarshal([]byte(e.Payload), &transition); err != nil {
+			break
+		}
+		// the initial status is part of the created billable
+		if transition.FromStatus != "" {
+			if err = tx.UpdateBillableStatus(transition.BillableID, transition.FromStatus, transition.ToStatus); err != nil {
+				err = fmt.Errorf("failed to update billable status: %w", err)
+				break
+			}
+		}
+		if err = tx.InsertTransition(transition); err != nil {
+			err = fmt.Errorf("failed to record transition: %w", err)
+		}
+	case EventPaymentReceived, EventPaymentReversed, EventPaymentRefunded:
+		var payment Payment
+		if err = json.Unmarshal([]byte(e.Payload), &payment); err != nil {
+			break
+		}
+		if err = tx.InsertPayment(payment); err != nil {
+			err = fmt.Errorf("failed to save payment: %w", err)
+		}
+	case EventFeeCharged:
+		var fee Fee
+		if err = json.Unmarshal([]byte(e.Payload), &fee); err != nil {
+			break
+		}
+		if err = tx.InsertFee(fee); err != nil {
+			err = fmt.Errorf("failed to save fee: %w", err)
+		}
+	default:
+		err = fmt.Errorf("unknown event type %s", e.Type)
+	}
+	return
+}
+
+// appendEvent records payload as the next event of the billable, chained to
+// the previous one.
+func (b *BillerEngine) appendEvent(tx BillerRepository, bID string, eventType EventType, payload any) (out BillableEvent, err error) {
+	last, err := tx.LastEvent(bID)
+	if errors.Is(err, ErrStoreNotFound) {
+		err = nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to read last event: %w", err)
+		return
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		err = fmt.Errorf("failed to encode event: %w", err)
+		return
+	}
+
+	out = BillableEvent{
+		ID:         xid.New().String(),
+		BillableID: bID,
+		Seq:        last.Seq + 1,
+		Type:       eventType,
+		Payload:    string(data),
+		PrevHash:   last.Hash,
+		CreatedAt:  b.Conf.GenerateCurrentDate(),
+	}
+	out.Hash = hashEvent(out)
+
+	if err = tx.AppendEvent(out); err != nil {
+		err = fmt.Errorf("failed to append event: %w", err)
+		return
+	}
+	return
+}
+
+func verifyEventChain(events []BillableEvent) error {
+	prevHash := ""
+	for i, e := range events {
+		if e.Seq != i+1 || e.PrevHash != prevHash || e.Hash != hashEvent(e) {
+			return fmt.Errorf("%w: billable %s at event %d", ErrEventChainBroken, e.BillableID, e.Seq)
+		}
+		prevHash = e.Hash
+	}
+	return nil
+}
+
+func hashEvent(e BillableEvent) string {
+	h := sha256.New()
+	for _, field := range []string{
+		e.PrevHash,
+		e.ID,
+		e.BillableID,
+		strconv.Itoa(e.Seq),
+		string(e.Type),
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Payload,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func eventTypeOf(kind PaymentKind) EventType {
+	switch kind {
+	case PaymentKindReversal:
+		return EventPaymentReversed
+	case PaymentKindRefund:
+		return EventPaymentRefunded
+	default:
+		return EventPaymentReceived
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_Events(t *testing.T) {
+	curdate := time.Now().UTC().Round(0)
+	now := curdate
+	newEngine := func(store BillerStore) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               store,
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+			AllowOverpayment:                    true,
+			PayoffInterestRebatePercentage:      1,
+		})
+		require.NoError(t, err)
+		return b
+	}
+
+	// exercise makes a billable go through most of what can happen to it
+	exercise := func(t *testing.T, b *BillerEngine) (bid string) {
+		defer func() { now = curdate }()
+
+		bid = xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		now = curdate.AddDate(0, 0, 21)
+		_, err = b.IsDelinquent(bid, time.Time{})
+		require.NoError(t, err)
+		p, err := b.MakePayment(bid, InputMakePayment{Amount: 330_000, PaidAt: now})
+		require.NoError(t, err)
+		_, err = b.ReversePayment(p.ID, InputReversePayment{Reason: "bounced"})
+		require.NoError(t, err)
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 5_600_000, PaidAt: now})
+		require.NoError(t, err)
+		_, err = b.RefundOverpayment(bid, InputRefundOverpayment{Amount: 100_000, Reason: "overpaid"})
+		require.NoError(t, err)
+		return
+	}
+
+	type projection struct {
+		Billable     Billable
+		Schedule     []Installment
+		Payments     []Payment
+		Transitions  []BillableTransition
+		Outstanding  OutstandingDetails
+		Delinquency  DelinquencyDetails
+		EventsLength int
+	}
+	project := func(t *testing.T, b *BillerEngine, bid string) (out projection) {
+		var err error
+		out.Billable, err = b.GetBillable(bid)
+		require.NoError(t, err)
+		out.Schedule, err = b.GetSchedule(bid)
+		require.NoError(t, err)
+		out.Payments, err = b.GetPayments(bid)
+		require.NoError(t, err)
+		out.Transitions, err = b.GetBillableTransitions(bid)
+		require.NoError(t, err)
+		out.Outstanding, err = b.GetOutstanding(bid, curdate.AddDate(0, 0, 30))
+		require.NoError(t, err)
+		out.Delinquency, err = b.IsDelinquent(bid, curdate.AddDate(0, 0, 30))
+		require.NoError(t, err)
+		events, err := b.GetEvents(bid)
+		require.NoError(t, err)
+		out.EventsLength = len(events)
+		return
+	}
+
+	t.Run("records_history", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+
+		// act
+		bid := exercise(t, b)
+
+		// assert
+		events, err := b.GetEvents(bid)
+		require.NoError(t, err)
+		types := []EventType{}
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		assert.Equal(t, []EventType{
+			EventBillableCreated,
+			EventStatusChanged, // created active
+			EventStatusChanged, // delinquent
+			EventPaymentReceived,
+			EventStatusChanged, // cured
+			EventPaymentReversed,
+			EventStatusChanged, // delinquent again
+			EventPaymentReceived,
+			EventStatusChanged, // paid off
+			EventPaymentRefunded,
+		}, types)
+		assert.NoError(t, b.VerifyEvents(bid))
+	})
+
+	t.Run("rebuild_matches", func(t *testing.T) {
+		// arrange
+		store := setupTestStore()
+		b := newEngine(store)
+		bid := exercise(t, b)
+		otherBID := exercise(t, b)
+		settledBID := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: settledBID, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		quote, err := b.GetPayoffQuote(settledBID, time.Time{})
+		require.NoError(t, err)
+		_, err = b.SettleBillable(settledBID, InputMakePayment{Amount: quote.PayoffAmount.Amount})
+		require.NoError(t, err)
+		before := project(t, b, bid)
+		otherBefore := project(t, b, otherBID)
+		settledBefore := project(t, b, settledBID)
+		require.NoError(t, store.DeleteProjections(bid))
+
+		// act
+		rebuilt, err := b.RebuildProjections()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 3, rebuilt)
+		assert.Equal(t, before, project(t, b, bid))
+		assert.Equal(t, otherBefore, project(t, b, otherBID))
+		assert.Equal(t, settledBefore, project(t, b, settledBID))
+	})
+
+	t.Run("backfills_billables_without_events", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+		bid := exercise(t, b)
+		before := project(t, b, bid)
+
+		// the same billable as stored before events were recorded
+		legacyStore := setupTestStore()
+		billable, err := b.GetBillable(bid)
+		require.NoError(t, err)
+		require.NoError(t, legacyStore.InsertBillable(billable))
+		require.NoError(t, legacyStore.InsertInstallments(before.Schedule))
+		for _, transition := range before.Transitions {
+			require.NoError(t, legacyStore.InsertTransition(transition))
+		}
+		for _, payment := range before.Payments {
+			require.NoError(t, legacyStore.InsertPayment(payment))
+		}
+		legacy := newEngine(legacyStore)
+
+		// act
+		recorded, err := legacy.BackfillEvents()
+		again, errAgain := legacy.BackfillEvents()
+		errRebuild := legacy.RebuildProjection(bid)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, 1, recorded)
+		assert.NoError(t, errAgain)
+		assert.Zero(t, again)
+		assert.NoError(t, errRebuild)
+		assert.NoError(t, legacy.VerifyEvents(bid))
+		assert.Equal(t, before, project(t, legacy, bid))
+	})
+
+	t.Run("sqlite_rebuild_and_tampering", func(t *testing.T) {
+		// arrange
+		db := setupTestDB()
+		defer db.Close()
+		store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+		require.NoError(t, err)
+		seedTestBorrower(store)
+		b := newEngine(store)
+		bid := exercise(t, b)
+		before := project(t, b, bid)
+
+		// act
+		errRebuild := b.RebuildProjection(bid)
+		after := project(t, b, bid)
+		_, errUpdate := db.Exec("UPDATE events SET payload = '{}' WHERE billable_id = ? AND seq = 4", bid)
+		_, errDelete := db.Exec("DELETE FROM events WHERE billable_id = ?", bid)
+		_, err = db.Exec("DROP TRIGGER trg_events_no_update")
+		require.NoError(t, err)
+		_, err = db.Exec("UPDATE events SET payload = replace(payload, '330000', '33000') WHERE billable_id = ? AND seq = 4", bid)
+		require.NoError(t, err)
+		errVerify := b.VerifyEvents(bid)
+		errTampered := b.RebuildProjection(bid)
+
+		// assert
+		assert.NoError(t, errRebuild)
+		assert.Equal(t, before, after)
+		assert.Error(t, errUpdate)
+		assert.Error(t, errDelete)
+		assert.ErrorIs(t, errVerify, ErrEventChainBroken)
+		assert.ErrorIs(t, errTampered, ErrEventChainBroken)
+	})
+}
+
+func TestVerifyEventChain(t *testing.T) {
+	// arrange
+	chain := []BillableEvent{}
+	prevHash := ""
+	for seq := 1; seq <= 3; seq++ {
+		e := BillableEvent{ID: xid.New().String(), BillableID: "b", Seq: seq, Type: EventStatusChanged, Payload: "{}", PrevHash: prevHash, CreatedAt: time.Now()}
+		e.Hash = hashEvent(e)
+		prevHash = e.Hash
+		chain = append(chain, e)
+	}
+	edited := append([]BillableEvent(nil), chain...)
+	edited[1].Payload = `{"Amount":1}`
+	dropped := []BillableEvent{chain[0], chain[2]}
+
+	// act
+	// assert
+	assert.NoError(t, verifyEventChain(chain))
+	assert.ErrorIs(t, verifyEventChain(edited), ErrEventChainBroken)
+	assert.ErrorIs(t, verifyEventChain(dropped), ErrEventChainBroken)
+	assert.ErrorIs(t, verifyEventChain(chain[1:]), ErrEventChainBroken)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const graceCutoffLayout = "15:04"
+
+func validateGraceCutoff(cutoff string) error {
+	if cutoff == "" {
+		return nil
+	}
+	if _, err := time.Parse(graceCutoffLayout, cutoff); err != nil {
+		return fmt.Errorf("grace cutoff must be HH:MM: %s", cutoff)
+	}
+	return nil
+}
+
+// graceEndOf returns the moment an installment of the billable due at dueAt,
+// in the billable timezone, counts as missed. The grace period runs the grace
+// days of the billable past the due date and, with a cutoff, ends at that time
+// of day on its last day. Due dates on a holiday hold at least until the end
+// of the next business day.
+func (b *BillerEngine) graceEndOf(billable Billable, dueAt time.Time) (out time.Time) {
+	out = dueAt.AddDate(0, 0, billable.GraceDays)
+	if cutoff, err := time.Parse(graceCutoffLayout, billable.GraceCutoff); err == nil {
+		year, month, day := out.Date()
+		out = time.Date(year, month, day, cutoff.Hour(), cutoff.Minute(), 0, 0, out.Location())
+	}
+	if holidayEnd := b.dueDates.HolidayGraceEnd(dueAt); holidayEnd.After(out) {
+		out = holidayEnd
+	}
+	if out.Before(dueAt) {
+		out = dueAt
+	}
+	return
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_GracePeriod(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, jakarta) // first installment due on Feb 12, 9 am local
+	newEngine := func() *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return curdate },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 1,
+			DefaultTimezone:                     "Asia/Jakarta",
+			DefaultGraceDays:                    3,
+			DefaultGraceCutoff:                  "17:00",
+		})
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("engine_default", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		graceEnd := time.Date(2024, 2, 15, 17, 0, 0, 0, jakarta)
+
+		// act
+		beforeDue, errBeforeDue := b.IsDelinquent(bid, time.Date(2024, 2, 12, 8, 0, 0, 0, jakarta))
+		inGrace, errInGrace := b.IsDelinquent(bid, graceEnd.Add(-time.Minute))
+		afterGrace, errAfterGrace := b.IsDelinquent(bid, graceEnd)
+
+		// assert
+		assert.NoError(t, errBeforeDue)
+		assert.Nil(t, beforeDue.GraceEndsAt)
+		assert.NoError(t, errInGrace)
+		assert.Equal(t, false, inGrace.Delinquency)
+		assert.Equal(t, 0, inGrace.MissedInstallments)
+		require.NotNil(t, inGrace.GraceEndsAt)
+		assert.True(t, graceEnd.Equal(*inGrace.GraceEndsAt))
+		assert.NoError(t, errAfterGrace)
+		assert.Equal(t, true, afterGrace.Delinquency)
+		assert.Equal(t, 1, afterGrace.MissedInstallments)
+		require.NotNil(t, afterGrace.GraceEndsAt)
+		assert.True(t, graceEnd.Equal(*afterGrace.GraceEndsAt))
+	})
+
+	t.Run("per_billable", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		bid := xid.New().String()
+		graceDays := 1
+		billable, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000, GraceDays: &graceDays, GraceCutoff: "12:00"})
+		require.NoError(t, err)
+		graceEnd := time.Date(2024, 2, 13, 12, 0, 0, 0, jakarta)
+
+		// act
+		inGrace, errInGrace := b.IsDelinquent(bid, graceEnd.Add(-time.Second))
+		afterGrace, errAfterGrace := b.IsDelinquent(bid, graceEnd)
+
+		// assert
+		assert.Equal(t, 1, billable.GraceDays)
+		assert.Equal(t, "12:00", billable.GraceCutoff)
+		assert.NoError(t, errInGrace)
+		assert.Equal(t, false, inGrace.Delinquency)
+		assert.NoError(t, errAfterGrace)
+		assert.Equal(t, true, afterGrace.Delinquency)
+		require.NotNil(t, afterGrace.GraceEndsAt)
+		assert.True(t, graceEnd.Equal(*afterGrace.GraceEndsAt))
+	})
+
+	t.Run("cutoff_before_due_time", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		bid := xid.New().String()
+		noGraceDays := 0
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000, GraceDays: &noGraceDays, GraceCutoff: "06:00"})
+		require.NoError(t, err)
+		dueAt := time.Date(2024, 2, 12, 9, 0, 0, 0, jakarta)
+
+		// act
+		out, err := b.IsDelinquent(bid, dueAt)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, true, out.Delinquency)
+		require.NotNil(t, out.GraceEndsAt)
+		assert.True(t, dueAt.Equal(*out.GraceEndsAt))
+	})
+
+	t.Run("bad_cutoff", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+
+		// act
+		_, errInput := b.MakeBillable(InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 5_000_000, GraceCutoff: "5pm"})
+		_, errConfig := NewBillerEngine(BillerEngineConfig{
+			Store:                               setupTestStore(),
+			GenerateCurrentDate:                 time.Now,
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 1,
+			DefaultGraceCutoff:                  "25:00",
+		})
+
+		// assert
+		assert.Error(t, errInput)
+		assert.Error(t, errConfig)
+	})
+}
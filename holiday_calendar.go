@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	validator "github.com/avrebarra/minivalidator"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrHolidayNotFound = errors.New("holiday not found")
+
+type Holiday struct {
+	Date time.Time // calendar date at midnight UTC
+	Name string
+}
+
+// HolidayCalendar is the set of dates besides weekends no payment is collected
+// on. A calendar loaded from a file writes its changes back to it. A nil
+// calendar has no holidays.
+type HolidayCalendar struct {
+	path string // file changes are written to, none when empty
+
+	mu      sync.RWMutex
+	entries map[string]Holiday // by date in YYYY-MM-DD
+}
+
+func NewHolidayCalendar(dates ...time.Time) *HolidayCalendar {
+	out := &HolidayCalendar{entries: map[string]Holiday{}}
+	for _, date := range dates {
+		holiday := Holiday{Date: dateOnly(date)}
+		out.entries[holiday.Date.Format(time.DateOnly)] = holiday
+	}
+	return out
+}
+
+// NewHolidayCalendarFile returns an empty calendar backed by path, for when
+// the holiday file does not exist yet. Its first change creates the file.
+func NewHolidayCalendarFile(path string) *HolidayCalendar {
+	out := NewHolidayCalendar()
+	out.path = path
+	return out
+}
+
+// LoadHolidayCalendar reads a holiday file. Files ending in .yaml or .yml hold
+// a list of date and name entries, any other file is read as CSV with a
+// YYYY-MM-DD date and an optional name per line, lines starting with # are
+// skipped.
+func LoadHolidayCalendar(path string) (out *HolidayCalendar, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("failed to read holiday file: %w", err)
+		return
+	}
+
+	var holidays []Holiday
+	if isYAMLFile(path) {
+		holidays, err = parseHolidaysYAML(content)
+	} else {
+		holidays, err = parseHolidaysCSV(content)
+	}
+	if err != nil {
+		err = fmt.Errorf("bad holiday file: %w", err)
+		return
+	}
+
+	out = NewHolidayCalendar()
+	out.path = path
+	for _, holiday := range holidays {
+		out.entries[holiday.Date.Format(time.DateOnly)] = holiday
+	}
+	return
+}
+
+// IsHoliday tells whether the calendar date of the given time, in its own
+// location, is a holiday.
+func (c *HolidayCalendar) IsHoliday(date time.Time) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.entries[date.Format(time.DateOnly)]
+	return ok
+}
+
+// List returns the holidays ordered by date.
+func (c *HolidayCalendar) List() (out []Holiday) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.list(c.entries)
+}
+
+// Set adds the holiday or renames the one on its date.
+func (c *HolidayCalendar) Set(holiday Holiday) (err error) {
+	holiday.Date = dateOnly(holiday.Date)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.copyEntries()
+	entries[holiday.Date.Format(time.DateOnly)] = holiday
+	return c.replace(entries)
+}
+
+func (c *HolidayCalendar) Remove(date time.Time) (err error) {
+	key := date.Format(time.DateOnly)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		return ErrHolidayNotFound
+	}
+	entries := c.copyEntries()
+	delete(entries, key)
+	return c.replace(entries)
+}
+
+func (c *HolidayCalendar) list(entries map[string]Holiday) (out []Holiday) {
+	out = make([]Holiday, 0, len(entries))
+	for _, holiday := range entries {
+		out = append(out, holiday)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return
+}
+
+func (c *HolidayCalendar) copyEntries() map[string]Holiday {
+	out := make(map[string]Holiday, len(c.entries))
+	for key, holiday := range c.entries {
+		out[key] = holiday
+	}
+	return out
+}
+
+// replace swaps in the entries once they are written to the calendar file,
+// the caller must hold the write lock.
+func (c *HolidayCalendar) replace(entries map[string]Holiday) (err error) {
+	if c.path != "" {
+		if err = c.save(c.list(entries)); err != nil {
+			err = fmt.Errorf("failed to write holiday file: %w", err)
+			return
+		}
+	}
+	c.entries = entries
+	return
+}
+
+// save writes the holidays next to the calendar file and moves them over it,
+// so a failed write leaves the file intact.
+func (c *HolidayCalendar) save(holidays []Holiday) (err error) {
+	var content []byte
+	if isYAMLFile(c.path) {
+		content, err = formatHolidaysYAML(holidays)
+	} else {
+		content, err = formatHolidaysCSV(holidays)
+	}
+	if err != nil {
+		return
+	}
+
+	tmp := c.path + ".tmp"
+	if err = os.WriteFile(tmp, content, 0o644); err != nil {
+		return
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// ***
+
+type holidayFileEntry struct {
+	Date string `yaml:"date"`
+	Name string `yaml:"name,omitempty"`
+}
+
+func isYAMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+func parseHolidaysYAML(content []byte) (out []Holiday, err error) {
+	var entries []holidayFileEntry
+	if err = yaml.Unmarshal(content, &entries); err != nil {
+		return
+	}
+	for i, entry := range entries {
+		date, errParse := time.Parse(time.DateOnly, entry.Date)
+		if errParse != nil {
+			err = fmt.Errorf("entry %d: %w", i+1, errParse)
+			return nil, err
+		}
+		out = append(out, Holiday{Date: date, Name: entry.Name})
+	}
+	return
+}
+
+func parseHolidaysCSV(content []byte) (out []Holiday, err error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	for {
+		record, errRead := reader.Read()
+		if errRead == io.EOF {
+			break
+		}
+		if errRead != nil {
+			err = errRead
+			return nil, err
+		}
+		if record[0] == "date" {
+			continue // header
+		}
+
+		date, errParse := time.Parse(time.DateOnly, strings.TrimSpace(record[0]))
+		if errParse != nil {
+			line, _ := reader.FieldPos(0)
+			err = fmt.Errorf("line %d: %w", line, errParse)
+			return nil, err
+		}
+		holiday := Holiday{Date: date}
+		if len(record) > 1 {
+			holiday.Name = strings.TrimSpace(record[1])
+		}
+		out = append(out, holiday)
+	}
+	return
+}
+
+func formatHolidaysYAML(holidays []Holiday) (out []byte, err error) {
+	entries := make([]holidayFileEntry, 0, len(holidays))
+	for _, holiday := range holidays {
+		entries = append(entries, holidayFileEntry{Date: holiday.Date.Format(time.DateOnly), Name: holiday.Name})
+	}
+	return yaml.Marshal(entries)
+}
+
+func formatHolidaysCSV(holidays []Holiday) (out []byte, err error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	records := [][]string{{"date", "name"}}
+	for _, holiday := range holidays {
+		records = append(records, []string{holiday.Date.Format(time.DateOnly), holiday.Name})
+	}
+	if err = writer.WriteAll(records); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// dateOnly returns the calendar date of t, in its own location, at midnight UTC.
+func dateOnly(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// ***
+
+func (b *BillerEngine) GetHolidays() (out []Holiday, err error) {
+	out = b.Conf.Holidays.List()
+	return
+}
+
+func (b *BillerEngine) SetHoliday(in InputSetHoliday) (out Holiday, err error) {
+	// validate inputs
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+	date, err := time.Parse(time.DateOnly, in.Date)
+	if err != nil {
+		err = fmt.Errorf("bad input: date must be YYYY-MM-DD: %s", in.Date)
+		return
+	}
+
+	out = Holiday{Date: date, Name: in.Name}
+	if err = b.Conf.Holidays.Set(out); err != nil {
+		err = fmt.Errorf("failed to set holiday: %w", err)
+		out = Holiday{}
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) RemoveHoliday(dateStr string) (err error) {
+	date, err := time.Parse(time.DateOnly, dateStr)
+	if err != nil {
+		err = fmt.Errorf("bad input: date must be YYYY-MM-DD: %s", dateStr)
+		return
+	}
+
+	err = b.Conf.Holidays.Remove(date)
+	if errors.Is(err, ErrHolidayNotFound) {
+		err = fmt.Errorf("holiday not found: date %s", dateStr)
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to remove holiday: %w", err)
+		return
+	}
+	return
+}
+
+type InputSetHoliday struct {
+	Date string `validate:"required"` // YYYY-MM-DD
+	Name string
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadHolidayCalendar(t *testing.T) {
+	writeFile := func(t *testing.T, name, content string) string {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+	newYear := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	ramadan := time.Date(2024, 4, 10, 0, 0, 0, 0, time.UTC)
+
+	t.Run("csv", func(t *testing.T) {
+		// arrange
+		path := writeFile(t, "holidays.csv", "date,name\n# national holidays\n2024-04-10, Idul Fitri\n\n2024-02-10,Imlek\n")
+
+		// act
+		out, err := LoadHolidayCalendar(path)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []Holiday{{Date: newYear, Name: "Imlek"}, {Date: ramadan, Name: "Idul Fitri"}}, out.List())
+		assert.True(t, out.IsHoliday(time.Date(2024, 2, 10, 23, 0, 0, 0, time.UTC)))
+		assert.False(t, out.IsHoliday(time.Date(2024, 2, 11, 0, 0, 0, 0, time.UTC)))
+	})
+
+	t.Run("plain_dates", func(t *testing.T) {
+		// arrange
+		path := writeFile(t, "holidays.txt", "2024-02-10\n2024-04-10\n")
+
+		// act
+		out, err := LoadHolidayCalendar(path)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []Holiday{{Date: newYear}, {Date: ramadan}}, out.List())
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		// arrange
+		path := writeFile(t, "holidays.yaml", "- date: 2024-02-10\n  name: Imlek\n- date: \"2024-04-10\"\n")
+
+		// act
+		out, err := LoadHolidayCalendar(path)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []Holiday{{Date: newYear, Name: "Imlek"}, {Date: ramadan}}, out.List())
+	})
+
+	t.Run("bad_date", func(t *testing.T) {
+		for name, content := range map[string]string{
+			"holidays.csv":  "2024-02-10\n10/04/2024\n",
+			"holidays.yaml": "- date: 2024-02-10\n- date: 10/04/2024\n",
+		} {
+			// act
+			out, err := LoadHolidayCalendar(writeFile(t, name, content))
+
+			// assert
+			assert.Nil(t, out)
+			assert.Error(t, err)
+		}
+	})
+
+	t.Run("missing_file", func(t *testing.T) {
+		// act
+		_, err := LoadHolidayCalendar(filepath.Join(t.TempDir(), "missing.csv"))
+
+		// assert
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("writes_back", func(t *testing.T) {
+		for _, name := range []string{"holidays.csv", "holidays.yml"} {
+			// arrange
+			path := writeFile(t, name, "")
+			calendar, err := LoadHolidayCalendar(path)
+			require.NoError(t, err)
+
+			// act
+			errSet := calendar.Set(Holiday{Date: ramadan, Name: "Idul Fitri"})
+			errSetOther := calendar.Set(Holiday{Date: newYear, Name: "Imlek"})
+			errRemove := calendar.Remove(ramadan)
+			errMissing := calendar.Remove(ramadan)
+
+			// assert
+			assert.NoError(t, errSet)
+			assert.NoError(t, errSetOther)
+			assert.NoError(t, errRemove)
+			assert.ErrorIs(t, errMissing, ErrHolidayNotFound)
+			reloaded, err := LoadHolidayCalendar(path)
+			assert.NoError(t, err)
+			assert.Equal(t, []Holiday{{Date: newYear, Name: "Imlek"}}, reloaded.List(), name)
+		}
+	})
+
+	t.Run("creates_missing_file", func(t *testing.T) {
+		for _, name := range []string{"holidays.csv", "holidays.yml"} {
+			// arrange
+			path := filepath.Join(t.TempDir(), name)
+			calendar := NewHolidayCalendarFile(path)
+
+			// act
+			errSet := calendar.Set(Holiday{Date: newYear, Name: "Imlek"})
+
+			// assert
+			assert.NoError(t, errSet)
+			reloaded, err := LoadHolidayCalendar(path)
+			assert.NoError(t, err)
+			assert.Equal(t, []Holiday{{Date: newYear, Name: "Imlek"}}, reloaded.List(), name)
+		}
+	})
+}
+
+func TestBillerEngine_Holidays(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // a monday
+	now := curdate
+	newEngine := func() *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 1,
+		})
+		require.NoError(t, err)
+		return b
+	}
+
+	t.Run("manage", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+
+		// act
+		_, errSet := b.SetHoliday(InputSetHoliday{Date: "2024-02-14", Name: "Election day"})
+		_, errBadDate := b.SetHoliday(InputSetHoliday{Date: "14/02/2024"})
+		errRemoveMissing := b.RemoveHoliday("2024-02-15")
+		holidays, errList := b.GetHolidays()
+
+		// assert
+		assert.NoError(t, errSet)
+		assert.Error(t, errBadDate)
+		assert.Error(t, errRemoveMissing)
+		assert.NoError(t, errList)
+		assert.Equal(t, []Holiday{{Date: time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC), Name: "Election day"}}, holidays)
+
+		assert.NoError(t, b.RemoveHoliday("2024-02-14"))
+		holidays, _ = b.GetHolidays()
+		assert.Empty(t, holidays)
+	})
+
+	t.Run("delinquency_grace", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		before, err := b.IsDelinquent(bid, curdate.AddDate(0, 0, 8)) // the day after the first due date
+		require.NoError(t, err)
+
+		// the first due date becomes a holiday after the schedule was laid out
+		_, err = b.SetHoliday(InputSetHoliday{Date: "2024-02-12", Name: "Cuti bersama"})
+		require.NoError(t, err)
+
+		// act
+		onNextBusinessDay, errNext := b.IsDelinquent(bid, curdate.AddDate(0, 0, 8))
+		afterNextBusinessDay, errAfter := b.IsDelinquent(bid, curdate.AddDate(0, 0, 9))
+		now = curdate.AddDate(0, 0, 8).Add(6 * time.Hour)
+		_, errPay := b.MakePayment(bid, InputMakePayment{Amount: 110_000})
+		paidOnNextBusinessDay, errPaid := b.IsDelinquent(bid, curdate.AddDate(0, 0, 9))
+
+		// assert
+		assert.Equal(t, true, before.Delinquency)
+		assert.NoError(t, errNext)
+		assert.Equal(t, false, onNextBusinessDay.Delinquency)
+		assert.Equal(t, 0, onNextBusinessDay.MissedInstallments)
+		assert.NoError(t, errAfter)
+		assert.Equal(t, true, afterNextBusinessDay.Delinquency)
+		assert.Equal(t, 1, afterNextBusinessDay.MissedInstallments)
+		assert.Equal(t, 2, afterNextBusinessDay.DaysPastDue)
+		assert.NoError(t, errPay)
+		assert.NoError(t, errPaid)
+		assert.Equal(t, false, paidOnNextBusinessDay.Delinquency)
+	})
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -33,10 +35,39 @@ func (e *Server) GetRouterEngine() *gin.Engine {
 	r.Use(e.ErrorHandler())
 
 	r.GET("/", e.Ping())
+	r.POST("/borrowers", e.HandleCreateBorrower())
+	r.GET("/borrowers", e.HandleGetBorrowers())
+	r.GET("/borrowers/:borrower_id", e.HandleGetBorrower())
+	r.PUT("/borrowers/:borrower_id", e.HandleUpdateBorrower())
+	r.DELETE("/borrowers/:borrower_id", e.HandleDeleteBorrower())
+	r.GET("/borrowers/:borrower_id/exposure", e.HandleGetBorrowerExposure())
 	r.POST("/billables", e.HandleMakeBillable())
+	r.GET("/billables/:billable_id", e.HandleGetBillable())
+	r.GET("/billables/:billable_id/transitions", e.HandleGetBillableTransitions())
+	r.POST("/billables/:billable_id/transitions", e.HandleTransitionBillable())
+	r.GET("/billables/:billable_id/events", e.HandleGetEvents())
+	r.GET("/billables/:billable_id/journal", e.HandleGetJournal())
+	r.GET("/accounting/trial-balance", e.HandleGetTrialBalance())
+	r.GET("/admin/holidays", e.HandleGetHolidays())
+	r.PUT("/admin/holidays/:date", e.HandleSetHoliday())
+	r.DELETE("/admin/holidays/:date", e.HandleRemoveHoliday())
+	r.GET("/admin/rules", e.HandleGetRules())
+	r.POST("/admin/rules", e.HandleCreateRule())
+	r.POST("/admin/rules/:rule_id/activate", e.HandleSetRuleActive(true))
+	r.POST("/admin/rules/:rule_id/deactivate", e.HandleSetRuleActive(false))
+	r.POST("/admin/rules/:rule_id/dry-run", e.HandleDryRunRule())
 	r.POST("/billables/:billable_id/make-payment", e.HandleMakePayment())
 	r.POST("/billables/:billable_id/check-delinquency", e.HandleCheckDelinquency())
+	r.GET("/billables/:billable_id/delinquency-history", e.HandleGetDelinquencyHistory())
 	r.GET("/billables/:billable_id/outstandings/", e.HandleGetOutstanding())
+	r.POST("/billables/:billable_id/charge-late-fees", e.HandleChargeLateFees())
+	r.GET("/billables/:billable_id/fees", e.HandleGetFees())
+	r.GET("/billables/:billable_id/schedule", e.HandleGetSchedule())
+	r.GET("/billables/:billable_id/payments", e.HandleGetPayments())
+	r.POST("/billables/:billable_id/refund", e.HandleRefundOverpayment())
+	r.POST("/payments/:payment_id/reverse", e.HandleReversePayment())
+	r.GET("/billables/:billable_id/payoff-quote", e.HandleGetPayoffQuote())
+	r.POST("/billables/:billable_id/settle", e.HandleSettleBillable())
 
 	return r
 }
@@ -80,51 +111,771 @@ func (e *Server) Ping() gin.HandlerFunc {
 
 func (e *Server) HandleMakeBillable() gin.HandlerFunc {
 	type Request struct {
-		BillableID      string `json:"billable_id"`
-		PrincipalAmount int    `json:"amount_principal"`
+		BillableID             string   `json:"billable_id"`
+		BorrowerID             string   `json:"borrower_id"`
+		PrincipalAmount        int      `json:"amount_principal"`
+		Currency               string   `json:"currency"`
+		Tenor                  int      `json:"tenor"`
+		DurWeek                int      `json:"dur_week"` // loan duration accepted before other frequencies existed
+		InterestRatePercentage *float64 `json:"interest_rate"`
+		Frequency              string   `json:"frequency"`
+		InterestModel          string   `json:"interest_model"`
+		Timezone               string   `json:"timezone"`
+		GraceDays              *int     `json:"grace_days"`
+		GraceCutoff            string   `json:"grace_cutoff"`
+		Product                string   `json:"product"`
+		Pending                bool     `json:"pending"`
+		IdempotencyKey         string   `json:"idempotency_key"`
+	}
+	type Response struct {
+		ID            string               `json:"id"`
+		BorrowerID    string               `json:"borrower_id"`
+		Amount        Money                `json:"amount"`
+		Principal     Money                `json:"principal"`
+		Interest      Money                `json:"total_interest"`
+		Tenor         int                  `json:"tenor"`
+		InterestRate  float64              `json:"interest_rate"`
+		InterestModel InterestModelKind    `json:"interest_model"`
+		EffectiveRate float64              `json:"effective_rate"`
+		Frequency     InstallmentFrequency `json:"frequency"`
+		Timezone      string               `json:"timezone"`
+		GraceDays     int                  `json:"grace_days"`
+		GraceCutoff   string               `json:"grace_cutoff"`
+		Product       string               `json:"product"`
+		Status        BillableStatus       `json:"status"`
+		CreatedAt     time.Time            `json:"created_at"`
+		DueAt         time.Time            `json:"due_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		billable, err := e.Config.BillerEngine.MakeBillable(InputMakeBillable{
+			BID:                    req.BillableID,
+			BorrowerID:             req.BorrowerID,
+			Principal:              req.PrincipalAmount,
+			Currency:               Currency(req.Currency),
+			Tenor:                  req.Tenor,
+			DurationWeeks:          req.DurWeek,
+			InterestRatePercentage: req.InterestRatePercentage,
+			Frequency:              InstallmentFrequency(req.Frequency),
+			InterestModel:          InterestModelKind(req.InterestModel),
+			Timezone:               req.Timezone,
+			GraceDays:              req.GraceDays,
+			GraceCutoff:            req.GraceCutoff,
+			Product:                req.Product,
+			Pending:                req.Pending,
+			IdempotencyKey:         e.idempotencyKeyOf(ctx, req.IdempotencyKey),
+		})
+		if err != nil {
+			err = fmt.Errorf("billable creation failed: %w", err)
+			ctx.JSON(e.statusCodeOf(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(billable)))
+	}
+}
+
+func (e *Server) HandleGetBillable() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Response struct {
+		ID            string               `json:"id"`
+		BorrowerID    string               `json:"borrower_id"`
+		Amount        Money                `json:"amount"`
+		Principal     Money                `json:"principal"`
+		Interest      Money                `json:"total_interest"`
+		Tenor         int                  `json:"tenor"`
+		InterestRate  float64              `json:"interest_rate"`
+		InterestModel InterestModelKind    `json:"interest_model"`
+		EffectiveRate float64              `json:"effective_rate"`
+		Frequency     InstallmentFrequency `json:"frequency"`
+		Timezone      string               `json:"timezone"`
+		GraceDays     int                  `json:"grace_days"`
+		GraceCutoff   string               `json:"grace_cutoff"`
+		Product       string               `json:"product"`
+		Status        BillableStatus       `json:"status"`
+		CreatedAt     time.Time            `json:"created_at"`
+		DueAt         time.Time            `json:"due_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		billable, err := e.Config.BillerEngine.GetBillable(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting billable failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(billable)))
+	}
+}
+
+func (e *Server) HandleTransitionBillable() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+		Status     string `json:"status"`
+		Reason     string `json:"reason"`
+	}
+	type Response struct {
+		ID         string         `json:"id"`
+		BillableID string         `json:"billable_id"`
+		FromStatus BillableStatus `json:"from_status"`
+		ToStatus   BillableStatus `json:"to_status"`
+		Reason     string         `json:"reason"`
+		CreatedAt  time.Time      `json:"created_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		transition, err := e.Config.BillerEngine.TransitionBillable(req.BillableID, InputTransitionBillable{
+			Status: BillableStatus(req.Status),
+			Reason: req.Reason,
+		})
+		if err != nil {
+			err = fmt.Errorf("status transition failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(transition)))
+	}
+}
+
+func (e *Server) HandleGetBillableTransitions() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Transition struct {
+		ID         string         `json:"id"`
+		BillableID string         `json:"billable_id"`
+		FromStatus BillableStatus `json:"from_status"`
+		ToStatus   BillableStatus `json:"to_status"`
+		Reason     string         `json:"reason"`
+		CreatedAt  time.Time      `json:"created_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		transitions, err := e.Config.BillerEngine.GetBillableTransitions(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting transitions failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Transition{}
+		for _, t := range transitions {
+			resp = append(resp, Transition(t))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetEvents() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Event struct {
+		ID         string          `json:"id"`
+		BillableID string          `json:"billable_id"`
+		Seq        int             `json:"seq"`
+		Type       EventType       `json:"type"`
+		Payload    json.RawMessage `json:"payload"`
+		PrevHash   string          `json:"prev_hash"`
+		Hash       string          `json:"hash"`
+		CreatedAt  time.Time       `json:"created_at"`
+	}
+	type Response struct {
+		Verified bool    `json:"verified"`
+		Events   []Event `json:"events"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, err := e.Config.BillerEngine.GetEvents(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting events failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := Response{Verified: verifyEventChain(events) == nil, Events: []Event{}}
+		for _, ev := range events {
+			resp.Events = append(resp.Events, Event{
+				ID:         ev.ID,
+				BillableID: ev.BillableID,
+				Seq:        ev.Seq,
+				Type:       ev.Type,
+				Payload:    json.RawMessage(ev.Payload),
+				PrevHash:   ev.PrevHash,
+				Hash:       ev.Hash,
+				CreatedAt:  ev.CreatedAt,
+			})
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetJournal() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Line struct {
+		Account string `json:"account"`
+		Debit   Money  `json:"debit"`
+		Credit  Money  `json:"credit"`
+	}
+	type Entry struct {
+		ID          string    `json:"id"`
+		BillableID  string    `json:"billable_id"`
+		Description string    `json:"description"`
+		Reference   string    `json:"reference"`
+		Currency    Currency  `json:"currency"`
+		PostedAt    time.Time `json:"posted_at"`
+		Lines       []Line    `json:"lines"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		entries, err := e.Config.BillerEngine.GetJournalEntries(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting journal failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Entry{}
+		for _, entry := range entries {
+			lines := []Line{}
+			for _, line := range entry.Lines {
+				lines = append(lines, Line{
+					Account: line.Account,
+					Debit:   NewMoney(line.Debit, entry.Currency),
+					Credit:  NewMoney(line.Credit, entry.Currency),
+				})
+			}
+			resp = append(resp, Entry{
+				ID:          entry.ID,
+				BillableID:  entry.BillableID,
+				Description: entry.Description,
+				Reference:   entry.Reference,
+				Currency:    entry.Currency,
+				PostedAt:    entry.PostedAt,
+				Lines:       lines,
+			})
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetTrialBalance() gin.HandlerFunc {
+	type Account struct {
+		Account  string   `json:"account"`
+		Currency Currency `json:"currency"`
+		Debit    Money    `json:"debit"`
+		Credit   Money    `json:"credit"`
+		Balance  Money    `json:"balance"`
+	}
+	type Total struct {
+		Currency Currency `json:"currency"`
+		Debit    Money    `json:"debit"`
+		Credit   Money    `json:"credit"`
+	}
+	type Response struct {
+		Accounts []Account `json:"accounts"`
+		Totals   []Total   `json:"totals"`
+		Balanced bool      `json:"balanced"`
+	}
+	return func(ctx *gin.Context) {
+		trial, err := e.Config.BillerEngine.GetTrialBalance()
+		if err != nil {
+			err = fmt.Errorf("getting trial balance failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := Response{Accounts: []Account{}, Totals: []Total{}, Balanced: trial.Balanced}
+		for _, account := range trial.Accounts {
+			resp.Accounts = append(resp.Accounts, Account{
+				Account:  account.Account,
+				Currency: account.Currency,
+				Debit:    NewMoney(account.Debit, account.Currency),
+				Credit:   NewMoney(account.Credit, account.Currency),
+				Balance:  NewMoney(account.Balance, account.Currency),
+			})
+		}
+		for _, total := range trial.Totals {
+			resp.Totals = append(resp.Totals, Total{
+				Currency: total.Currency,
+				Debit:    NewMoney(total.Debit, total.Currency),
+				Credit:   NewMoney(total.Credit, total.Currency),
+			})
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetHolidays() gin.HandlerFunc {
+	type Holiday struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+	return func(ctx *gin.Context) {
+		holidays, err := e.Config.BillerEngine.GetHolidays()
+		if err != nil {
+			err = fmt.Errorf("getting holidays failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Holiday{}
+		for _, holiday := range holidays {
+			resp = append(resp, Holiday{Date: holiday.Date.Format(time.DateOnly), Name: holiday.Name})
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleSetHoliday() gin.HandlerFunc {
+	type Request struct {
+		Date string `uri:"date"`
+		Name string `json:"name"`
+	}
+	type Response struct {
+		Date string `json:"date"`
+		Name string `json:"name"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		holiday, err := e.Config.BillerEngine.SetHoliday(InputSetHoliday{Date: req.Date, Name: req.Name})
+		if err != nil {
+			err = fmt.Errorf("setting holiday failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response{Date: holiday.Date.Format(time.DateOnly), Name: holiday.Name}))
+	}
+}
+
+func (e *Server) HandleRemoveHoliday() gin.HandlerFunc {
+	type Request struct {
+		Date string `uri:"date"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := e.Config.BillerEngine.RemoveHoliday(req.Date); err != nil {
+			err = fmt.Errorf("removing holiday failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(gin.H{"date": req.Date}))
+	}
+}
+
+func (e *Server) HandleGetRules() gin.HandlerFunc {
+	type Rule struct {
+		ID         string    `json:"id"`
+		Kind       RuleKind  `json:"kind"`
+		Name       string    `json:"name"`
+		Expression string    `json:"expression"`
+		Active     bool      `json:"active"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		rules, err := e.Config.BillerEngine.GetRules()
+		if err != nil {
+			err = fmt.Errorf("getting rules failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Rule{}
+		for _, rule := range rules {
+			resp = append(resp, Rule(rule))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleCreateRule() gin.HandlerFunc {
+	type Request struct {
+		Kind       string `json:"kind"`
+		Name       string `json:"name"`
+		Expression string `json:"expression"`
+	}
+	type Response struct {
+		ID         string    `json:"id"`
+		Kind       RuleKind  `json:"kind"`
+		Name       string    `json:"name"`
+		Expression string    `json:"expression"`
+		Active     bool      `json:"active"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rule, err := e.Config.BillerEngine.CreateRule(InputCreateRule{
+			Kind:       RuleKind(req.Kind),
+			Name:       req.Name,
+			Expression: req.Expression,
+		})
+		if err != nil {
+			err = fmt.Errorf("rule creation failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(rule)))
+	}
+}
+
+func (e *Server) HandleSetRuleActive(active bool) gin.HandlerFunc {
+	type Request struct {
+		RuleID string `uri:"rule_id"`
+	}
+	type Response struct {
+		ID         string    `json:"id"`
+		Kind       RuleKind  `json:"kind"`
+		Name       string    `json:"name"`
+		Expression string    `json:"expression"`
+		Active     bool      `json:"active"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		setActive := e.Config.BillerEngine.DeactivateRule
+		if active {
+			setActive = e.Config.BillerEngine.ActivateRule
+		}
+		rule, err := setActive(req.RuleID)
+		if err != nil {
+			err = fmt.Errorf("updating rule failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(rule)))
+	}
+}
+
+func (e *Server) HandleDryRunRule() gin.HandlerFunc {
+	type Request struct {
+		RuleID      string    `uri:"rule_id"`
+		BillableIDs []string  `json:"billable_ids"`
+		AsOf        time.Time `json:"as_of"`
+	}
+	type Result struct {
+		BillableID string                 `json:"billable_id"`
+		Variables  map[string]interface{} `json:"variables,omitempty"`
+		Result     interface{}            `json:"result"`
+		Error      string                 `json:"error,omitempty"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		results, err := e.Config.BillerEngine.DryRunRule(req.RuleID, InputDryRunRule{BillableIDs: req.BillableIDs, AsOf: req.AsOf})
+		if err != nil {
+			err = fmt.Errorf("rule dry run failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Result{}
+		for _, result := range results {
+			resp = append(resp, Result(result))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleCreateBorrower() gin.HandlerFunc {
+	type Request struct {
+		BorrowerID string `json:"borrower_id"`
+		Name       string `json:"name"`
+	}
+	type Response struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		borrower, err := e.Config.BillerEngine.CreateBorrower(InputCreateBorrower{ID: req.BorrowerID, Name: req.Name})
+		if err != nil {
+			err = fmt.Errorf("borrower creation failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(borrower)))
+	}
+}
+
+func (e *Server) HandleGetBorrowers() gin.HandlerFunc {
+	type Borrower struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		borrowers, err := e.Config.BillerEngine.GetBorrowers()
+		if err != nil {
+			err = fmt.Errorf("getting borrowers failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Borrower{}
+		for _, borrower := range borrowers {
+			resp = append(resp, Borrower(borrower))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetBorrower() gin.HandlerFunc {
+	type Request struct {
+		BorrowerID string `uri:"borrower_id"`
 	}
 	type Response struct {
 		ID        string    `json:"id"`
-		Amount    int       `json:"amount"`
-		Principal int       `json:"principal"`
-		DurWeek   int       `json:"dur_week"`
+		Name      string    `json:"name"`
 		CreatedAt time.Time `json:"created_at"`
-		DueAt     time.Time `json:"due_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		borrower, err := e.Config.BillerEngine.GetBorrower(req.BorrowerID)
+		if err != nil {
+			err = fmt.Errorf("getting borrower failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(borrower)))
+	}
+}
+
+func (e *Server) HandleUpdateBorrower() gin.HandlerFunc {
+	type Request struct {
+		BorrowerID string `uri:"borrower_id"`
+		Name       string `json:"name"`
+	}
+	type Response struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		borrower, err := e.Config.BillerEngine.UpdateBorrower(req.BorrowerID, InputUpdateBorrower{Name: req.Name})
+		if err != nil {
+			err = fmt.Errorf("updating borrower failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(borrower)))
+	}
+}
+
+func (e *Server) HandleDeleteBorrower() gin.HandlerFunc {
+	type Request struct {
+		BorrowerID string `uri:"borrower_id"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := e.Config.BillerEngine.DeleteBorrower(req.BorrowerID); err != nil {
+			err = fmt.Errorf("deleting borrower failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(gin.H{"id": req.BorrowerID}))
+	}
+}
+
+func (e *Server) HandleGetBorrowerExposure() gin.HandlerFunc {
+	type Request struct {
+		BorrowerID string `uri:"borrower_id"`
+	}
+	type Total struct {
+		Currency        Currency `json:"currency"`
+		Principal       Money    `json:"principal"`
+		Outstanding     Money    `json:"outstanding"`
+		AmountInArrears Money    `json:"amount_in_arrears"`
+	}
+	type Response struct {
+		BorrowerID       string            `json:"borrower_id"`
+		Billables        int               `json:"billables"`
+		OpenBillables    int               `json:"open_billables"`
+		Totals           []Total           `json:"totals"`
+		Delinquent       bool              `json:"delinquent"`
+		WorstDaysPastDue int               `json:"worst_days_past_due"`
+		WorstBucket      DelinquencyBucket `json:"worst_bucket"`
+		WorstBillableID  string            `json:"worst_billable_id,omitempty"`
 	}
 	return func(ctx *gin.Context) {
 		var req Request
-		if err := ctx.ShouldBindJSON(&req); err != nil {
+		if err := ctx.ShouldBindUri(&req); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		billable, err := e.Config.BillerEngine.MakeBillable(InputMakeBillable{
-			BID:       req.BillableID,
-			Principal: req.PrincipalAmount,
-		})
+		exposure, err := e.Config.BillerEngine.GetBorrowerExposure(req.BorrowerID)
 		if err != nil {
-			err = fmt.Errorf("billable creation failed: %w", err)
+			err = fmt.Errorf("getting borrower exposure failed: %w", err)
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(billable)))
+		totals := []Total{}
+		for _, total := range exposure.Totals {
+			totals = append(totals, Total(total))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response{
+			BorrowerID:       exposure.BorrowerID,
+			Billables:        exposure.Billables,
+			OpenBillables:    exposure.OpenBillables,
+			Totals:           totals,
+			Delinquent:       exposure.Delinquent,
+			WorstDaysPastDue: exposure.WorstDaysPastDue,
+			WorstBucket:      exposure.WorstBucket,
+			WorstBillableID:  exposure.WorstBillableID,
+		}))
 	}
 }
 
 func (e *Server) HandleMakePayment() gin.HandlerFunc {
 	type Request struct {
-		BillableID string    `uri:"billable_id"`
-		Amount     int       `json:"amount"`
-		PaidAt     time.Time `json:"paid_at"`
+		BillableID     string    `uri:"billable_id"`
+		Amount         int       `json:"amount"`
+		Currency       string    `json:"currency"`
+		PaidAt         time.Time `json:"paid_at"`
+		IdempotencyKey string    `json:"idempotency_key"`
+	}
+	type Entry struct {
+		ID                string      `json:"id"`
+		BillableID        string      `json:"billable_id"`
+		Kind              PaymentKind `json:"kind"`
+		Amount            Money       `json:"amount"`
+		AmountAccumulated Money       `json:"amount_accumulated"`
+		AmountPrincipal   Money       `json:"amount_principal"`
+		AmountInterest    Money       `json:"amount_interest"`
+		AmountFees        Money       `json:"amount_fees"`
+		AmountPenalties   Money       `json:"amount_penalties"`
+		AmountUnallocated Money       `json:"amount_unallocated"`
+		AmountRebated     Money       `json:"amount_rebated"`
+		ReversesID        string      `json:"reverses_id,omitempty"`
+		Reason            string      `json:"reason,omitempty"`
+		PaidAt            time.Time   `json:"paid_at"`
+		CreatedAt         time.Time   `json:"created_at"`
 	}
 	type Response struct {
-		ID                string    `json:"id"`
-		BillableID        string    `json:"billable_id"`
-		Amount            int       `json:"amount"`
-		AmountAccumulated int       `json:"amount_accumulated"`
-		PaidAt            time.Time `json:"paid_at"`
-		CreatedAt         time.Time `json:"created_at"`
+		Entry
+		Status BillableStatus `json:"status"` // of the billable once the entry is booked
 	}
 	return func(ctx *gin.Context) {
 		var req Request
@@ -137,38 +888,52 @@ func (e *Server) HandleMakePayment() gin.HandlerFunc {
 			return
 		}
 
-		if req.PaidAt.IsZero() {
-			req.PaidAt = time.Now()
-		}
 		payment, err := e.Config.BillerEngine.MakePayment(req.BillableID, InputMakePayment{
-			Amount: req.Amount,
-			PaidAt: req.PaidAt,
+			Amount:         req.Amount,
+			Currency:       Currency(req.Currency),
+			PaidAt:         req.PaidAt,
+			IdempotencyKey: e.idempotencyKeyOf(ctx, req.IdempotencyKey),
 		})
 		if err != nil {
 			err = fmt.Errorf("payment failed: %w", err)
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			ctx.JSON(e.statusCodeOf(err), gin.H{"error": err.Error()})
 			return
 		}
 
-		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(payment)))
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response{Entry: Entry(payment.Payment), Status: payment.Status}))
 	}
 }
 
 func (e *Server) HandleCheckDelinquency() gin.HandlerFunc {
 	type Request struct {
-		BillableID string `uri:"billable_id"`
+		BillableID string    `uri:"billable_id"`
+		AsOf       time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00"`
 	}
 	type Response struct {
-		Delinquency bool `json:"delinquency"`
+		Delinquency        bool              `json:"delinquency"`
+		MissedInstallments int               `json:"missed_installments"`
+		AmountInArrears    Money             `json:"amount_in_arrears"`
+		DaysPastDue        int               `json:"days_past_due"`
+		FirstMissedDueAt   *time.Time        `json:"first_missed_due_at"`
+		GraceEndsAt        *time.Time        `json:"grace_ends_at"`
+		ExpectedPaidAmount Money             `json:"expected_paid_amount"`
+		ActualPaidAmount   Money             `json:"actual_paid_amount"`
+		Bucket             DelinquencyBucket `json:"bucket"`
+		CollectionStage    string            `json:"collection_stage"`
+		Status             BillableStatus    `json:"status"`
 	}
 	return func(ctx *gin.Context) {
 		var req Request
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err := ctx.ShouldBindUri(&req); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		status, err := e.Config.BillerEngine.IsDelinquent(req.BillableID)
+		status, err := e.Config.BillerEngine.IsDelinquent(req.BillableID, req.AsOf)
 		if err != nil {
 			err = fmt.Errorf("getting delinquency status failed: %w", err)
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -181,22 +946,37 @@ func (e *Server) HandleCheckDelinquency() gin.HandlerFunc {
 
 func (e *Server) HandleGetOutstanding() gin.HandlerFunc {
 	type Request struct {
-		BillableID string `uri:"billable_id"`
+		BillableID string    `uri:"billable_id"`
+		AsOf       time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00"`
 	}
 	type Response struct {
-		Principal   int `json:"principal"`
-		Bill        int `json:"bill"`
-		Paid        int `json:"paid"`
-		Outstanding int `json:"outstanding"`
+		Principal   Money `json:"principal"`
+		Interest    Money `json:"interest"`
+		Fees        Money `json:"fees"`
+		Bill        Money `json:"bill"`
+		Paid        Money `json:"paid"`
+		Rebated     Money `json:"rebated"`
+		Outstanding Money `json:"outstanding"`
+
+		OutstandingPrincipal Money `json:"outstanding_principal"`
+		OutstandingInterest  Money `json:"outstanding_interest"`
+		OutstandingFees      Money `json:"outstanding_fees"`
+		OutstandingPenalties Money `json:"outstanding_penalties"`
+
+		Status BillableStatus `json:"status"`
 	}
 	return func(ctx *gin.Context) {
 		var req Request
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err := ctx.ShouldBindUri(&req); err != nil {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		status, err := e.Config.BillerEngine.GetOutstanding(req.BillableID)
+		status, err := e.Config.BillerEngine.GetOutstanding(req.BillableID, req.AsOf)
 		if err != nil {
 			err = fmt.Errorf("getting outstanding status failed: %w", err)
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -207,6 +987,425 @@ func (e *Server) HandleGetOutstanding() gin.HandlerFunc {
 	}
 }
 
+func (e *Server) HandleChargeLateFees() gin.HandlerFunc {
+	type Request struct {
+		BillableID string    `uri:"billable_id"`
+		AsOf       time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00"`
+	}
+	type Fee struct {
+		ID             string      `json:"id"`
+		BillableID     string      `json:"billable_id"`
+		InstallmentSeq int         `json:"installment_seq"`
+		Kind           LateFeeKind `json:"kind"`
+		Amount         Money       `json:"amount"`
+		AccruedTo      time.Time   `json:"accrued_to"`
+		CreatedAt      time.Time   `json:"created_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		fees, err := e.Config.BillerEngine.ChargeLateFees(req.BillableID, req.AsOf)
+		if err != nil {
+			err = fmt.Errorf("charging late fees failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Fee{}
+		for _, fee := range fees {
+			resp = append(resp, Fee(fee))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetFees() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Fee struct {
+		ID             string      `json:"id"`
+		BillableID     string      `json:"billable_id"`
+		InstallmentSeq int         `json:"installment_seq"`
+		Kind           LateFeeKind `json:"kind"`
+		Amount         Money       `json:"amount"`
+		AccruedTo      time.Time   `json:"accrued_to"`
+		CreatedAt      time.Time   `json:"created_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		fees, err := e.Config.BillerEngine.GetFees(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting fees failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Fee{}
+		for _, fee := range fees {
+			resp = append(resp, Fee(fee))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetDelinquencyHistory() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Episode struct {
+		ID             string         `json:"id"`
+		BillableID     string         `json:"billable_id"`
+		StartedAt      time.Time      `json:"started_at"`
+		EndedAt        *time.Time     `json:"ended_at"`
+		EndStatus      BillableStatus `json:"end_status,omitempty"`
+		MaxDaysPastDue int            `json:"max_days_past_due"`
+		MaxArrears     Money          `json:"max_arrears"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		episodes, err := e.Config.BillerEngine.GetDelinquencyHistory(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting delinquency history failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		billable, err := e.Config.BillerEngine.GetBillable(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting delinquency history failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Episode{}
+		for _, episode := range episodes {
+			resp = append(resp, Episode{
+				ID:             episode.ID,
+				BillableID:     episode.BillableID,
+				StartedAt:      episode.StartedAt,
+				EndedAt:        episode.EndedAt,
+				EndStatus:      episode.EndStatus,
+				MaxDaysPastDue: episode.MaxDaysPastDue,
+				MaxArrears:     NewMoney(episode.MaxArrears, billable.Amount.Currency),
+			})
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetSchedule() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Installment struct {
+		BillableID  string            `json:"billable_id"`
+		Seq         int               `json:"seq"`
+		DueAt       time.Time         `json:"due_at"`
+		AmountDue   Money             `json:"amount_due"`
+		InterestDue Money             `json:"interest_due"`
+		AmountPaid  Money             `json:"amount_paid"`
+		Status      InstallmentStatus `json:"status"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		installments, err := e.Config.BillerEngine.GetSchedule(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting schedule failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		billable, err := e.Config.BillerEngine.GetBillable(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting schedule failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		currency := billable.Amount.Currency
+		resp := []Installment{}
+		for _, inst := range installments {
+			resp = append(resp, Installment{
+				BillableID:  inst.BillableID,
+				Seq:         inst.Seq,
+				DueAt:       inst.DueAt,
+				AmountDue:   NewMoney(inst.AmountDue, currency),
+				InterestDue: NewMoney(inst.InterestDue, currency),
+				AmountPaid:  NewMoney(inst.AmountPaid, currency),
+				Status:      inst.Status,
+			})
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleGetPayments() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+	}
+	type Payment struct {
+		ID                string      `json:"id"`
+		BillableID        string      `json:"billable_id"`
+		Kind              PaymentKind `json:"kind"`
+		Amount            Money       `json:"amount"`
+		AmountAccumulated Money       `json:"amount_accumulated"`
+		AmountPrincipal   Money       `json:"amount_principal"`
+		AmountInterest    Money       `json:"amount_interest"`
+		AmountFees        Money       `json:"amount_fees"`
+		AmountPenalties   Money       `json:"amount_penalties"`
+		AmountUnallocated Money       `json:"amount_unallocated"`
+		AmountRebated     Money       `json:"amount_rebated"`
+		ReversesID        string      `json:"reverses_id,omitempty"`
+		Reason            string      `json:"reason,omitempty"`
+		PaidAt            time.Time   `json:"paid_at"`
+		CreatedAt         time.Time   `json:"created_at"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		payments, err := e.Config.BillerEngine.GetPayments(req.BillableID)
+		if err != nil {
+			err = fmt.Errorf("getting payments failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp := []Payment{}
+		for _, p := range payments {
+			resp = append(resp, Payment(p))
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(resp))
+	}
+}
+
+func (e *Server) HandleReversePayment() gin.HandlerFunc {
+	type Request struct {
+		PaymentID string `uri:"payment_id"`
+		Reason    string `json:"reason"`
+	}
+	type Entry struct {
+		ID                string      `json:"id"`
+		BillableID        string      `json:"billable_id"`
+		Kind              PaymentKind `json:"kind"`
+		Amount            Money       `json:"amount"`
+		AmountAccumulated Money       `json:"amount_accumulated"`
+		AmountPrincipal   Money       `json:"amount_principal"`
+		AmountInterest    Money       `json:"amount_interest"`
+		AmountFees        Money       `json:"amount_fees"`
+		AmountPenalties   Money       `json:"amount_penalties"`
+		AmountUnallocated Money       `json:"amount_unallocated"`
+		AmountRebated     Money       `json:"amount_rebated"`
+		ReversesID        string      `json:"reverses_id,omitempty"`
+		Reason            string      `json:"reason,omitempty"`
+		PaidAt            time.Time   `json:"paid_at"`
+		CreatedAt         time.Time   `json:"created_at"`
+	}
+	type Response struct {
+		Entry
+		Status BillableStatus `json:"status"` // of the billable once the entry is booked
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		reversal, err := e.Config.BillerEngine.ReversePayment(req.PaymentID, InputReversePayment{
+			Reason: req.Reason,
+		})
+		if err != nil {
+			err = fmt.Errorf("payment reversal failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response{Entry: Entry(reversal.Payment), Status: reversal.Status}))
+	}
+}
+
+func (e *Server) HandleRefundOverpayment() gin.HandlerFunc {
+	type Request struct {
+		BillableID string `uri:"billable_id"`
+		Amount     int    `json:"amount"`
+		Reason     string `json:"reason"`
+	}
+	type Entry struct {
+		ID                string      `json:"id"`
+		BillableID        string      `json:"billable_id"`
+		Kind              PaymentKind `json:"kind"`
+		Amount            Money       `json:"amount"`
+		AmountAccumulated Money       `json:"amount_accumulated"`
+		AmountPrincipal   Money       `json:"amount_principal"`
+		AmountInterest    Money       `json:"amount_interest"`
+		AmountFees        Money       `json:"amount_fees"`
+		AmountPenalties   Money       `json:"amount_penalties"`
+		AmountUnallocated Money       `json:"amount_unallocated"`
+		AmountRebated     Money       `json:"amount_rebated"`
+		ReversesID        string      `json:"reverses_id,omitempty"`
+		Reason            string      `json:"reason,omitempty"`
+		PaidAt            time.Time   `json:"paid_at"`
+		CreatedAt         time.Time   `json:"created_at"`
+	}
+	type Response struct {
+		Entry
+		Status BillableStatus `json:"status"` // of the billable once the entry is booked
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		refund, err := e.Config.BillerEngine.RefundOverpayment(req.BillableID, InputRefundOverpayment{
+			Amount: req.Amount,
+			Reason: req.Reason,
+		})
+		if err != nil {
+			err = fmt.Errorf("refund failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response{Entry: Entry(refund.Payment), Status: refund.Status}))
+	}
+}
+
+func (e *Server) HandleGetPayoffQuote() gin.HandlerFunc {
+	type Request struct {
+		BillableID string    `uri:"billable_id"`
+		AsOf       time.Time `form:"as_of" time_format:"2006-01-02T15:04:05Z07:00"`
+	}
+	type Response struct {
+		BillableID     string         `json:"billable_id"`
+		AsOf           time.Time      `json:"as_of"`
+		Outstanding    Money          `json:"outstanding"`
+		Fees           Money          `json:"fees"`
+		InterestRebate Money          `json:"interest_rebate"`
+		PayoffAmount   Money          `json:"payoff_amount"`
+		Status         BillableStatus `json:"status"`
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBindQuery(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		quote, err := e.Config.BillerEngine.GetPayoffQuote(req.BillableID, req.AsOf)
+		if err != nil {
+			err = fmt.Errorf("getting payoff quote failed: %w", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response(quote)))
+	}
+}
+
+func (e *Server) HandleSettleBillable() gin.HandlerFunc {
+	type Request struct {
+		BillableID     string    `uri:"billable_id"`
+		Amount         int       `json:"amount"`
+		Currency       string    `json:"currency"`
+		PaidAt         time.Time `json:"paid_at"`
+		IdempotencyKey string    `json:"idempotency_key"`
+	}
+	type Entry struct {
+		ID                string      `json:"id"`
+		BillableID        string      `json:"billable_id"`
+		Kind              PaymentKind `json:"kind"`
+		Amount            Money       `json:"amount"`
+		AmountAccumulated Money       `json:"amount_accumulated"`
+		AmountPrincipal   Money       `json:"amount_principal"`
+		AmountInterest    Money       `json:"amount_interest"`
+		AmountFees        Money       `json:"amount_fees"`
+		AmountPenalties   Money       `json:"amount_penalties"`
+		AmountUnallocated Money       `json:"amount_unallocated"`
+		AmountRebated     Money       `json:"amount_rebated"`
+		ReversesID        string      `json:"reverses_id,omitempty"`
+		Reason            string      `json:"reason,omitempty"`
+		PaidAt            time.Time   `json:"paid_at"`
+		CreatedAt         time.Time   `json:"created_at"`
+	}
+	type Response struct {
+		Entry
+		Status BillableStatus `json:"status"` // of the billable once the entry is booked
+	}
+	return func(ctx *gin.Context) {
+		var req Request
+		if err := ctx.ShouldBind(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := ctx.ShouldBindUri(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// a zero paid_at is filled in by the engine from its clock
+		payment, err := e.Config.BillerEngine.SettleBillable(req.BillableID, InputMakePayment{
+			Amount:         req.Amount,
+			Currency:       Currency(req.Currency),
+			PaidAt:         req.PaidAt,
+			IdempotencyKey: e.idempotencyKeyOf(ctx, req.IdempotencyKey),
+		})
+		if err != nil {
+			err = fmt.Errorf("settlement failed: %w", err)
+			ctx.JSON(e.statusCodeOf(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, e.buildJSONResponse(Response{Entry: Entry(payment.Payment), Status: payment.Status}))
+	}
+}
+
 // ***
 
 func (e *Server) ErrorHandler() gin.HandlerFunc {
@@ -222,6 +1421,25 @@ func (e *Server) ErrorHandler() gin.HandlerFunc {
 	}
 }
 
+// idempotencyKeyOf prefers the Idempotency-Key header over the body field.
+func (e *Server) idempotencyKeyOf(ctx *gin.Context, bodyKey string) string {
+	if key := ctx.GetHeader("Idempotency-Key"); key != "" {
+		return key
+	}
+	return bodyKey
+}
+
+func (e *Server) statusCodeOf(err error) int {
+	switch {
+	case errors.Is(err, ErrIdempotencyConflict), errors.Is(err, ErrIdempotencyInProgress):
+		return http.StatusConflict
+	case errors.Is(err, ErrBorrowerDelinquent):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
+
 func (e *Server) buildJSONResponse(data interface{}) gin.H {
 	return gin.H{"data": data}
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrIdempotencyConflict   = errors.New("idempotency key reused with a different payload")
+	ErrIdempotencyInProgress = errors.New("request with the same idempotency key is in progress")
+)
+
+// withIdempotency runs fn once per key. Replays with the same request get the
+// stored result copied into out, while reusing the key for another request
+// fails with ErrIdempotencyConflict. fn is expected to fill out on success and
+// to only fail when it committed nothing, since its error releases the key.
+func (b *BillerEngine) withIdempotency(key string, request any, out any, fn func() error) (err error) {
+	fingerprint, err := fingerprintOf(request)
+	if err != nil {
+		err = fmt.Errorf("failed to fingerprint request: %w", err)
+		return
+	}
+
+	replayed, err := b.reserveIdempotencyKey(key, fingerprint, out)
+	if err != nil || replayed {
+		return
+	}
+
+	if err = fn(); err != nil {
+		// release the key so a corrected retry can go through
+		if errRelease := b.Conf.Store.DeleteIdempotencyKey(key); errRelease != nil {
+			err = fmt.Errorf("%w (failed to release idempotency key: %s)", err, errRelease)
+		}
+		return
+	}
+
+	response, err := json.Marshal(out)
+	if err != nil {
+		err = fmt.Errorf("failed to encode idempotent response: %w", err)
+		return
+	}
+	if err = b.Conf.Store.UpdateIdempotencyResponse(key, string(response)); err != nil {
+		err = fmt.Errorf("failed to store idempotent response: %w", err)
+		return
+	}
+	return
+}
+
+// reserveIdempotencyKey claims key for a new request, or decodes the stored
+// response into out when the same request was already completed.
+func (b *BillerEngine) reserveIdempotencyKey(key, fingerprint string, out any) (replayed bool, err error) {
+	now := b.Conf.GenerateCurrentDate()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		record, err := tx.GetIdempotencyKey(key)
+		switch {
+		case errors.Is(err, ErrStoreNotFound):
+			err = nil
+		case err != nil:
+			err = fmt.Errorf("failed to look up idempotency key: %w", err)
+			return
+		case !record.ExpiresAt.IsZero() && !now.Before(record.ExpiresAt):
+			if err = tx.DeleteIdempotencyKey(key); err != nil {
+				err = fmt.Errorf("failed to expire idempotency key: %w", err)
+				return
+			}
+		case record.Fingerprint != fingerprint:
+			err = ErrIdempotencyConflict
+			return
+		case record.Response == "":
+			err = ErrIdempotencyInProgress
+			return
+		default:
+			if err = json.Unmarshal([]byte(record.Response), out); err != nil {
+				err = fmt.Errorf("failed to decode idempotent response: %w", err)
+				return
+			}
+			replayed = true
+			return
+		}
+
+		record = IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: now}
+		if b.Conf.IdempotencyKeyTTL > 0 {
+			record.ExpiresAt = now.Add(b.Conf.IdempotencyKeyTTL)
+		}
+		if err = tx.InsertIdempotencyKey(record); err != nil {
+			err = fmt.Errorf("failed to reserve idempotency key: %w", err)
+			return
+		}
+		return
+	})
+	return
+}
+
+func fingerprintOf(request any) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// idempotentRequest is what gets fingerprinted, so a key cannot be replayed
+// against another operation or billable.
+type idempotentRequest struct {
+	Operation  string
+	BillableID string
+	Input      any
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_Idempotency(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now()
+	now := curdate
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return now },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+		PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+		IdempotencyKeyTTL:                   time.Hour,
+	})
+	require.NoError(t, err)
+
+	countPayments := func(bid string) int {
+		payments, err := store.ListPayments(bid)
+		require.NoError(t, err)
+		return len(payments)
+	}
+
+	t.Run("billable_replay", func(t *testing.T) {
+		// arrange
+		in := InputMakeBillable{BID: xid.New().String(), BorrowerID: testBorrowerID, Principal: 5_000_000, IdempotencyKey: xid.New().String()}
+
+		// act
+		first, errFirst := b.MakeBillable(in)
+		second, errSecond := b.MakeBillable(in)
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.Equal(t, first.ID, second.ID)
+		assert.Equal(t, first.Amount, second.Amount)
+		assert.True(t, first.CreatedAt.Equal(second.CreatedAt))
+	})
+
+	t.Run("payment_replay", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		in := InputMakePayment{Amount: 110_000, PaidAt: curdate, IdempotencyKey: xid.New().String()}
+
+		// act
+		first, errFirst := b.MakePayment(bid, in)
+		second, errSecond := b.MakePayment(bid, in)
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.Equal(t, first.ID, second.ID)
+		assert.Equal(t, first.AmountAccumulated, second.AmountAccumulated)
+		assert.Equal(t, BillableStatusActive, first.Status)
+		assert.Equal(t, first.Status, second.Status)
+		assert.Equal(t, 1, countPayments(bid))
+	})
+
+	t.Run("payment_conflict", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		otherBID := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		_, err = b.MakeBillable(InputMakeBillable{BID: otherBID, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		key := xid.New().String()
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate, IdempotencyKey: key})
+		require.NoError(t, err)
+
+		// act
+		_, errAmount := b.MakePayment(bid, InputMakePayment{Amount: 220_000, PaidAt: curdate, IdempotencyKey: key})
+		_, errBillable := b.MakePayment(otherBID, InputMakePayment{Amount: 110_000, PaidAt: curdate, IdempotencyKey: key})
+
+		// assert
+		assert.ErrorIs(t, errAmount, ErrIdempotencyConflict)
+		assert.ErrorIs(t, errBillable, ErrIdempotencyConflict)
+		assert.Equal(t, 1, countPayments(bid))
+		assert.Equal(t, 0, countPayments(otherBID))
+	})
+
+	t.Run("failure_releases_key", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000, Pending: true})
+		require.NoError(t, err)
+		in := InputMakePayment{Amount: 110_000, PaidAt: curdate, IdempotencyKey: xid.New().String()}
+
+		// act
+		_, errPending := b.MakePayment(bid, in)
+		_, err = b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusActive, Reason: "disbursed"})
+		require.NoError(t, err)
+		_, errRetry := b.MakePayment(bid, in)
+
+		// assert
+		assert.Error(t, errPending)
+		assert.NoError(t, errRetry)
+		assert.Equal(t, 1, countPayments(bid))
+	})
+
+	t.Run("expired_key", func(t *testing.T) {
+		defer func() { now = curdate }()
+
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		in := InputMakePayment{Amount: 110_000, PaidAt: curdate, IdempotencyKey: xid.New().String()}
+		first, err := b.MakePayment(bid, in)
+		require.NoError(t, err)
+
+		// act
+		now = curdate.Add(2 * time.Hour)
+		second, err := b.MakePayment(bid, in)
+
+		// assert
+		assert.NoError(t, err)
+		assert.NotEqual(t, first.ID, second.ID)
+		assert.Equal(t, 2, countPayments(bid))
+	})
+
+	t.Run("failed_status_sync", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		rule, err := b.CreateRule(InputCreateRule{Kind: RuleKindDelinquency, Name: "broken", Expression: "arrears / missed_installments > 1"})
+		require.NoError(t, err)
+		_, err = b.ActivateRule(rule.ID)
+		require.NoError(t, err)
+		in := InputMakePayment{Amount: 110_000, PaidAt: curdate, IdempotencyKey: xid.New().String()}
+
+		// act
+		_, errFirst := b.MakePayment(bid, in)
+		_, errRetry := b.MakePayment(bid, in)
+		failed := countPayments(bid)
+		_, err = b.DeactivateRule(rule.ID)
+		require.NoError(t, err)
+		fixed, errFixed := b.MakePayment(bid, in)
+		replayed, errReplay := b.MakePayment(bid, in)
+
+		// assert
+		assert.ErrorContains(t, errFirst, "division by zero")
+		assert.ErrorContains(t, errRetry, "division by zero")
+		assert.Equal(t, 0, failed) // the payment rolls back with the status sync
+		assert.NoError(t, errFixed)
+		assert.NoError(t, errReplay)
+		assert.Equal(t, fixed.ID, replayed.ID)
+		assert.Equal(t, 1, countPayments(bid))
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// InterestModel prices a loan by splitting every installment of its schedule
+// into the principal it repays and the interest it charges.
+type InterestModel interface {
+	Schedule(terms LoanTerms) (out []ScheduledAmount, err error)
+}
+
+type InterestModelKind string
+
+const (
+	InterestModelFlat             InterestModelKind = "flat"              // rate charged once on the principal for the whole term
+	InterestModelDecliningBalance InterestModelKind = "declining_balance" // yearly rate on the remaining principal, equal installments
+	InterestModelSimpleDaily      InterestModelKind = "simple_daily"      // yearly rate accrued daily on the remaining principal
+)
+
+var interestModels = map[InterestModelKind]InterestModel{
+	InterestModelFlat:             FlatInterest{},
+	InterestModelDecliningBalance: DecliningBalanceInterest{},
+	InterestModelSimpleDaily:      SimpleDailyInterest{},
+}
+
+func (k InterestModelKind) IsSupported() bool {
+	_, ok := interestModels[k]
+	return ok
+}
+
+type LoanTerms struct {
+	Principal    Money
+	InterestRate float64
+	StartAt      time.Time
+	DueDates     []time.Time // one per installment, in order
+}
+
+type ScheduledAmount struct {
+	Principal int
+	Interest  int
+}
+
+// FlatInterest charges the rate once on the principal, rounded up, and spreads
+// principal and interest evenly with the remainders on the last installment.
+type FlatInterest struct{}
+
+func (FlatInterest) Schedule(terms LoanTerms) (out []ScheduledAmount, err error) {
+	interest, err := terms.Principal.MulRate(terms.InterestRate, RoundingUp)
+	if err != nil {
+		return
+	}
+
+	n := len(terms.DueDates)
+	amount := terms.Principal.Amount + interest.Amount
+	for i := 0; i < n; i++ {
+		due, interestDue := amount/n, interest.Amount/n
+		if i == n-1 {
+			due, interestDue = amount-due*(n-1), interest.Amount-interestDue*(n-1)
+		}
+		out = append(out, ScheduledAmount{Principal: due - interestDue, Interest: interestDue})
+	}
+	return
+}
+
+// DecliningBalanceInterest amortizes the principal in equal installments, each
+// paying the periodic interest on the remaining principal first. The period
+// rate follows the average length of the installment periods.
+type DecliningBalanceInterest struct{}
+
+func (DecliningBalanceInterest) Schedule(terms LoanTerms) (out []ScheduledAmount, err error) {
+	n := len(terms.DueDates)
+	if terms.InterestRate == 0 {
+		return FlatInterest{}.Schedule(terms)
+	}
+	periodRate := terms.InterestRate * daysBetween(terms.StartAt, terms.DueDates[n-1]) / float64(n) / 365
+	payment := int(math.Ceil(float64(terms.Principal.Amount) * periodRate / (1 - math.Pow(1+periodRate, -float64(n)))))
+
+	remaining := terms.Principal
+	for i := 0; i < n; i++ {
+		interest, err := remaining.MulRate(periodRate, RoundingHalfUp)
+		if err != nil {
+			return nil, err
+		}
+		principal := payment - interest.Amount
+		if i == n-1 || principal > remaining.Amount {
+			principal = remaining.Amount
+		}
+		remaining.Amount -= principal
+		out = append(out, ScheduledAmount{Principal: principal, Interest: interest.Amount})
+	}
+	return
+}
+
+// SimpleDailyInterest repays the principal evenly and charges each installment
+// the interest accrued on the remaining principal over the days it covers.
+type SimpleDailyInterest struct{}
+
+func (SimpleDailyInterest) Schedule(terms LoanTerms) (out []ScheduledAmount, err error) {
+	n := len(terms.DueDates)
+	base := terms.Principal.Amount / n
+
+	remaining := terms.Principal
+	from := terms.StartAt
+	for i, dueAt := range terms.DueDates {
+		interest, err := remaining.MulRate(terms.InterestRate*daysBetween(from, dueAt)/365, RoundingHalfUp)
+		if err != nil {
+			return nil, err
+		}
+		principal := base
+		if i == n-1 {
+			principal = remaining.Amount
+		}
+		remaining.Amount -= principal
+		from = dueAt
+		out = append(out, ScheduledAmount{Principal: principal, Interest: interest.Amount})
+	}
+	return
+}
+
+// effectiveRateOf finds the yearly compounded rate at which the installments
+// are worth the principal at start, rounded to six decimals.
+func effectiveRateOf(principal int, start time.Time, installments []Installment) float64 {
+	total := 0
+	for _, inst := range installments {
+		total += inst.AmountDue
+	}
+	if principal <= 0 || total <= principal {
+		return 0
+	}
+
+	// present value falls as the rate grows, bisect until it meets the principal
+	presentValue := func(rate float64) (out float64) {
+		for _, inst := range installments {
+			out += float64(inst.AmountDue) / math.Pow(1+rate, daysBetween(start, inst.DueAt)/365)
+		}
+		return
+	}
+	low, high := 0.0, 1.0
+	for presentValue(high) > float64(principal) && high < 1e6 {
+		low, high = high, high*2
+	}
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > float64(principal) {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return math.Round((low+high)/2*1e6) / 1e6
+}
+
+func daysBetween(from, to time.Time) float64 {
+	return to.Sub(from).Hours() / 24
+}
+
+func interestModelOf(kind InterestModelKind) (out InterestModel, err error) {
+	out, ok := interestModels[kind]
+	if !ok {
+		err = fmt.Errorf("unsupported interest model: %s", kind)
+	}
+	return
+}
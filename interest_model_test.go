@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterestModels(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	weeklyTerms := func(rate float64) LoanTerms {
+		terms := LoanTerms{Principal: NewMoney(5_000_000, CurrencyIDR), InterestRate: rate, StartAt: start}
+		for seq := 1; seq <= 50; seq++ {
+			terms.DueDates = append(terms.DueDates, start.AddDate(0, 0, 7*seq))
+		}
+		return terms
+	}
+	totalsOf := func(amounts []ScheduledAmount) (principal, interest int) {
+		for _, a := range amounts {
+			principal += a.Principal
+			interest += a.Interest
+		}
+		return
+	}
+
+	t.Run("flat", func(t *testing.T) {
+		// arrange
+		terms := weeklyTerms(.1)
+
+		// act
+		out, err := FlatInterest{}.Schedule(terms)
+
+		// assert
+		require.NoError(t, err)
+		require.Len(t, out, 50)
+		principal, interest := totalsOf(out)
+		assert.Equal(t, 5_000_000, principal)
+		assert.Equal(t, 500_000, interest)
+		for _, a := range out {
+			assert.Equal(t, ScheduledAmount{Principal: 100_000, Interest: 10_000}, a)
+		}
+	})
+
+	t.Run("declining_balance", func(t *testing.T) {
+		// arrange
+		terms := weeklyTerms(.2)
+
+		// act
+		out, err := DecliningBalanceInterest{}.Schedule(terms)
+
+		// assert
+		require.NoError(t, err)
+		require.Len(t, out, 50)
+		principal, interest := totalsOf(out)
+		assert.Equal(t, 5_000_000, principal)
+		assert.Equal(t, 504_321, interest)
+		assert.Equal(t, ScheduledAmount{Principal: 90_909, Interest: 19_178}, out[0]) // a week of 20% on the full principal
+		for i := 1; i < 49; i++ {
+			assert.Equal(t, out[0].Principal+out[0].Interest, out[i].Principal+out[i].Interest, "installment %d", i+1)
+			assert.Less(t, out[i].Interest, out[i-1].Interest, "installment %d", i+1)
+		}
+	})
+
+	t.Run("simple_daily", func(t *testing.T) {
+		// arrange
+		terms := weeklyTerms(.2)
+
+		// act
+		out, err := SimpleDailyInterest{}.Schedule(terms)
+
+		// assert
+		require.NoError(t, err)
+		require.Len(t, out, 50)
+		principal, interest := totalsOf(out)
+		assert.Equal(t, 5_000_000, principal)
+		assert.Equal(t, 489_041, interest)
+		assert.Equal(t, ScheduledAmount{Principal: 100_000, Interest: 19_178}, out[0])
+		assert.Equal(t, ScheduledAmount{Principal: 100_000, Interest: 384}, out[49])
+	})
+
+	t.Run("zero_rate", func(t *testing.T) {
+		for _, model := range []InterestModel{FlatInterest{}, DecliningBalanceInterest{}, SimpleDailyInterest{}} {
+			// act
+			out, err := model.Schedule(weeklyTerms(0))
+
+			// assert
+			require.NoError(t, err)
+			principal, interest := totalsOf(out)
+			assert.Equal(t, 5_000_000, principal)
+			assert.Equal(t, 0, interest)
+		}
+	})
+}
+
+func TestEffectiveRateOf(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// a year-long bullet loan returns its rate
+	bullet := []Installment{{DueAt: start.AddDate(0, 0, 365), AmountDue: 1_100_000}}
+	assert.Equal(t, .1, effectiveRateOf(1_000_000, start, bullet))
+
+	// paying back early costs more than the same interest at the end
+	halves := []Installment{
+		{DueAt: start.AddDate(0, 0, 365/2), AmountDue: 550_000},
+		{DueAt: start.AddDate(0, 0, 365), AmountDue: 550_000},
+	}
+	assert.Greater(t, effectiveRateOf(1_000_000, start, halves), .1)
+
+	// nothing charged, nothing to report
+	assert.Equal(t, 0.0, effectiveRateOf(1_000_000, start, []Installment{{DueAt: start.AddDate(0, 0, 365), AmountDue: 1_000_000}}))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// GLAccounts maps the roles the engine posts to onto general ledger account codes.
+type GLAccounts struct {
+	Cash             string `validate:"required"`
+	LoanReceivable   string `validate:"required"`
+	UnearnedInterest string `validate:"required"` // interest billed but not yet earned
+	InterestIncome   string `validate:"required"`
+	FeeIncome        string `validate:"required"`
+	CustomerCredit   string `validate:"required"` // overpaid amounts owed back to borrowers
+	LoanLossExpense  string `validate:"required"` // principal lost on written off billables
+}
+
+// DefaultGLAccounts is used when the engine is configured without accounts.
+var DefaultGLAccounts = GLAccounts{
+	Cash:             "cash",
+	LoanReceivable:   "loan_receivable",
+	UnearnedInterest: "unearned_interest",
+	InterestIncome:   "interest_income",
+	FeeIncome:        "fee_income",
+	CustomerCredit:   "customer_credit",
+	LoanLossExpense:  "loan_loss_expense",
+}
+
+func (a GLAccounts) list() []string {
+	return []string{a.Cash, a.LoanReceivable, a.UnearnedInterest, a.InterestIncome, a.FeeIncome, a.CustomerCredit, a.LoanLossExpense}
+}
+
+func (b *BillerEngine) GetJournalEntries(bID string) (out []JournalEntry, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	if _, err = b.Conf.Store.GetBillable(bID); err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+
+	out, err = b.Conf.Store.ListJournalEntries(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching journal entries: %w", err)
+		return
+	}
+	return
+}
+
+// GetTrialBalance totals every account of the journal per currency. The
+// books are in order when debits equal credits in every currency.
+func (b *BillerEngine) GetTrialBalance() (out TrialBalance, err error) {
+	accounts, err := b.Conf.Store.ListAccountTotals()
+	if err != nil {
+		err = fmt.Errorf("error fetching account totals: %w", err)
+		return
+	}
+
+	out.Accounts = []AccountBalance{}
+	out.Totals = []TrialBalanceTotal{}
+	totals := map[Currency]int{}
+	for _, account := range accounts {
+		account.Balance = account.Debit - account.Credit
+		out.Accounts = append(out.Accounts, account)
+
+		i, ok := totals[account.Currency]
+		if !ok {
+			i = len(out.Totals)
+			totals[account.Currency] = i
+			out.Totals = append(out.Totals, TrialBalanceTotal{Currency: account.Currency})
+		}
+		out.Totals[i].Debit += account.Debit
+		out.Totals[i].Credit += account.Credit
+	}
+	sort.Slice(out.Totals, func(i, j int) bool { return out.Totals[i].Currency < out.Totals[j].Currency })
+
+	out.Balanced = true
+	for _, total := range out.Totals {
+		out.Balanced = out.Balanced && total.Debit == total.Credit
+	}
+	return
+}
+
+// postJournal brings the books of a billable in line with its current state
+// by posting the difference between what each account should carry and what
+// was posted so far. Nothing is posted when the books are already in line.
+func (b *BillerEngine) postJournal(tx BillerRepository, bID, description, reference string) (err error) {
+	target, currency, err := b.bookBalancesOf(tx, bID)
+	if err != nil {
+		return
+	}
+
+	entries, err := tx.ListJournalEntries(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching journal entries: %w", err)
+		return
+	}
+	posted := map[string]int{}
+	for _, entry := range entries {
+		for _, line := range entry.Lines {
+			posted[line.Account] += line.Debit - line.Credit
+		}
+	}
+
+	entry := JournalEntry{
+		ID:          xid.New().String(),
+		BillableID:  bID,
+		Description: description,
+		Reference:   reference,
+		Currency:    currency,
+		PostedAt:    b.Conf.GenerateCurrentDate(),
+	}
+	seen := map[string]bool{}
+	debit, credit := 0, 0
+	for _, account := range b.Conf.GLAccounts.list() {
+		if seen[account] {
+			continue
+		}
+		seen[account] = true
+
+		diff := target[account] - posted[account]
+		switch {
+		case diff > 0:
+			entry.Lines = append(entry.Lines, JournalLine{Account: account, Debit: diff})
+			debit += diff
+		case diff < 0:
+			entry.Lines = append(entry.Lines, JournalLine{Account: account, Credit: -diff})
+			credit -= diff
+		}
+	}
+	if len(entry.Lines) == 0 {
+		return
+	}
+	if debit != credit {
+		err = fmt.Errorf("unbalanced journal entry: debit %d credit %d", debit, credit)
+		return
+	}
+
+	if err = tx.InsertJournalEntry(entry); err != nil {
+		err = fmt.Errorf("failed to post journal entry: %w", err)
+		return
+	}
+	return
+}
+
+func journalDescriptionOf(kind PaymentKind) string {
+	switch kind {
+	case PaymentKindReversal:
+		return "payment reversed"
+	case PaymentKindRefund:
+		return "overpayment refunded"
+	default:
+		return "payment received"
+	}
+}
+
+// bookBalancesOf returns the balance, debit positive, every account should
+// carry for the billable. Interest is earned in proportion to the bill paid
+// in cash, and in full once nothing is left to pay.
+func (b *BillerEngine) bookBalancesOf(tx BillerRepository, bID string) (out map[string]int, currency Currency, err error) {
+	billable, err := tx.GetBillable(bID)
+	if err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+	payments, err := tx.ListPayments(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching payments: %w", err)
+		return
+	}
+	paid, rebated, credit := 0, 0, 0
+	for _, p := range payments {
+		paid += p.Amount.Amount
+		rebated += p.AmountRebated.Amount
+		credit += p.AmountUnallocated.Amount
+	}
+	currency = billable.Amount.Currency
+	bill, principal := billable.Amount.Amount, billable.Principal.Amount
+
+	accounts := b.Conf.GLAccounts
+	out = map[string]int{}
+	switch billable.Status {
+	case BillableStatusPending, BillableStatusCancelled:
+		// never disbursed or called off, whatever was paid is owed back
+		out[accounts.Cash] += paid
+		out[accounts.CustomerCredit] -= paid
+		return
+	}
+
+	fees, err := tx.ListFees(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching fees: %w", err)
+		return
+	}
+	charged := sumFees(fees)
+
+	// late fees are earned once charged
+	interest := bill - principal
+	settled := settledAsOf(payments, time.Time{})
+	toBill, toFees := settled.Principal+settled.Interest, settled.Fees+settled.Penalties
+	receivable := bill - toBill + charged - toFees
+	earned := interest - rebated
+	if toBill < bill && bill > 0 {
+		cashApplied := toBill - rebated
+		if share := cashApplied * interest / bill; share < earned {
+			earned = share
+		}
+	}
+	unearned := interest - earned - rebated
+
+	if billable.Status == BillableStatusWrittenOff {
+		// the unpaid principal is lost, the unearned interest never will be earned
+		out[accounts.LoanLossExpense] += receivable - unearned
+		receivable, unearned = 0, 0
+	}
+
+	out[accounts.Cash] += paid - principal
+	out[accounts.LoanReceivable] += receivable
+	out[accounts.UnearnedInterest] -= unearned
+	out[accounts.InterestIncome] -= earned
+	out[accounts.FeeIncome] -= charged
+	out[accounts.CustomerCredit] -= credit
+	return
+}
+
+// ***
+
+type TrialBalance struct {
+	Accounts []AccountBalance
+	Totals   []TrialBalanceTotal // one per currency
+	Balanced bool
+}
+
+type TrialBalanceTotal struct {
+	Currency Currency
+	Debit    int
+	Credit   int
+}
+
+type AccountBalance struct {
+	Account  string
+	Currency Currency
+	Debit    int
+	Credit   int
+	Balance  int // debit minus credit
+}
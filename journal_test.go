@@ -0,0 +1,224 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_Journal(t *testing.T) {
+	curdate := time.Now().UTC().Round(0)
+	now := curdate
+	accounts := DefaultGLAccounts
+	newEngine := func(store BillerStore) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               store,
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+			AllowOverpayment:                    true,
+			PayoffInterestRebatePercentage:      1,
+		})
+		require.NoError(t, err)
+		return b
+	}
+
+	// balancesOf sums the journal of a billable per account, debit positive,
+	// and checks each entry balances on its own
+	balancesOf := func(t *testing.T, b *BillerEngine, bid string) map[string]int {
+		entries, err := b.GetJournalEntries(bid)
+		require.NoError(t, err)
+		out := map[string]int{}
+		for _, entry := range entries {
+			debit, credit := 0, 0
+			for _, line := range entry.Lines {
+				debit += line.Debit
+				credit += line.Credit
+				out[line.Account] += line.Debit - line.Credit
+			}
+			assert.Equal(t, debit, credit, "entry %s", entry.Description)
+		}
+		return out
+	}
+
+	t.Run("disbursement", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+		bid := xid.New().String()
+
+		// act
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{
+			accounts.Cash:             -5_000_000,
+			accounts.LoanReceivable:   5_500_000,
+			accounts.UnearnedInterest: -500_000,
+		}, balancesOf(t, b, bid))
+	})
+
+	t.Run("paid_off_with_reversal_and_refund", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+
+		// act
+		p, err := b.MakePayment(bid, InputMakePayment{Amount: 1_100_000, PaidAt: now})
+		require.NoError(t, err)
+		partial := balancesOf(t, b, bid)
+		_, err = b.ReversePayment(p.ID, InputReversePayment{Reason: "bounced"})
+		require.NoError(t, err)
+		reversed := balancesOf(t, b, bid)
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 5_600_000, PaidAt: now})
+		require.NoError(t, err)
+		overpaid := balancesOf(t, b, bid)
+		_, err = b.RefundOverpayment(bid, InputRefundOverpayment{Amount: 100_000, Reason: "overpaid"})
+		require.NoError(t, err)
+
+		// assert
+		assert.Equal(t, map[string]int{
+			accounts.Cash:             -3_900_000,
+			accounts.LoanReceivable:   4_400_000,
+			accounts.UnearnedInterest: -400_000,
+			accounts.InterestIncome:   -100_000,
+		}, partial)
+		assert.Equal(t, map[string]int{
+			accounts.Cash:             -5_000_000,
+			accounts.LoanReceivable:   5_500_000,
+			accounts.UnearnedInterest: -500_000,
+			accounts.InterestIncome:   0,
+		}, reversed)
+		assert.Equal(t, -100_000, overpaid[accounts.CustomerCredit])
+		assert.Equal(t, map[string]int{
+			accounts.Cash:             500_000,
+			accounts.LoanReceivable:   0,
+			accounts.UnearnedInterest: 0,
+			accounts.InterestIncome:   -500_000,
+			accounts.CustomerCredit:   0,
+		}, balancesOf(t, b, bid))
+	})
+
+	t.Run("early_settlement", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: now})
+		require.NoError(t, err)
+		quote, err := b.GetPayoffQuote(bid, now)
+		require.NoError(t, err)
+
+		// act
+		_, err = b.SettleBillable(bid, InputMakePayment{Amount: quote.PayoffAmount.Amount, PaidAt: now})
+
+		// assert
+		assert.NoError(t, err)
+		balances := balancesOf(t, b, bid)
+		assert.Equal(t, 0, balances[accounts.LoanReceivable])
+		assert.Equal(t, 0, balances[accounts.UnearnedInterest])
+		assert.Equal(t, -(500_000 - quote.InterestRebate.Amount), balances[accounts.InterestIncome])
+		assert.Equal(t, 110_000+quote.PayoffAmount.Amount-5_000_000, balances[accounts.Cash])
+	})
+
+	t.Run("write_off", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		_, err = b.MakePayment(bid, InputMakePayment{Amount: 1_100_000, PaidAt: now})
+		require.NoError(t, err)
+
+		// act
+		_, err = b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusWrittenOff, Reason: "uncollectible"})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]int{
+			accounts.Cash:             -3_900_000,
+			accounts.LoanReceivable:   0,
+			accounts.UnearnedInterest: 0,
+			accounts.InterestIncome:   -100_000,
+			accounts.LoanLossExpense:  4_000_000,
+		}, balancesOf(t, b, bid))
+	})
+
+	t.Run("pending_cancelled", func(t *testing.T) {
+		// arrange
+		b := newEngine(setupTestStore())
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000, Pending: true})
+		require.NoError(t, err)
+
+		// act
+		_, err = b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusCancelled, Reason: "withdrawn"})
+
+		// assert
+		assert.NoError(t, err)
+		entries, err := b.GetJournalEntries(bid)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("trial_balance", func(t *testing.T) {
+		// arrange
+		db := setupTestDB()
+		defer db.Close()
+		store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+		require.NoError(t, err)
+		seedTestBorrower(store)
+		b := newEngine(store)
+		for _, amount := range []int{330_000, 5_500_000, 5_800_000} {
+			bid := xid.New().String()
+			_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+			require.NoError(t, err)
+			_, err = b.MakePayment(bid, InputMakePayment{Amount: amount, PaidAt: now})
+			require.NoError(t, err)
+		}
+
+		// act
+		trial, err := b.GetTrialBalance()
+
+		// assert
+		assert.NoError(t, err)
+		assert.True(t, trial.Balanced)
+		require.Len(t, trial.Totals, 1)
+		assert.Equal(t, CurrencyIDR, trial.Totals[0].Currency)
+		assert.Equal(t, trial.Totals[0].Debit, trial.Totals[0].Credit)
+		balances := map[string]int{}
+		for _, account := range trial.Accounts {
+			balances[account.Account] = account.Balance
+		}
+		assert.Equal(t, 330_000+5_500_000+5_800_000-15_000_000, balances[accounts.Cash])
+		assert.Equal(t, 5_500_000-330_000, balances[accounts.LoanReceivable])
+		assert.Equal(t, -300_000, balances[accounts.CustomerCredit])
+	})
+
+	t.Run("invalid_accounts", func(t *testing.T) {
+		// arrange
+		conf := BillerEngineConfig{
+			Store:                               setupTestStore(),
+			GenerateCurrentDate:                 time.Now,
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			GLAccounts:                          GLAccounts{Cash: "1000"},
+		}
+
+		// act
+		_, err := NewBillerEngine(conf)
+
+		// assert
+		assert.Error(t, err)
+	})
+}
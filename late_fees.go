@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	validator "github.com/avrebarra/minivalidator"
+	"github.com/rs/xid"
+)
+
+type LateFeeKind string
+
+const (
+	LateFeeFixed             LateFeeKind = "fixed"              // Amount once per late installment
+	LateFeeOverduePercentage LateFeeKind = "overdue_percentage" // Rate of the overdue amount, once per late installment
+	LateFeePenaltyInterest   LateFeeKind = "penalty_interest"   // yearly Rate accrued daily on the overdue amount
+
+	LateFeeRuleExpression LateFeeKind = "rule" // priced by the active late fee rule, once per late installment
+)
+
+func (k LateFeeKind) IsSupported() bool {
+	switch k {
+	case LateFeeFixed, LateFeeOverduePercentage, LateFeePenaltyInterest:
+		return true
+	}
+	return false
+}
+
+// LateFeeRule prices what paying an installment late costs. Every rule
+// charges each late installment separately, up to its cap. A rule with an
+// amount or a cap applies to billables in their currency only; a rule charging
+// just a rate applies to billables in every currency.
+type LateFeeRule struct {
+	Kind   LateFeeKind
+	Amount Money   // fixed fee
+	Rate   float64 `validate:"gte=0"` // percentage in float
+	Cap    Money   // most charged per installment, zero is uncapped
+}
+
+// currency returns the currency of the rule amounts, empty when it has none.
+func (r LateFeeRule) currency() Currency {
+	if r.Amount.Currency != "" {
+		return r.Amount.Currency
+	}
+	return r.Cap.Currency
+}
+
+func (r LateFeeRule) appliesTo(currency Currency) bool {
+	return r.currency() == "" || r.currency() == currency
+}
+
+func validateLateFeeRules(rules []LateFeeRule) (err error) {
+	seen := map[LateFeeKind][]Currency{}
+	for _, rule := range rules {
+		if err = validator.Validate(rule); err != nil {
+			return fmt.Errorf("late fee rule %s: %w", rule.Kind, err)
+		}
+		if !rule.Kind.IsSupported() {
+			return fmt.Errorf("unsupported late fee rule %s", rule.Kind)
+		}
+		for _, amount := range []Money{rule.Amount, rule.Cap} {
+			switch {
+			case amount.IsNegative():
+				return fmt.Errorf("late fee rule %s: negative amount %s", rule.Kind, amount)
+			case amount.Currency == "" && !amount.IsZero():
+				return fmt.Errorf("late fee rule %s: currency not defined", rule.Kind)
+			case amount.Currency != "" && !amount.Currency.IsSupported():
+				return fmt.Errorf("late fee rule %s: unsupported currency %s", rule.Kind, amount.Currency)
+			}
+		}
+		if rule.Amount.Currency != "" && rule.Cap.Currency != "" && rule.Amount.Currency != rule.Cap.Currency {
+			return fmt.Errorf("late fee rule %s: %w: amount in %s, cap in %s", rule.Kind, ErrCurrencyMismatch, rule.Amount.Currency, rule.Cap.Currency)
+		}
+		for _, currency := range seen[rule.Kind] {
+			if currency == "" || rule.currency() == "" || currency == rule.currency() {
+				return fmt.Errorf("duplicate late fee rule %s", rule.Kind)
+			}
+		}
+		seen[rule.Kind] = append(seen[rule.Kind], rule.currency())
+	}
+	return
+}
+
+// chargeFor returns what the rule charges an installment with the given
+// overdue amount, having charged it so far. Penalty interest is charged for
+// the days accrued since its last charge.
+func (r LateFeeRule) chargeFor(overdue Money, charged int, days int) (out int, err error) {
+	if !r.appliesTo(overdue.Currency) {
+		err = fmt.Errorf("%w: late fee rule %s in %s, overdue in %s", ErrCurrencyMismatch, r.Kind, r.currency(), overdue.Currency)
+		return
+	}
+	switch r.Kind {
+	case LateFeeFixed:
+		out = r.Amount.Amount
+	case LateFeeOverduePercentage:
+		fee, errRate := overdue.MulRate(r.Rate, RoundingHalfUp)
+		if errRate != nil {
+			return 0, errRate
+		}
+		out = fee.Amount
+	case LateFeePenaltyInterest:
+		fee, errRate := overdue.MulRate(r.Rate*float64(days)/365, RoundingHalfUp)
+		if errRate != nil {
+			return 0, errRate
+		}
+		out = fee.Amount
+	}
+	if r.Cap.IsPositive() && charged+out > r.Cap.Amount {
+		out = r.Cap.Amount - charged
+	}
+	if out < 0 {
+		out = 0
+	}
+	return
+}
+
+func (b *BillerEngine) GetFees(bID string) (out []Fee, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	if _, err = b.Conf.Store.GetBillable(bID); err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+
+	out, err = b.Conf.Store.ListFees(bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching fees: %w", err)
+		return
+	}
+	return
+}
+
+// ChargeLateFees applies the late fee rules, and the active late fee rule
+// expression, to every installment of the billable left unpaid past its grace
+// period as of asOf, the current date when zero, and returns the fees charged.
+// Running it again charges nothing new: fixed, percentage and expression fees
+// are charged once per installment, penalty interest only for the whole days
+// since it was last charged, on the amount overdue at the time of charging.
+func (b *BillerEngine) ChargeLateFees(bID string, asOf time.Time) (out []Fee, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+	timestamp := b.Conf.GenerateCurrentDate()
+	if asOf.IsZero() {
+		asOf = timestamp
+	}
+
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		out = nil
+
+		// retrieve billable
+		billable, err := tx.GetBillable(bID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", bID)
+			return
+		}
+		if !billable.Status.IsOpen() {
+			err = fmt.Errorf("billable is not accruing fees: status %s", billable.Status)
+			return
+		}
+		if asOf.Before(billable.CreatedAt) {
+			err = fmt.Errorf("billable did not exist as of %s", asOf.Format(time.RFC3339))
+			return
+		}
+		if asOf.After(timestamp) {
+			err = fmt.Errorf("fees cannot be charged ahead of time: as of %s", asOf.Format(time.RFC3339))
+			return
+		}
+		loc, err := time.LoadLocation(billable.Timezone)
+		if err != nil {
+			err = fmt.Errorf("billable has unknown timezone: %s", billable.Timezone)
+			return
+		}
+		currency := billable.Amount.Currency
+
+		// rebuild the schedule state as of the charging date
+		installments, err := tx.ListInstallments(bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching installments: %w", err)
+			return
+		}
+		payments, err := b.getPayments(tx, bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching payments: %w", err)
+			return
+		}
+		settled := settledAsOf(payments, asOf)
+		installments = scheduleAsOf(installments, settled.Principal+settled.Interest)
+
+		// what each rule charged each installment so far
+		type feeKey struct {
+			seq  int
+			kind LateFeeKind
+		}
+		fees, err := tx.ListFees(bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching fees: %w", err)
+			return
+		}
+		charged := map[feeKey]int{}
+		accruedTo := map[feeKey]time.Time{}
+		for _, fee := range fees {
+			key := feeKey{fee.InstallmentSeq, fee.Kind}
+			charged[key] += fee.Amount.Amount
+			if fee.AccruedTo.After(accruedTo[key]) {
+				accruedTo[key] = fee.AccruedTo
+			}
+		}
+
+		charge := func(seq int, kind LateFeeKind, amount int, feeAsOf time.Time) (err error) {
+			fee := Fee{
+				ID:             xid.New().String(),
+				BillableID:     bID,
+				InstallmentSeq: seq,
+				Kind:           kind,
+				Amount:         NewMoney(amount, currency),
+				AccruedTo:      feeAsOf,
+				CreatedAt:      timestamp,
+			}
+			if err = b.insertFee(tx, fee); err != nil {
+				return
+			}
+			out = append(out, fee)
+			return
+		}
+
+		// the active late fee rule is evaluated over the arrears as of asOf
+		feeRule, hasFeeRule, err := activeRuleOf(tx, RuleKindLateFee)
+		if err != nil {
+			return
+		}
+		_, snapshot := b.arrearsOf(billable, installments, loc, asOf)
+
+		for _, inst := range installments {
+			overdue := inst.AmountDue - inst.AmountPaid
+			if overdue <= 0 || b.graceEndOf(billable, inst.DueAt.In(loc)).After(asOf) {
+				continue
+			}
+
+			for _, rule := range b.Conf.LateFeeRules {
+				if !rule.appliesTo(currency) {
+					continue
+				}
+				key := feeKey{inst.Seq, rule.Kind}
+				last, chargedBefore := accruedTo[key]
+
+				feeAsOf, days := asOf, 0
+				if rule.Kind == LateFeePenaltyInterest {
+					from := inst.DueAt
+					if chargedBefore {
+						from = last
+					}
+					days = int(daysBetween(from, asOf))
+					if days < 1 {
+						continue
+					}
+					feeAsOf = from.AddDate(0, 0, days)
+				} else if chargedBefore {
+					continue
+				}
+
+				amount, errCharge := rule.chargeFor(NewMoney(overdue, currency), charged[key], days)
+				if errCharge != nil {
+					err = fmt.Errorf("failed to price late fee: %w", errCharge)
+					return
+				}
+				if amount == 0 {
+					continue
+				}
+				if err = charge(inst.Seq, rule.Kind, amount, feeAsOf); err != nil {
+					return
+				}
+			}
+
+			if _, chargedBefore := accruedTo[feeKey{inst.Seq, LateFeeRuleExpression}]; !hasFeeRule || chargedBefore {
+				continue
+			}
+			amount, errCharge := lateFeeOf(feeRule, snapshot, overdue)
+			if errCharge != nil {
+				err = errCharge
+				return
+			}
+			if amount == 0 {
+				continue
+			}
+			if err = charge(inst.Seq, LateFeeRuleExpression, amount, asOf); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		out = nil
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) insertFee(tx BillerRepository, fee Fee) (err error) {
+	if err = b.recordEvent(tx, fee.BillableID, EventFeeCharged, fee); err != nil {
+		return
+	}
+	err = b.postJournal(tx, fee.BillableID, "late fee charged", fee.ID)
+	return
+}
+
+func sumFees(fees []Fee) (out int) {
+	for _, fee := range fees {
+		out += fee.Amount.Amount
+	}
+	return
+}
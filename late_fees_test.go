@@ -0,0 +1,220 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_ChargeLateFees(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // first installment due on Feb 12
+	now := curdate
+	newEngine := func(rules ...LateFeeRule) *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+			PayoffInterestRebatePercentage:      1,
+			LateFeeRules:                        rules,
+		})
+		require.NoError(t, err)
+		return b
+	}
+	newBillable := func(t *testing.T, b *BillerEngine) string {
+		bid := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		return bid
+	}
+
+	t.Run("once_per_installment", func(t *testing.T) {
+		// arrange
+		b := newEngine(
+			LateFeeRule{Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyIDR)},
+			LateFeeRule{Kind: LateFeeOverduePercentage, Rate: .05},
+		)
+		bid := newBillable(t, b)
+		asOf := curdate.AddDate(0, 0, 8)
+		now = asOf.AddDate(0, 0, 1)
+		defer func() { now = curdate }()
+
+		// act
+		early, errEarly := b.ChargeLateFees(bid, curdate.AddDate(0, 0, 6))
+		fees, err := b.ChargeLateFees(bid, asOf)
+		again, errAgain := b.ChargeLateFees(bid, asOf.AddDate(0, 0, 1))
+
+		// assert
+		assert.NoError(t, errEarly)
+		assert.Empty(t, early)
+		assert.NoError(t, err)
+		require.Len(t, fees, 2)
+		assert.Equal(t, 1, fees[0].InstallmentSeq)
+		assert.Equal(t, LateFeeFixed, fees[0].Kind)
+		assert.Equal(t, NewMoney(10_000, CurrencyIDR), fees[0].Amount)
+		assert.Equal(t, LateFeeOverduePercentage, fees[1].Kind)
+		assert.Equal(t, NewMoney(5_500, CurrencyIDR), fees[1].Amount)
+		assert.NoError(t, errAgain)
+		assert.Empty(t, again)
+
+		outstanding, err := b.GetOutstanding(bid, asOf)
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(5_000_000, CurrencyIDR), outstanding.Principal)
+		assert.Equal(t, NewMoney(500_000, CurrencyIDR), outstanding.Interest)
+		assert.Equal(t, NewMoney(15_500, CurrencyIDR), outstanding.Fees)
+		assert.Equal(t, NewMoney(5_515_500, CurrencyIDR), outstanding.Outstanding)
+
+		before, err := b.GetOutstanding(bid, curdate.AddDate(0, 0, 7))
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(0, CurrencyIDR), before.Fees)
+	})
+
+	t.Run("penalty_interest_capped", func(t *testing.T) {
+		// arrange
+		b := newEngine(LateFeeRule{Kind: LateFeePenaltyInterest, Rate: 3.65, Cap: NewMoney(5_000, CurrencyIDR)}) // 1% of the overdue amount a day
+		bid := newBillable(t, b)
+		dueAt := curdate.AddDate(0, 0, 7)
+		now = dueAt.AddDate(0, 0, 6)
+		defer func() { now = curdate }()
+
+		// act
+		first, errFirst := b.ChargeLateFees(bid, dueAt.AddDate(0, 0, 3))
+		sameDay, errSameDay := b.ChargeLateFees(bid, dueAt.AddDate(0, 0, 3).Add(time.Hour))
+		second, errSecond := b.ChargeLateFees(bid, dueAt.AddDate(0, 0, 5))
+		capped, errCapped := b.ChargeLateFees(bid, dueAt.AddDate(0, 0, 6))
+
+		// assert
+		assert.NoError(t, errFirst)
+		require.Len(t, first, 1)
+		assert.Equal(t, NewMoney(3_300, CurrencyIDR), first[0].Amount)
+		assert.True(t, dueAt.AddDate(0, 0, 3).Equal(first[0].AccruedTo))
+		assert.NoError(t, errSameDay)
+		assert.Empty(t, sameDay)
+		assert.NoError(t, errSecond)
+		require.Len(t, second, 1)
+		assert.Equal(t, NewMoney(1_700, CurrencyIDR), second[0].Amount)
+		assert.NoError(t, errCapped)
+		assert.Empty(t, capped)
+	})
+
+	t.Run("paid_with_installment", func(t *testing.T) {
+		// arrange
+		b := newEngine(LateFeeRule{Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyIDR)})
+		bid := newBillable(t, b)
+		now = curdate.AddDate(0, 0, 8)
+		defer func() { now = curdate }()
+		_, err := b.ChargeLateFees(bid, time.Time{})
+		require.NoError(t, err)
+
+		// act
+		quote, errQuote := b.GetPayoffQuote(bid, time.Time{})
+		payment, errPay := b.MakePayment(bid, InputMakePayment{Amount: 120_000})
+		now = now.AddDate(0, 0, 1)
+		paidLate, errPaidLate := b.ChargeLateFees(bid, time.Time{})
+		settlement, errSettle := b.GetPayoffQuote(bid, time.Time{})
+		_, errSettled := b.SettleBillable(bid, InputMakePayment{Amount: settlement.PayoffAmount.Amount})
+
+		// assert
+		assert.NoError(t, errQuote)
+		assert.Equal(t, 10_000, quote.Fees.Amount)
+		assert.Equal(t, 5_500_000, quote.Outstanding.Amount)
+		assert.Equal(t, quote.Outstanding.Amount+quote.Fees.Amount-quote.InterestRebate.Amount, quote.PayoffAmount.Amount)
+		assert.NoError(t, errPay)
+		assert.Equal(t, NewMoney(10_000, CurrencyIDR), payment.AmountFees)
+		assert.NoError(t, errPaidLate)
+		assert.Empty(t, paidLate)
+		assert.NoError(t, errSettle)
+		assert.Equal(t, 0, settlement.Fees.Amount)
+		assert.NoError(t, errSettled)
+
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusPaidOff, billable.Status)
+		balance, err := b.GetTrialBalance()
+		assert.NoError(t, err)
+		assert.True(t, balance.Balanced)
+
+		// fees are part of the event history
+		require.NoError(t, b.RebuildProjection(bid))
+		fees, err := b.GetFees(bid)
+		assert.NoError(t, err)
+		assert.Len(t, fees, 1)
+	})
+
+	t.Run("per_currency", func(t *testing.T) {
+		// arrange
+		b := newEngine(
+			LateFeeRule{Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyIDR)},
+			LateFeeRule{Kind: LateFeeFixed, Amount: NewMoney(500, CurrencyUSD)},
+			LateFeeRule{Kind: LateFeeOverduePercentage, Rate: .05, Cap: NewMoney(1_000, CurrencyUSD)},
+		)
+		idrID := newBillable(t, b)
+		usdID := xid.New().String()
+		_, err := b.MakeBillable(InputMakeBillable{BID: usdID, BorrowerID: testBorrowerID, Principal: 5_000_000, Currency: CurrencyUSD})
+		require.NoError(t, err)
+		asOf := curdate.AddDate(0, 0, 8)
+		now = asOf
+		defer func() { now = curdate }()
+
+		// act
+		idrFees, errIDR := b.ChargeLateFees(idrID, asOf)
+		usdFees, errUSD := b.ChargeLateFees(usdID, asOf)
+
+		// assert
+		assert.NoError(t, errIDR)
+		require.Len(t, idrFees, 1)
+		assert.Equal(t, NewMoney(10_000, CurrencyIDR), idrFees[0].Amount)
+		assert.NoError(t, errUSD)
+		require.Len(t, usdFees, 2)
+		assert.Equal(t, NewMoney(500, CurrencyUSD), usdFees[0].Amount)
+		assert.Equal(t, NewMoney(1_000, CurrencyUSD), usdFees[1].Amount)
+	})
+
+	t.Run("future_as_of", func(t *testing.T) {
+		// arrange
+		b := newEngine(LateFeeRule{Kind: LateFeePenaltyInterest, Rate: 3.65})
+		bid := newBillable(t, b)
+		now = curdate.AddDate(0, 0, 8)
+		defer func() { now = curdate }()
+
+		// act
+		fees, err := b.ChargeLateFees(bid, now.AddDate(0, 0, 30))
+		charged, errCharged := b.GetFees(bid)
+
+		// assert
+		assert.Error(t, err)
+		assert.Empty(t, fees)
+		assert.NoError(t, errCharged)
+		assert.Empty(t, charged)
+	})
+
+	t.Run("bad_rules", func(t *testing.T) {
+		for _, rules := range [][]LateFeeRule{
+			{{Kind: "daily_flat"}},
+			{{Kind: LateFeeFixed, Amount: NewMoney(-1, CurrencyIDR)}},
+			{{Kind: LateFeeFixed, Amount: Money{Amount: 10_000}}},
+			{{Kind: LateFeeFixed, Amount: NewMoney(10_000, "XXX")}},
+			{{Kind: LateFeePenaltyInterest, Rate: .36, Amount: NewMoney(10_000, CurrencyIDR), Cap: NewMoney(50_000, CurrencyUSD)}},
+			{{Kind: LateFeeOverduePercentage, Rate: .05}, {Kind: LateFeeOverduePercentage, Rate: .05, Cap: NewMoney(50_000, CurrencyIDR)}},
+			{{Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyIDR)}, {Kind: LateFeeFixed, Amount: NewMoney(20_000, CurrencyIDR)}},
+		} {
+			// act
+			_, err := NewBillerEngine(BillerEngineConfig{
+				Store:                               setupTestStore(),
+				GenerateCurrentDate:                 time.Now,
+				DefaultLoanDurationWeeks:            50,
+				DefaultInterestRatePercentage:       .1,
+				PaymentSkipCountDeliquencyThreshold: 2,
+				LateFeeRules:                        rules,
+			})
+
+			// assert
+			assert.Error(t, err)
+		}
+	})
+}
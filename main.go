@@ -2,14 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"time"
 )
 
 const (
-	ConfigDBAddress = "./db.sqlite"
-	Port            = 5001
+	ConfigDBAddress   = "./db.sqlite"
+	ConfigHolidayFile = "./holidays.csv" // optional, date and name per line, .yaml files work too
+	Port              = 5001
 )
 
 func main() {
@@ -19,19 +22,93 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	db.SetMaxOpenConns(1) // sqlite allows a single writer, queue statements instead of failing with busy errors
+
+	store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+	if err != nil {
+		err = fmt.Errorf("store setup failed: %w", err)
+		log.Fatal(err)
+	}
+	if err = store.Migrate(); err != nil {
+		err = fmt.Errorf("db migration failed: %w", err)
+		log.Fatal(err)
+	}
+
+	holidays, err := LoadHolidayCalendar(ConfigHolidayFile)
+	if errors.Is(err, os.ErrNotExist) {
+		holidays, err = NewHolidayCalendarFile(ConfigHolidayFile), nil
+	}
+	if err != nil {
+		err = fmt.Errorf("holiday calendar setup failed: %w", err)
+		log.Fatal(err)
+	}
 
 	billerengine, err := NewBillerEngine(BillerEngineConfig{
-		Storage:                             db,
+		Store:                               store,
 		GenerateCurrentDate:                 func() time.Time { return time.Now() },
+		DefaultCurrency:                     CurrencyIDR,
+		DefaultInterestModel:                InterestModelFlat,
+		DefaultTimezone:                     "Asia/Jakarta",
+		DefaultGraceDays:                    3,
+		DefaultGraceCutoff:                  "17:00",
+		BusinessDayConvention:               BusinessDayFollowing,
+		Holidays:                            holidays,
 		DefaultLoanDurationWeeks:            50,
 		DefaultInterestRatePercentage:       .1,
 		PaymentSkipCountDeliquencyThreshold: 2,
+		MinLoanDurationWeeks:                4,
+		MaxLoanDurationWeeks:                104,
+		MaxInterestRatePercentage:           .5,
+		PaymentPolicy:                       PaymentPolicyStrict,
+		PayoffInterestRebatePercentage:      1,
+		LateFeeRules: []LateFeeRule{
+			{Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyIDR)},
+			{Kind: LateFeePenaltyInterest, Rate: .36, Cap: NewMoney(50_000, CurrencyIDR)},
+		},
+		AllocationOrder: []AllocationComponent{AllocationPenalties, AllocationFees, AllocationInterest, AllocationPrincipal},
+		ProductDelinquencyPolicies: map[string]DelinquencyPolicy{
+			"paylater": CompositePolicy{Operator: CompositeAny, Policies: []DelinquencyPolicy{
+				ConsecutiveMissedPolicy{Count: 2},
+				DaysPastDuePolicy{Days: 30},
+			}},
+		},
+		IdempotencyKeyTTL: 24 * time.Hour,
+		GLAccounts: GLAccounts{
+			Cash:             "1000",
+			LoanReceivable:   "1200",
+			UnearnedInterest: "2100",
+			CustomerCredit:   "2200",
+			InterestIncome:   "4000",
+			FeeIncome:        "4100",
+			LoanLossExpense:  "5000",
+		},
 	})
 	if err != nil {
 		err = fmt.Errorf("engine setup failed: %w", err)
 		log.Fatal(err)
 	}
 
+	// billables stored before the event log get their history recorded
+	recorded, err := billerengine.BackfillEvents()
+	if err != nil {
+		err = fmt.Errorf("event backfill failed: %w", err)
+		log.Fatal(err)
+	}
+	if recorded > 0 {
+		fmt.Printf("recorded history of %d billables stored before events\n", recorded)
+	}
+
+	// regenerate read models from the event log instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-projections" {
+		rebuilt, err := billerengine.RebuildProjections()
+		if err != nil {
+			err = fmt.Errorf("projection rebuild failed: %w", err)
+			log.Fatal(err)
+		}
+		fmt.Printf("rebuilt %d billables from events\n", rebuilt)
+		return
+	}
+
 	server, err := NewServer(ServerConfig{
 		StartTime:    time.Now(),
 		BillerEngine: billerengine,
@@ -0,0 +1,726 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps everything in process memory, like the prototype's
+// arrays. Transactions run one at a time against a copy of the data that
+// replaces the live data on success.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data *memoryData
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: newMemoryData()}
+}
+
+func (s *MemoryStore) Transact(fn func(tx BillerRepository) error) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	draft := s.data.clone()
+	if err = fn(draft); err != nil {
+		return
+	}
+	s.data = draft
+	return
+}
+
+func (s *MemoryStore) InsertBillable(billable Billable) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertBillable(billable)
+}
+
+func (s *MemoryStore) GetBillable(bID string) (Billable, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.GetBillable(bID)
+}
+
+func (s *MemoryStore) UpdateBillableStatus(bID string, from, to BillableStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.UpdateBillableStatus(bID, from, to)
+}
+
+func (s *MemoryStore) InsertBorrower(borrower Borrower) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertBorrower(borrower)
+}
+
+func (s *MemoryStore) GetBorrower(borrowerID string) (Borrower, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.GetBorrower(borrowerID)
+}
+
+func (s *MemoryStore) ListBorrowers() ([]Borrower, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListBorrowers()
+}
+
+func (s *MemoryStore) UpdateBorrower(borrower Borrower) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.UpdateBorrower(borrower)
+}
+
+func (s *MemoryStore) DeleteBorrower(borrowerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.DeleteBorrower(borrowerID)
+}
+
+func (s *MemoryStore) ListBorrowerBillables(borrowerID string) ([]Billable, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListBorrowerBillables(borrowerID)
+}
+
+func (s *MemoryStore) InsertTransition(transition BillableTransition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertTransition(transition)
+}
+
+func (s *MemoryStore) ListTransitions(bID string) ([]BillableTransition, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListTransitions(bID)
+}
+
+func (s *MemoryStore) InsertInstallments(installments []Installment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertInstallments(installments)
+}
+
+func (s *MemoryStore) ListInstallments(bID string) ([]Installment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListInstallments(bID)
+}
+
+func (s *MemoryStore) UpdateInstallment(installment Installment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.UpdateInstallment(installment)
+}
+
+func (s *MemoryStore) InsertPayment(payment Payment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertPayment(payment)
+}
+
+func (s *MemoryStore) GetPayment(paymentID string) (Payment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.GetPayment(paymentID)
+}
+
+func (s *MemoryStore) ListPayments(bID string) ([]Payment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListPayments(bID)
+}
+
+func (s *MemoryStore) InsertFee(fee Fee) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertFee(fee)
+}
+
+func (s *MemoryStore) ListFees(bID string) ([]Fee, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListFees(bID)
+}
+
+func (s *MemoryStore) InsertDelinquencyEpisode(episode DelinquencyEpisode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertDelinquencyEpisode(episode)
+}
+
+func (s *MemoryStore) UpdateDelinquencyEpisode(episode DelinquencyEpisode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.UpdateDelinquencyEpisode(episode)
+}
+
+func (s *MemoryStore) ListDelinquencyEpisodes(bID string) ([]DelinquencyEpisode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListDelinquencyEpisodes(bID)
+}
+
+func (s *MemoryStore) InsertRule(rule Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertRule(rule)
+}
+
+func (s *MemoryStore) GetRule(ruleID string) (Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.GetRule(ruleID)
+}
+
+func (s *MemoryStore) ListRules() ([]Rule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListRules()
+}
+
+func (s *MemoryStore) UpdateRule(rule Rule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.UpdateRule(rule)
+}
+
+func (s *MemoryStore) AppendEvent(event BillableEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.AppendEvent(event)
+}
+
+func (s *MemoryStore) ListEvents(bID string) ([]BillableEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListEvents(bID)
+}
+
+func (s *MemoryStore) LastEvent(bID string) (BillableEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.LastEvent(bID)
+}
+
+func (s *MemoryStore) ListEventStreams() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListEventStreams()
+}
+
+func (s *MemoryStore) ListBillablesWithoutEvents() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListBillablesWithoutEvents()
+}
+
+func (s *MemoryStore) DeleteProjections(bID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.DeleteProjections(bID)
+}
+
+func (s *MemoryStore) InsertJournalEntry(entry JournalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertJournalEntry(entry)
+}
+
+func (s *MemoryStore) ListJournalEntries(bID string) ([]JournalEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListJournalEntries(bID)
+}
+
+func (s *MemoryStore) ListAccountTotals() ([]AccountBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.ListAccountTotals()
+}
+
+func (s *MemoryStore) InsertIdempotencyKey(record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.InsertIdempotencyKey(record)
+}
+
+func (s *MemoryStore) GetIdempotencyKey(key string) (IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.data.GetIdempotencyKey(key)
+}
+
+func (s *MemoryStore) UpdateIdempotencyResponse(key string, response string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.UpdateIdempotencyResponse(key, response)
+}
+
+func (s *MemoryStore) DeleteIdempotencyKey(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.DeleteIdempotencyKey(key)
+}
+
+// ***
+
+// memoryData holds the records of a MemoryStore. It does no locking of its
+// own, the store guards it.
+type memoryData struct {
+	borrowers       map[string]Borrower
+	billables       map[string]Billable
+	transitions     map[string][]BillableTransition // by billable id
+	installments    map[string][]Installment        // by billable id, in sequence
+	payments        map[string]Payment
+	paymentIDs      map[string][]string             // by billable id
+	fees            map[string][]Fee                // by billable id, in charging order
+	episodes        map[string][]DelinquencyEpisode // by billable id, oldest first
+	events          map[string][]BillableEvent      // by billable id, in sequence
+	journal         []JournalEntry                  // in posting order
+	rules           []Rule                          // in creation order
+	idempotencyKeys map[string]IdempotencyRecord
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		borrowers:       map[string]Borrower{},
+		billables:       map[string]Billable{},
+		transitions:     map[string][]BillableTransition{},
+		installments:    map[string][]Installment{},
+		payments:        map[string]Payment{},
+		paymentIDs:      map[string][]string{},
+		fees:            map[string][]Fee{},
+		episodes:        map[string][]DelinquencyEpisode{},
+		events:          map[string][]BillableEvent{},
+		idempotencyKeys: map[string]IdempotencyRecord{},
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	out := newMemoryData()
+	for k, v := range d.borrowers {
+		out.borrowers[k] = v
+	}
+	for k, v := range d.billables {
+		out.billables[k] = v
+	}
+	for k, v := range d.transitions {
+		out.transitions[k] = append([]BillableTransition(nil), v...)
+	}
+	for k, v := range d.installments {
+		out.installments[k] = append([]Installment(nil), v...)
+	}
+	for k, v := range d.payments {
+		out.payments[k] = v
+	}
+	for k, v := range d.paymentIDs {
+		out.paymentIDs[k] = append([]string(nil), v...)
+	}
+	for k, v := range d.fees {
+		out.fees[k] = append([]Fee(nil), v...)
+	}
+	for k, v := range d.episodes {
+		out.episodes[k] = append([]DelinquencyEpisode(nil), v...)
+	}
+	for k, v := range d.events {
+		out.events[k] = append([]BillableEvent(nil), v...)
+	}
+	out.journal = append([]JournalEntry(nil), d.journal...)
+	out.rules = append([]Rule(nil), d.rules...)
+	for k, v := range d.idempotencyKeys {
+		out.idempotencyKeys[k] = v
+	}
+	return out
+}
+
+func (d *memoryData) InsertBillable(billable Billable) error {
+	if _, ok := d.billables[billable.ID]; ok {
+		return fmt.Errorf("%w: billable %s", ErrStoreDuplicateID, billable.ID)
+	}
+	d.billables[billable.ID] = billable
+	return nil
+}
+
+func (d *memoryData) GetBillable(bID string) (Billable, error) {
+	billable, ok := d.billables[bID]
+	if !ok {
+		return Billable{}, ErrStoreNotFound
+	}
+	return billable, nil
+}
+
+func (d *memoryData) UpdateBillableStatus(bID string, from, to BillableStatus) error {
+	billable, ok := d.billables[bID]
+	if !ok || billable.Status != from {
+		return ErrStoreConflict
+	}
+	billable.Status = to
+	d.billables[bID] = billable
+	return nil
+}
+
+func (d *memoryData) InsertBorrower(borrower Borrower) error {
+	if _, ok := d.borrowers[borrower.ID]; ok {
+		return fmt.Errorf("%w: borrower %s", ErrStoreDuplicateID, borrower.ID)
+	}
+	d.borrowers[borrower.ID] = borrower
+	return nil
+}
+
+func (d *memoryData) GetBorrower(borrowerID string) (Borrower, error) {
+	borrower, ok := d.borrowers[borrowerID]
+	if !ok {
+		return Borrower{}, ErrStoreNotFound
+	}
+	return borrower, nil
+}
+
+func (d *memoryData) ListBorrowers() (out []Borrower, err error) {
+	for _, borrower := range d.borrowers {
+		out = append(out, borrower)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return
+}
+
+func (d *memoryData) UpdateBorrower(borrower Borrower) error {
+	existing, ok := d.borrowers[borrower.ID]
+	if !ok {
+		return ErrStoreNotFound
+	}
+	existing.Name = borrower.Name
+	existing.UpdatedAt = borrower.UpdatedAt
+	d.borrowers[borrower.ID] = existing
+	return nil
+}
+
+func (d *memoryData) DeleteBorrower(borrowerID string) error {
+	if _, ok := d.borrowers[borrowerID]; !ok {
+		return ErrStoreNotFound
+	}
+	delete(d.borrowers, borrowerID)
+	return nil
+}
+
+func (d *memoryData) ListBorrowerBillables(borrowerID string) (out []Billable, err error) {
+	for _, billable := range d.billables {
+		if billable.BorrowerID == borrowerID {
+			out = append(out, billable)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return
+}
+
+func (d *memoryData) InsertTransition(transition BillableTransition) error {
+	d.transitions[transition.BillableID] = append(d.transitions[transition.BillableID], transition)
+	return nil
+}
+
+func (d *memoryData) ListTransitions(bID string) ([]BillableTransition, error) {
+	out := append([]BillableTransition(nil), d.transitions[bID]...)
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (d *memoryData) InsertInstallments(installments []Installment) error {
+	for _, inst := range installments {
+		for _, existing := range d.installments[inst.BillableID] {
+			if existing.Seq == inst.Seq {
+				return fmt.Errorf("%w: installment %s/%d", ErrStoreDuplicateID, inst.BillableID, inst.Seq)
+			}
+		}
+		d.installments[inst.BillableID] = append(d.installments[inst.BillableID], inst)
+	}
+	for _, inst := range installments {
+		list := d.installments[inst.BillableID]
+		sort.Slice(list, func(i, j int) bool { return list[i].Seq < list[j].Seq })
+	}
+	return nil
+}
+
+func (d *memoryData) ListInstallments(bID string) ([]Installment, error) {
+	return append([]Installment(nil), d.installments[bID]...), nil
+}
+
+func (d *memoryData) UpdateInstallment(installment Installment) error {
+	list := d.installments[installment.BillableID]
+	for i := range list {
+		if list[i].Seq == installment.Seq {
+			list[i].AmountPaid = installment.AmountPaid
+			list[i].Status = installment.Status
+			return nil
+		}
+	}
+	return ErrStoreNotFound
+}
+
+func (d *memoryData) InsertPayment(payment Payment) error {
+	if _, ok := d.payments[payment.ID]; ok {
+		return fmt.Errorf("%w: payment %s", ErrStoreDuplicateID, payment.ID)
+	}
+	d.payments[payment.ID] = payment
+	d.paymentIDs[payment.BillableID] = append(d.paymentIDs[payment.BillableID], payment.ID)
+	return nil
+}
+
+func (d *memoryData) GetPayment(paymentID string) (Payment, error) {
+	payment, ok := d.payments[paymentID]
+	if !ok {
+		return Payment{}, ErrStoreNotFound
+	}
+	return payment, nil
+}
+
+func (d *memoryData) ListPayments(bID string) (out []Payment, err error) {
+	for _, id := range d.paymentIDs[bID] {
+		out = append(out, d.payments[id])
+	}
+	return
+}
+
+func (d *memoryData) InsertFee(fee Fee) error {
+	for _, existing := range d.fees[fee.BillableID] {
+		if existing.ID == fee.ID {
+			return fmt.Errorf("%w: fee %s", ErrStoreDuplicateID, fee.ID)
+		}
+	}
+	d.fees[fee.BillableID] = append(d.fees[fee.BillableID], fee)
+	return nil
+}
+
+func (d *memoryData) ListFees(bID string) (out []Fee, err error) {
+	out = append([]Fee(nil), d.fees[bID]...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].AccruedTo.Before(out[j].AccruedTo) })
+	return
+}
+
+func (d *memoryData) InsertDelinquencyEpisode(episode DelinquencyEpisode) error {
+	for _, existing := range d.episodes[episode.BillableID] {
+		if existing.ID == episode.ID {
+			return fmt.Errorf("%w: delinquency episode %s", ErrStoreDuplicateID, episode.ID)
+		}
+	}
+	d.episodes[episode.BillableID] = append(d.episodes[episode.BillableID], episode)
+	return nil
+}
+
+func (d *memoryData) UpdateDelinquencyEpisode(episode DelinquencyEpisode) error {
+	episodes := d.episodes[episode.BillableID]
+	for i, existing := range episodes {
+		if existing.ID == episode.ID {
+			existing.EndedAt = episode.EndedAt
+			existing.EndStatus = episode.EndStatus
+			existing.MaxDaysPastDue = episode.MaxDaysPastDue
+			existing.MaxArrears = episode.MaxArrears
+			episodes[i] = existing
+			return nil
+		}
+	}
+	return ErrStoreNotFound
+}
+
+func (d *memoryData) ListDelinquencyEpisodes(bID string) (out []DelinquencyEpisode, err error) {
+	out = append([]DelinquencyEpisode(nil), d.episodes[bID]...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return
+}
+
+func (d *memoryData) InsertRule(rule Rule) error {
+	for _, existing := range d.rules {
+		if existing.ID == rule.ID {
+			return fmt.Errorf("%w: rule %s", ErrStoreDuplicateID, rule.ID)
+		}
+	}
+	d.rules = append(d.rules, rule)
+	return nil
+}
+
+func (d *memoryData) GetRule(ruleID string) (Rule, error) {
+	for _, rule := range d.rules {
+		if rule.ID == ruleID {
+			return rule, nil
+		}
+	}
+	return Rule{}, ErrStoreNotFound
+}
+
+func (d *memoryData) ListRules() ([]Rule, error) {
+	return append([]Rule(nil), d.rules...), nil
+}
+
+func (d *memoryData) UpdateRule(rule Rule) error {
+	for i, existing := range d.rules {
+		if existing.ID == rule.ID {
+			existing.Active = rule.Active
+			existing.UpdatedAt = rule.UpdatedAt
+			d.rules[i] = existing
+			return nil
+		}
+	}
+	return ErrStoreNotFound
+}
+
+func (d *memoryData) AppendEvent(event BillableEvent) error {
+	events := d.events[event.BillableID]
+	if len(events) > 0 && events[len(events)-1].Seq >= event.Seq {
+		return fmt.Errorf("%w: event %s/%d", ErrStoreDuplicateID, event.BillableID, event.Seq)
+	}
+	d.events[event.BillableID] = append(events, event)
+	return nil
+}
+
+func (d *memoryData) ListEvents(bID string) ([]BillableEvent, error) {
+	return append([]BillableEvent(nil), d.events[bID]...), nil
+}
+
+func (d *memoryData) LastEvent(bID string) (BillableEvent, error) {
+	events := d.events[bID]
+	if len(events) == 0 {
+		return BillableEvent{}, ErrStoreNotFound
+	}
+	return events[len(events)-1], nil
+}
+
+func (d *memoryData) ListEventStreams() (out []string, err error) {
+	for bID := range d.events {
+		out = append(out, bID)
+	}
+	sort.Strings(out)
+	return
+}
+
+func (d *memoryData) ListBillablesWithoutEvents() (out []string, err error) {
+	var billables []Billable
+	for bID, billable := range d.billables {
+		if len(d.events[bID]) == 0 {
+			billables = append(billables, billable)
+		}
+	}
+	sort.Slice(billables, func(i, j int) bool {
+		if !billables[i].CreatedAt.Equal(billables[j].CreatedAt) {
+			return billables[i].CreatedAt.Before(billables[j].CreatedAt)
+		}
+		return billables[i].ID < billables[j].ID
+	})
+	for _, billable := range billables {
+		out = append(out, billable.ID)
+	}
+	return
+}
+
+func (d *memoryData) DeleteProjections(bID string) error {
+	for _, id := range d.paymentIDs[bID] {
+		delete(d.payments, id)
+	}
+	delete(d.paymentIDs, bID)
+	delete(d.fees, bID)
+	delete(d.installments, bID)
+	delete(d.transitions, bID)
+	delete(d.billables, bID)
+	return nil
+}
+
+func (d *memoryData) InsertJournalEntry(entry JournalEntry) error {
+	for _, existing := range d.journal {
+		if existing.ID == entry.ID {
+			return fmt.Errorf("%w: journal entry %s", ErrStoreDuplicateID, entry.ID)
+		}
+	}
+	entry.Lines = append([]JournalLine(nil), entry.Lines...)
+	d.journal = append(d.journal, entry)
+	return nil
+}
+
+func (d *memoryData) ListJournalEntries(bID string) (out []JournalEntry, err error) {
+	for _, entry := range d.journal {
+		if entry.BillableID == bID {
+			entry.Lines = append([]JournalLine(nil), entry.Lines...)
+			out = append(out, entry)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].PostedAt.Equal(out[j].PostedAt) {
+			return out[i].PostedAt.Before(out[j].PostedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return
+}
+
+func (d *memoryData) ListAccountTotals() (out []AccountBalance, err error) {
+	type key struct {
+		account  string
+		currency Currency
+	}
+	totals := map[key]AccountBalance{}
+	for _, entry := range d.journal {
+		for _, line := range entry.Lines {
+			k := key{line.Account, entry.Currency}
+			total := totals[k]
+			total.Account = line.Account
+			total.Currency = entry.Currency
+			total.Debit += line.Debit
+			total.Credit += line.Credit
+			totals[k] = total
+		}
+	}
+	for _, total := range totals {
+		out = append(out, total)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Account != out[j].Account {
+			return out[i].Account < out[j].Account
+		}
+		return out[i].Currency < out[j].Currency
+	})
+	return
+}
+
+func (d *memoryData) InsertIdempotencyKey(record IdempotencyRecord) error {
+	if _, ok := d.idempotencyKeys[record.Key]; ok {
+		return fmt.Errorf("%w: idempotency key %s", ErrStoreDuplicateID, record.Key)
+	}
+	d.idempotencyKeys[record.Key] = record
+	return nil
+}
+
+func (d *memoryData) GetIdempotencyKey(key string) (IdempotencyRecord, error) {
+	record, ok := d.idempotencyKeys[key]
+	if !ok {
+		return IdempotencyRecord{}, ErrStoreNotFound
+	}
+	return record, nil
+}
+
+func (d *memoryData) UpdateIdempotencyResponse(key string, response string) error {
+	record, ok := d.idempotencyKeys[key]
+	if !ok {
+		return ErrStoreNotFound
+	}
+	record.Response = response
+	d.idempotencyKeys[key] = record
+	return nil
+}
+
+func (d *memoryData) DeleteIdempotencyKey(key string) error {
+	delete(d.idempotencyKeys, key)
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testBillerStore(t, func() BillerStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestMemoryStore_ReturnsCopies(t *testing.T) {
+	// arrange
+	store := NewMemoryStore()
+	billable := Billable{ID: xid.New().String(), Principal: NewMoney(5_000_000, CurrencyIDR), Tenor: 50, InterestRate: .1, InterestModel: InterestModelFlat, CreatedAt: time.Now()}
+	installments, err := makeInstallments(billable, dueDatesOf(t, billable))
+	require.NoError(t, err)
+	require.NoError(t, store.InsertBillable(billable))
+	require.NoError(t, store.InsertInstallments(installments))
+
+	// act
+	installments, err = store.ListInstallments(billable.ID)
+	require.NoError(t, err)
+	installments[0].AmountPaid = 110_000
+
+	// assert
+	stored, err := store.ListInstallments(billable.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stored[0].AmountPaid)
+}
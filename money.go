@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrMoneyOverflow    = errors.New("money amount overflow")
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+const (
+	CurrencyIDR Currency = "IDR"
+	CurrencyUSD Currency = "USD"
+	CurrencyEUR Currency = "EUR"
+	CurrencySGD Currency = "SGD"
+	CurrencyJPY Currency = "JPY"
+	CurrencyKWD Currency = "KWD"
+)
+
+// currencyMinorUnits holds the number of decimals of each supported currency.
+var currencyMinorUnits = map[Currency]int{
+	CurrencyIDR: 2,
+	CurrencyUSD: 2,
+	CurrencyEUR: 2,
+	CurrencySGD: 2,
+	CurrencyJPY: 0,
+	CurrencyKWD: 3,
+}
+
+func (c Currency) IsSupported() bool {
+	_, ok := currencyMinorUnits[c]
+	return ok
+}
+
+// MinorUnits returns how many decimals separate the major from the minor unit.
+func (c Currency) MinorUnits() int {
+	return currencyMinorUnits[c]
+}
+
+type RoundingMode string
+
+const (
+	RoundingUp       RoundingMode = "up"        // towards positive infinity
+	RoundingDown     RoundingMode = "down"      // towards negative infinity
+	RoundingHalfUp   RoundingMode = "half_up"   // nearest, halves away from zero
+	RoundingHalfEven RoundingMode = "half_even" // nearest, halves to the even neighbour
+)
+
+// Money is an amount counted in the minor unit of its currency, so
+// Money{Amount: 150, Currency: CurrencyUSD} is USD 1.50.
+type Money struct {
+	Amount   int      `json:"amount"`
+	Currency Currency `json:"currency"`
+}
+
+func NewMoney(amount int, currency Currency) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) Add(other Money) (out Money, err error) {
+	if err = m.sameCurrency(other); err != nil {
+		return
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		err = fmt.Errorf("%w: %s + %s", ErrMoneyOverflow, m, other)
+		return
+	}
+	out = Money{Amount: sum, Currency: m.Currency}
+	return
+}
+
+func (m Money) Sub(other Money) (out Money, err error) {
+	if other.Amount == math.MinInt {
+		err = fmt.Errorf("%w: %s - %s", ErrMoneyOverflow, m, other)
+		return
+	}
+	return m.Add(other.Neg())
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// MulRate multiplies the amount by rate and rounds the result back to minor
+// units with mode. The rate is taken at its shortest decimal form, 0.1 is
+// exactly one tenth rather than its nearest binary float.
+func (m Money) MulRate(rate float64, mode RoundingMode) (out Money, err error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	if !ok {
+		err = fmt.Errorf("bad rate: %v", rate)
+		return
+	}
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(int64(m.Amount)), r)
+
+	rounded, err := roundRat(product, mode)
+	if err != nil {
+		return
+	}
+	if !rounded.IsInt64() || rounded.Int64() > math.MaxInt || rounded.Int64() < math.MinInt {
+		err = fmt.Errorf("%w: %s * %v", ErrMoneyOverflow, m, rate)
+		return
+	}
+	out = Money{Amount: int(rounded.Int64()), Currency: m.Currency}
+	return
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// String formats the amount in major units, such as "IDR 55000.00".
+func (m Money) String() string {
+	units := m.Currency.MinorUnits()
+	amount := new(big.Rat).SetFrac(big.NewInt(int64(m.Amount)), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(units)), nil))
+	return fmt.Sprintf("%s %s", m.Currency, amount.FloatString(units))
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+func roundRat(x *big.Rat, mode RoundingMode) (out *big.Int, err error) {
+	// quotient truncated towards zero, remainder carries the sign of x
+	quo, rem := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if rem.Sign() == 0 {
+		return quo, nil
+	}
+
+	// compare twice the remainder against the denominator to find halves
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmpHalf := half.Cmp(x.Denom())
+
+	awayFromZero := false
+	switch mode {
+	case RoundingUp:
+		awayFromZero = x.Sign() > 0
+	case RoundingDown:
+		awayFromZero = x.Sign() < 0
+	case RoundingHalfUp:
+		awayFromZero = cmpHalf >= 0
+	case RoundingHalfEven:
+		awayFromZero = cmpHalf > 0 || (cmpHalf == 0 && quo.Bit(0) == 1)
+	default:
+		err = fmt.Errorf("unknown rounding mode %s", mode)
+		return
+	}
+
+	out = quo
+	if awayFromZero {
+		out.Add(out, big.NewInt(int64(x.Sign())))
+	}
+	return
+}
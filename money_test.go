@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoney_Arithmetic(t *testing.T) {
+	t.Run("add_and_sub", func(t *testing.T) {
+		// arrange
+		a := NewMoney(150, CurrencyUSD)
+		b := NewMoney(75, CurrencyUSD)
+
+		// act
+		sum, errSum := a.Add(b)
+		diff, errDiff := b.Sub(a)
+
+		// assert
+		assert.NoError(t, errSum)
+		assert.Equal(t, NewMoney(225, CurrencyUSD), sum)
+		assert.NoError(t, errDiff)
+		assert.Equal(t, NewMoney(-75, CurrencyUSD), diff)
+	})
+
+	t.Run("currency_mismatch", func(t *testing.T) {
+		// arrange
+		a := NewMoney(150, CurrencyUSD)
+		b := NewMoney(150, CurrencyEUR)
+
+		// act
+		_, errAdd := a.Add(b)
+		_, errSub := a.Sub(b)
+
+		// assert
+		assert.ErrorIs(t, errAdd, ErrCurrencyMismatch)
+		assert.ErrorIs(t, errSub, ErrCurrencyMismatch)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		// arrange
+		max := NewMoney(math.MaxInt, CurrencyUSD)
+		min := NewMoney(math.MinInt, CurrencyUSD)
+
+		// act
+		_, errAdd := max.Add(NewMoney(1, CurrencyUSD))
+		_, errSub := NewMoney(0, CurrencyUSD).Sub(min)
+		_, errMul := max.MulRate(2, RoundingDown)
+
+		// assert
+		assert.ErrorIs(t, errAdd, ErrMoneyOverflow)
+		assert.ErrorIs(t, errSub, ErrMoneyOverflow)
+		assert.ErrorIs(t, errMul, ErrMoneyOverflow)
+	})
+}
+
+func TestMoney_MulRate(t *testing.T) {
+	tests := []struct {
+		amount int
+		rate   float64
+		mode   RoundingMode
+		want   int
+	}{
+		{5_000_000, .1, RoundingUp, 500_000}, // exact, no float residue
+		{1_001, .1, RoundingUp, 101},
+		{1_001, .1, RoundingDown, 100},
+		{-1_001, .1, RoundingUp, -100},
+		{-1_001, .1, RoundingDown, -101},
+		{25, .1, RoundingHalfUp, 3},
+		{-25, .1, RoundingHalfUp, -3},
+		{25, .1, RoundingHalfEven, 2},
+		{35, .1, RoundingHalfEven, 4},
+		{26, .1, RoundingHalfEven, 3},
+	}
+	for _, tt := range tests {
+		// act
+		out, err := NewMoney(tt.amount, CurrencyIDR).MulRate(tt.rate, tt.mode)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(tt.want, CurrencyIDR), out, "%d * %v rounding %s", tt.amount, tt.rate, tt.mode)
+	}
+
+	_, err := NewMoney(1, CurrencyIDR).MulRate(.5, "sideways")
+	assert.Error(t, err)
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "IDR 55000.00", NewMoney(5_500_000, CurrencyIDR).String())
+	assert.Equal(t, "JPY 1102", NewMoney(1_102, CurrencyJPY).String())
+	assert.Equal(t, "KWD -1.005", NewMoney(-1_005, CurrencyKWD).String())
+}
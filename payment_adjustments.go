@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	validator "github.com/avrebarra/minivalidator"
+	"github.com/rs/xid"
+)
+
+func (b *BillerEngine) GetPayments(bID string) (out []Payment, err error) {
+	// validate required inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+
+	if _, err = b.Conf.Store.GetBillable(bID); err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+
+	out, err = b.getPayments(b.Conf.Store, bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching payments: %w", err)
+		return
+	}
+	return
+}
+
+// ReversePayment cancels a payment by appending a compensating entry dated at
+// the original payment, then rebuilds balances, schedule and status after it.
+// Only payments of open or paid off billables can be reversed.
+func (b *BillerEngine) ReversePayment(paymentID string, in InputReversePayment) (out PaymentReceipt, err error) {
+	// validate inputs
+	if paymentID == "" {
+		err = fmt.Errorf("bad input: payment id not defined")
+		return
+	}
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	// lock the billable the payment belongs to before touching its ledger
+	orig, err := b.Conf.Store.GetPayment(paymentID)
+	if err != nil {
+		err = fmt.Errorf("payment not found: id %s", paymentID)
+		return
+	}
+	unlock := b.lockBillable(orig.BillableID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		// retrieve the original payment
+		orig, err = tx.GetPayment(paymentID)
+		if err != nil {
+			err = fmt.Errorf("payment not found: id %s", paymentID)
+			return
+		}
+		if orig.Kind != PaymentKindPayment {
+			err = fmt.Errorf("only payments can be reversed: kind %s", orig.Kind)
+			return
+		}
+
+		// written off and cancelled billables keep their ledger as it was closed
+		billable, err := tx.GetBillable(orig.BillableID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", orig.BillableID)
+			return
+		}
+		if !billable.Status.IsOpen() && billable.Status != BillableStatusPaidOff {
+			err = fmt.Errorf("billable is not accepting reversals: status %s", billable.Status)
+			return
+		}
+
+		payments, err := b.getPayments(tx, orig.BillableID)
+		if err != nil {
+			err = fmt.Errorf("failed checking reversals: %w", err)
+			return
+		}
+		for _, p := range payments {
+			if p.ReversesID == paymentID {
+				err = fmt.Errorf("payment already reversed: reversal id %s", p.ID)
+				return
+			}
+		}
+
+		// the reversal takes back exactly what the payment was allocated to
+		reversal := Payment{
+			ID:                xid.New().String(),
+			BillableID:        orig.BillableID,
+			Kind:              PaymentKindReversal,
+			Amount:            orig.Amount.Neg(),
+			AmountAccumulated: NewMoney(0, orig.Amount.Currency),
+			AmountPrincipal:   orig.AmountPrincipal.Neg(),
+			AmountInterest:    orig.AmountInterest.Neg(),
+			AmountFees:        orig.AmountFees.Neg(),
+			AmountPenalties:   orig.AmountPenalties.Neg(),
+			AmountUnallocated: orig.AmountUnallocated.Neg(),
+			AmountRebated:     orig.AmountRebated.Neg(),
+			ReversesID:        orig.ID,
+			Reason:            in.Reason,
+			PaidAt:            orig.PaidAt,
+			CreatedAt:         b.Conf.GenerateCurrentDate(),
+		}
+		if err = b.insertPayment(tx, reversal); err != nil {
+			return
+		}
+
+		if out.Payment, err = b.rebuildBillable(tx, reversal, "reopened by payment reversal"); err != nil {
+			return
+		}
+
+		// the status changes along with the reversal
+		out.Status, err = b.resyncDelinquency(tx, orig.BillableID)
+		return
+	})
+	return
+}
+
+// RefundOverpayment returns credit left over after a billable was overpaid.
+func (b *BillerEngine) RefundOverpayment(bID string, in InputRefundOverpayment) (out PaymentReceipt, err error) {
+	// validate inputs
+	if bID == "" {
+		err = fmt.Errorf("bad input: billable id not defined")
+		return
+	}
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	timestamp := b.Conf.GenerateCurrentDate()
+
+	unlock := b.lockBillable(bID)
+	defer unlock()
+
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		billable, err := tx.GetBillable(bID)
+		if err != nil {
+			err = fmt.Errorf("billable not found: id %s", bID)
+			return
+		}
+
+		payments, err := b.getPayments(tx, bID)
+		if err != nil {
+			err = fmt.Errorf("error fetching payments: %w", err)
+			return
+		}
+		credit := 0
+		for _, p := range payments {
+			if !p.PaidAt.After(timestamp) {
+				credit += p.AmountUnallocated.Amount
+			}
+		}
+		if in.Amount > credit {
+			err = fmt.Errorf("refund exceeds overpaid amount: overpaid %d", credit)
+			return
+		}
+
+		currency := billable.Amount.Currency
+		refund := withAllocation(Payment{
+			ID:                xid.New().String(),
+			BillableID:        bID,
+			Kind:              PaymentKindRefund,
+			Amount:            NewMoney(-in.Amount, currency),
+			AmountAccumulated: NewMoney(0, currency),
+			AmountUnallocated: NewMoney(-in.Amount, currency),
+			AmountRebated:     NewMoney(0, currency),
+			Reason:            in.Reason,
+			PaidAt:            timestamp,
+			CreatedAt:         timestamp,
+		}, Allocation{})
+		if err = b.insertPayment(tx, refund); err != nil {
+			return
+		}
+
+		// refunds only take back credit, the status stays as it is
+		out.Status = billable.Status
+		out.Payment, err = b.rebuildBillable(tx, refund, "")
+		return
+	})
+	return
+}
+
+func (b *BillerEngine) insertPayment(tx BillerRepository, p Payment) (err error) {
+	if err = b.recordEvent(tx, p.BillableID, eventTypeOf(p.Kind), p); err != nil {
+		return
+	}
+	err = b.postJournal(tx, p.BillableID, journalDescriptionOf(p.Kind), p.ID)
+	return
+}
+
+// rebuildBillable recomputes running balances and the installment schedule
+// after entry was appended, reopening the billable with reopenReason if it is
+// no longer paid off. It returns entry with its running balance.
+func (b *BillerEngine) rebuildBillable(tx BillerRepository, entry Payment, reopenReason string) (out Payment, err error) {
+	bID := entry.BillableID
+
+	payments, remaining, err := b.projectLedger(tx, bID)
+	if err != nil {
+		return
+	}
+	for _, p := range payments {
+		if p.ID == entry.ID {
+			out = p
+		}
+	}
+
+	billable, err := tx.GetBillable(bID)
+	if err != nil {
+		err = fmt.Errorf("billable not found: id %s", bID)
+		return
+	}
+	if billable.Status == BillableStatusPaidOff && remaining > 0 && reopenReason != "" {
+		_, err = b.transitionBillable(tx, bID, billable.Status, BillableStatusActive, reopenReason)
+	}
+	return
+}
+
+// projectLedger derives running balances and installment state from the
+// payment entries of the billable. It returns the entries in ledger order
+// and the amount left to pay, late fees included.
+func (b *BillerEngine) projectLedger(tx BillerRepository, bID string) (payments []Payment, remaining int, err error) {
+	payments, err = b.getPayments(tx, bID)
+	if err != nil {
+		err = fmt.Errorf("error fetching payments: %w", err)
+		return
+	}
+
+	installments, owed, err := b.owedOn(tx, bID, time.Time{})
+	if err != nil {
+		return
+	}
+	settled := settledAsOf(payments, time.Time{})
+	for _, inst := range scheduleAsOf(installments, settled.Principal+settled.Interest) {
+		if err = tx.UpdateInstallment(inst); err != nil {
+			err = fmt.Errorf("failed to update installment: %w", err)
+			return
+		}
+	}
+	remaining = totalOwed(owed).Total()
+	return
+}
+
+// resyncDelinquency reevaluates an open billable at the current date and
+// updates its status accordingly, within the transaction of the change that
+// called for it, returning the resulting status. Callers hold the billable
+// lock.
+func (b *BillerEngine) resyncDelinquency(tx BillerRepository, bID string) (out BillableStatus, err error) {
+	details, err := b.evaluateDelinquency(tx, bID, b.Conf.GenerateCurrentDate())
+	if err != nil {
+		err = fmt.Errorf("failed to evaluate delinquency: %w", err)
+		return
+	}
+	if out, err = b.syncDelinquencyStatus(tx, bID, details); err != nil {
+		err = fmt.Errorf("failed to sync billable status: %w", err)
+		return
+	}
+	return
+}
+
+// ***
+
+type InputReversePayment struct {
+	Reason string `validate:"required"`
+}
+
+type InputRefundOverpayment struct {
+	Amount int    `validate:"required,gt=0"`
+	Reason string `validate:"required"`
+}
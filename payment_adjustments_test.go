@@ -0,0 +1,245 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_ReversePayment(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now()
+	now := curdate
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return now },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+		PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+	})
+	require.NoError(t, err)
+
+	t.Run("middle_payment", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 21)
+
+		var payments []Payment
+		for _, day := range []int{7, 14, 21} {
+			p, err := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate.AddDate(0, 0, day)})
+			require.NoError(t, err)
+			payments = append(payments, p.Payment)
+		}
+
+		// act
+		out, err := b.ReversePayment(payments[1].ID, InputReversePayment{Reason: "bounced transfer"})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, PaymentKindReversal, out.Kind)
+		assert.Equal(t, -110_000, out.Amount.Amount)
+		assert.Equal(t, payments[1].ID, out.ReversesID)
+		assert.True(t, out.PaidAt.Equal(payments[1].PaidAt))
+		assert.Equal(t, BillableStatusActive, out.Status)
+
+		entries, err := b.GetPayments(bid)
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+		assert.Equal(t, []int{110_000, 220_000, 110_000, 220_000}, []int{
+			entries[0].AmountAccumulated.Amount, entries[1].AmountAccumulated.Amount,
+			entries[2].AmountAccumulated.Amount, entries[3].AmountAccumulated.Amount,
+		})
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 220_000, outstanding.Paid.Amount)
+
+		schedule, err := b.GetSchedule(bid)
+		require.NoError(t, err)
+		assert.Equal(t, InstallmentStatusPaid, schedule[1].Status)
+		assert.Equal(t, InstallmentStatusUnpaid, schedule[2].Status)
+	})
+
+	t.Run("already_reversed", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 7)
+		p, err := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate.AddDate(0, 0, 7)})
+		require.NoError(t, err)
+		reversal, err := b.ReversePayment(p.ID, InputReversePayment{Reason: "duplicate"})
+		require.NoError(t, err)
+
+		// act
+		_, errAgain := b.ReversePayment(p.ID, InputReversePayment{Reason: "duplicate"})
+		_, errReversal := b.ReversePayment(reversal.ID, InputReversePayment{Reason: "undo"})
+		_, errNoReason := b.ReversePayment(p.ID, InputReversePayment{})
+		_, errUnknown := b.ReversePayment("unknown", InputReversePayment{Reason: "duplicate"})
+
+		// assert
+		assert.Error(t, errAgain)
+		assert.Error(t, errReversal)
+		assert.Error(t, errNoReason)
+		assert.Error(t, errUnknown)
+	})
+
+	t.Run("reopens_paid_off", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 21)
+		p, err := b.MakePayment(bid, InputMakePayment{Amount: 5_500_000, PaidAt: curdate.AddDate(0, 0, 7)})
+		require.NoError(t, err)
+
+		// act
+		reversal, err := b.ReversePayment(p.ID, InputReversePayment{Reason: "chargeback"})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusDelinquent, reversal.Status)
+
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusDelinquent, billable.Status)
+
+		transitions, err := b.GetBillableTransitions(bid)
+		assert.NoError(t, err)
+		require.Len(t, transitions, 4)
+		assert.Equal(t, BillableStatusPaidOff, transitions[1].ToStatus)
+		assert.Equal(t, BillableStatusActive, transitions[2].ToStatus)
+		assert.Equal(t, "reopened by payment reversal", transitions[2].Reason)
+		assert.Equal(t, BillableStatusDelinquent, transitions[3].ToStatus)
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 5_500_000, outstanding.Outstanding.Amount)
+	})
+
+	t.Run("closed_billable", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		p, err := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate})
+		require.NoError(t, err)
+		_, err = b.TransitionBillable(bid, InputTransitionBillable{Status: BillableStatusWrittenOff, Reason: "uncollectible"})
+		require.NoError(t, err)
+
+		// act
+		_, err = b.ReversePayment(p.ID, InputReversePayment{Reason: "bounced transfer"})
+
+		// assert
+		assert.ErrorContains(t, err, "not accepting reversals")
+
+		entries, err := b.GetPayments(bid)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusWrittenOff, billable.Status)
+	})
+
+	t.Run("failed_status_sync", func(t *testing.T) {
+		// arrange
+		bid := xid.New().String()
+		now = curdate
+		_, err := b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+		require.NoError(t, err)
+		p, err := b.MakePayment(bid, InputMakePayment{Amount: 110_000, PaidAt: curdate})
+		require.NoError(t, err)
+		rule, err := b.CreateRule(InputCreateRule{Kind: RuleKindDelinquency, Name: "broken", Expression: "arrears / missed_installments > 1"})
+		require.NoError(t, err)
+		_, err = b.ActivateRule(rule.ID)
+		require.NoError(t, err)
+
+		// act
+		_, errFailed := b.ReversePayment(p.ID, InputReversePayment{Reason: "bounced transfer"})
+		failed, err := b.GetPayments(bid)
+		require.NoError(t, err)
+		_, err = b.DeactivateRule(rule.ID)
+		require.NoError(t, err)
+		_, errRetry := b.ReversePayment(p.ID, InputReversePayment{Reason: "bounced transfer"})
+
+		// assert
+		assert.ErrorContains(t, errFailed, "division by zero")
+		assert.Len(t, failed, 1) // the reversal rolls back with the status sync
+		assert.NoError(t, errRetry)
+
+		entries, err := b.GetPayments(bid)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+}
+
+func TestBillerEngine_RefundOverpayment(t *testing.T) {
+	store := setupTestStore()
+
+	curdate := time.Now()
+	b, err := NewBillerEngine(BillerEngineConfig{
+		Store:               store,
+		GenerateCurrentDate: func() time.Time { return curdate },
+
+		DefaultLoanDurationWeeks:            50,
+		DefaultInterestRatePercentage:       .1,
+		PaymentSkipCountDeliquencyThreshold: 2,
+		PaymentPolicy:                       PaymentPolicyAnyPositiveAmount,
+		AllowOverpayment:                    true,
+	})
+	require.NoError(t, err)
+
+	bid := xid.New().String()
+	_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: testBorrowerID, Principal: 5_000_000})
+	require.NoError(t, err)
+	_, err = b.MakePayment(bid, InputMakePayment{Amount: 5_600_000, PaidAt: curdate})
+	require.NoError(t, err)
+
+	t.Run("exceeds_credit", func(t *testing.T) {
+		// act
+		out, err := b.RefundOverpayment(bid, InputRefundOverpayment{Amount: 150_000, Reason: "overpaid"})
+
+		// assert
+		assert.Empty(t, out)
+		assert.Error(t, err)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		// act
+		out, err := b.RefundOverpayment(bid, InputRefundOverpayment{Amount: 100_000, Reason: "overpaid"})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, PaymentKindRefund, out.Kind)
+		assert.Equal(t, -100_000, out.Amount.Amount)
+		assert.Equal(t, 5_500_000, out.AmountAccumulated.Amount)
+
+		outstanding, err := b.GetOutstanding(bid, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, outstanding.Outstanding.Amount)
+
+		billable, err := b.GetBillable(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusPaidOff, billable.Status)
+	})
+
+	t.Run("nothing_left", func(t *testing.T) {
+		// act
+		_, err := b.RefundOverpayment(bid, InputRefundOverpayment{Amount: 1, Reason: "overpaid"})
+
+		// assert
+		assert.Error(t, err)
+	})
+}
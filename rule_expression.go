@@ -0,0 +1,561 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Rule expressions are a small language over numbers, strings and booleans,
+// with no loops, assignments or access to anything besides the variables
+// they are evaluated with, so any expression terminates and only computes a
+// value. It has arithmetic (+ - * / %), comparisons (== != < <= > >=), logic
+// (&& || !), the conditional `cond ? a : b`, and the functions min and max.
+// Expressions are type checked when parsed.
+
+const (
+	maxExpressionLength = 2000
+	maxExpressionDepth  = 50
+)
+
+type exprType string
+
+const (
+	exprNumber exprType = "number"
+	exprString exprType = "string"
+	exprBool   exprType = "bool"
+)
+
+// expression is a parsed and type checked rule expression.
+type expression struct {
+	root exprNode
+	typ  exprType
+}
+
+// parseExpression parses the source over variables of the given types.
+func parseExpression(src string, vars map[string]exprType) (out expression, err error) {
+	if strings.TrimSpace(src) == "" {
+		err = fmt.Errorf("expression is empty")
+		return
+	}
+	if len(src) > maxExpressionLength {
+		err = fmt.Errorf("expression is longer than %d characters", maxExpressionLength)
+		return
+	}
+
+	tokens, err := tokenize(src)
+	if err != nil {
+		return
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseTernary()
+	if err != nil {
+		return
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		err = fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+		return
+	}
+
+	typ, err := root.typeOf(vars)
+	if err != nil {
+		return
+	}
+	out = expression{root: root, typ: typ}
+	return
+}
+
+// eval evaluates the expression with the variables, which hold float64,
+// string or bool values of the types the expression was parsed with.
+func (e expression) eval(vars map[string]interface{}) (interface{}, error) {
+	return e.root.eval(vars)
+}
+
+// ***
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!", "?", ":", "(", ")", ","}
+
+func tokenize(src string) (out []token, err error) {
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			out = append(out, token{tokenNumber, src[start:i], start})
+
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			out = append(out, token{tokenIdent, src[start:i], start})
+
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			out = append(out, token{tokenString, src[i+1 : i+1+end], i})
+			i += end + 2
+
+		default:
+			matched := ""
+			for _, op := range exprOperators {
+				if strings.HasPrefix(src[i:], op) {
+					matched = op
+					break
+				}
+			}
+			if matched == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			out = append(out, token{tokenOperator, matched, i})
+			i += len(matched)
+		}
+	}
+	out = append(out, token{tokenEOF, "end of expression", len(src)})
+	return
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentStart(c byte) bool { return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+// ***
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+func (p *exprParser) peek() token { return p.tokens[p.pos] }
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token when it is one of the operators.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q, got %q at %d", op, tok.text, tok.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) parseTernary() (out exprNode, err error) {
+	if p.depth++; p.depth > maxExpressionDepth {
+		return nil, fmt.Errorf("expression is nested deeper than %d", maxExpressionDepth)
+	}
+	defer func() { p.depth-- }()
+
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return
+	}
+	if _, ok := p.accept("?"); !ok {
+		return cond, nil
+	}
+	then, err := p.parseTernary()
+	if err != nil {
+		return
+	}
+	if err = p.expect(":"); err != nil {
+		return
+	}
+	otherwise, err := p.parseTernary()
+	if err != nil {
+		return
+	}
+	return exprTernary{cond, then, otherwise}, nil
+}
+
+// binaryLevels lists the binary operators from the loosest binding to the
+// tightest.
+var binaryLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (out exprNode, err error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+
+	out, err = p.parseBinary(level + 1)
+	if err != nil {
+		return
+	}
+	for {
+		op, ok := p.accept(binaryLevels[level]...)
+		if !ok {
+			return
+		}
+		right, errRight := p.parseBinary(level + 1)
+		if errRight != nil {
+			return nil, errRight
+		}
+		out = exprBinary{op, out, right}
+	}
+}
+
+func (p *exprParser) parseUnary() (out exprNode, err error) {
+	if op, ok := p.accept("!", "-"); ok {
+		if p.depth++; p.depth > maxExpressionDepth {
+			return nil, fmt.Errorf("expression is nested deeper than %d", maxExpressionDepth)
+		}
+		defer func() { p.depth-- }()
+
+		operand, errOperand := p.parseUnary()
+		if errOperand != nil {
+			return nil, errOperand
+		}
+		return exprUnary{op, operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (out exprNode, err error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber:
+		n, errNumber := strconv.ParseFloat(strings.ReplaceAll(tok.text, "_", ""), 64)
+		if errNumber != nil {
+			return nil, fmt.Errorf("bad number %q at %d", tok.text, tok.pos)
+		}
+		return exprLiteral{n}, nil
+
+	case tokenString:
+		return exprLiteral{tok.text}, nil
+
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return exprLiteral{true}, nil
+		case "false":
+			return exprLiteral{false}, nil
+		}
+		if _, ok := p.accept("("); !ok {
+			return exprVariable{tok.text}, nil
+		}
+		call := exprCall{name: tok.text}
+		if _, ok := p.accept(")"); ok {
+			return call, nil
+		}
+		for {
+			arg, errArg := p.parseTernary()
+			if errArg != nil {
+				return nil, errArg
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(","); !ok {
+				break
+			}
+		}
+		if err = p.expect(")"); err != nil {
+			return
+		}
+		return call, nil
+
+	case tokenOperator:
+		if tok.text == "(" {
+			out, err = p.parseTernary()
+			if err != nil {
+				return
+			}
+			err = p.expect(")")
+			return
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+// ***
+
+type exprNode interface {
+	typeOf(vars map[string]exprType) (exprType, error)
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type exprLiteral struct{ value interface{} }
+
+func (n exprLiteral) typeOf(vars map[string]exprType) (exprType, error) {
+	switch n.value.(type) {
+	case float64:
+		return exprNumber, nil
+	case string:
+		return exprString, nil
+	}
+	return exprBool, nil
+}
+
+func (n exprLiteral) eval(vars map[string]interface{}) (interface{}, error) { return n.value, nil }
+
+type exprVariable struct{ name string }
+
+func (n exprVariable) typeOf(vars map[string]exprType) (exprType, error) {
+	typ, ok := vars[n.name]
+	if !ok {
+		return "", fmt.Errorf("unknown variable %s", n.name)
+	}
+	return typ, nil
+}
+
+func (n exprVariable) eval(vars map[string]interface{}) (interface{}, error) {
+	value, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("variable %s not set", n.name)
+	}
+	return value, nil
+}
+
+type exprUnary struct {
+	op      string
+	operand exprNode
+}
+
+func (n exprUnary) typeOf(vars map[string]exprType) (exprType, error) {
+	want := exprNumber
+	if n.op == "!" {
+		want = exprBool
+	}
+	typ, err := n.operand.typeOf(vars)
+	if err != nil {
+		return "", err
+	}
+	if typ != want {
+		return "", fmt.Errorf("operator %s needs a %s, got %s", n.op, want, typ)
+	}
+	return want, nil
+}
+
+func (n exprUnary) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := n.operand.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "!" {
+		return !value.(bool), nil
+	}
+	return -value.(float64), nil
+}
+
+type exprBinary struct {
+	op          string
+	left, right exprNode
+}
+
+func (n exprBinary) typeOf(vars map[string]exprType) (exprType, error) {
+	left, err := n.left.typeOf(vars)
+	if err != nil {
+		return "", err
+	}
+	right, err := n.right.typeOf(vars)
+	if err != nil {
+		return "", err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		if left != exprBool || right != exprBool {
+			return "", fmt.Errorf("operator %s needs bools, got %s and %s", n.op, left, right)
+		}
+		return exprBool, nil
+	case "==", "!=":
+		if left != right {
+			return "", fmt.Errorf("operator %s compares a %s with a %s", n.op, left, right)
+		}
+		return exprBool, nil
+	case "<", "<=", ">", ">=":
+		if left != exprNumber || right != exprNumber {
+			return "", fmt.Errorf("operator %s needs numbers, got %s and %s", n.op, left, right)
+		}
+		return exprBool, nil
+	}
+	if left != exprNumber || right != exprNumber {
+		return "", fmt.Errorf("operator %s needs numbers, got %s and %s", n.op, left, right)
+	}
+	return exprNumber, nil
+}
+
+func (n exprBinary) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	// logic short-circuits
+	switch n.op {
+	case "&&":
+		if !left.(bool) {
+			return false, nil
+		}
+		return n.right.eval(vars)
+	case "||":
+		if left.(bool) {
+			return true, nil
+		}
+		return n.right.eval(vars)
+	}
+
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return left == right, nil
+	case "!=":
+		return left != right, nil
+	}
+
+	l, r := left.(float64), right.(float64)
+	switch n.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	case ">=":
+		return l >= r, nil
+	case "+":
+		return l + r, nil
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return l / r, nil
+	case "%":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(l, r), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.op)
+}
+
+type exprTernary struct {
+	cond, then, otherwise exprNode
+}
+
+func (n exprTernary) typeOf(vars map[string]exprType) (exprType, error) {
+	cond, err := n.cond.typeOf(vars)
+	if err != nil {
+		return "", err
+	}
+	if cond != exprBool {
+		return "", fmt.Errorf("condition needs a bool, got %s", cond)
+	}
+	then, err := n.then.typeOf(vars)
+	if err != nil {
+		return "", err
+	}
+	otherwise, err := n.otherwise.typeOf(vars)
+	if err != nil {
+		return "", err
+	}
+	if then != otherwise {
+		return "", fmt.Errorf("conditional branches are a %s and a %s", then, otherwise)
+	}
+	return then, nil
+}
+
+func (n exprTernary) eval(vars map[string]interface{}) (interface{}, error) {
+	cond, err := n.cond.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if cond.(bool) {
+		return n.then.eval(vars)
+	}
+	return n.otherwise.eval(vars)
+}
+
+type exprCall struct {
+	name string
+	args []exprNode
+}
+
+func (n exprCall) typeOf(vars map[string]exprType) (exprType, error) {
+	if n.name != "min" && n.name != "max" {
+		return "", fmt.Errorf("unknown function %s", n.name)
+	}
+	if len(n.args) == 0 {
+		return "", fmt.Errorf("function %s needs arguments", n.name)
+	}
+	for _, arg := range n.args {
+		typ, err := arg.typeOf(vars)
+		if err != nil {
+			return "", err
+		}
+		if typ != exprNumber {
+			return "", fmt.Errorf("function %s needs numbers, got %s", n.name, typ)
+		}
+	}
+	return exprNumber, nil
+}
+
+func (n exprCall) eval(vars map[string]interface{}) (interface{}, error) {
+	var out float64
+	for i, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		v := value.(float64)
+		if i == 0 || (n.name == "min" && v < out) || (n.name == "max" && v > out) {
+			out = v
+		}
+	}
+	return out, nil
+}
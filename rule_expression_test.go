@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	types := map[string]exprType{"dpd": exprNumber, "arrears": exprNumber, "product": exprString}
+	values := map[string]interface{}{"dpd": float64(45), "arrears": float64(220_000), "product": "paylater"}
+
+	tests := []struct {
+		name string
+		src  string
+		want interface{}
+	}{
+		{"arithmetic_precedence", "1 + 2 * 3 - 4 / 2", float64(5)},
+		{"parentheses", "(1 + 2) * 3", float64(9)},
+		{"unary_minus", "-arrears + 20_000", float64(-200_000)},
+		{"modulo", "dpd % 30", float64(15)},
+		{"comparison", "dpd >= 30 && arrears > 100_000", true},
+		{"logic_precedence", "dpd < 30 || dpd > 40 && product == 'paylater'", true},
+		{"negation", "!(product != \"paylater\")", true},
+		{"conditional", "dpd > 60 ? 'legal' : dpd > 30 ? 'field' : 'reminder'", "field"},
+		{"functions", "min(arrears * 0.05, 10_000) + max(dpd, 1, 2)", float64(10_045)},
+		{"decimals", ".5 * 4", float64(2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// act
+			expr, err := parseExpression(tt.src, types)
+			require.NoError(t, err)
+			out, err := expr.eval(values)
+
+			// assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("short_circuit", func(t *testing.T) {
+		// arrange
+		expr, err := parseExpression("dpd == 0 || arrears / (dpd - 45) > 1", types)
+		require.NoError(t, err)
+
+		// act
+		_, errEval := expr.eval(values)
+		_, errShort := expr.eval(map[string]interface{}{"dpd": float64(0), "arrears": float64(0), "product": ""})
+
+		// assert
+		assert.EqualError(t, errEval, "division by zero")
+		assert.NoError(t, errShort)
+	})
+
+	t.Run("bad_expressions", func(t *testing.T) {
+		for _, src := range []string{
+			"",
+			"dpd >",
+			"(dpd > 1",
+			"dpd > 1)",
+			"dpd = 1",
+			"'unterminated",
+			"limit > 1",
+			"exec('rm')",
+			"min()",
+			"product > 1",
+			"dpd && true",
+			"dpd == 'thirty'",
+			"dpd ? 1 : 2",
+			"dpd > 1 ? 1 : 'one'",
+			"1.2.3",
+			strings.Repeat("(", 60) + "1" + strings.Repeat(")", 60),
+			strings.Repeat("1 + ", 600) + "1",
+		} {
+			// act
+			_, err := parseExpression(src, types)
+
+			// assert
+			assert.Error(t, err, src)
+		}
+	})
+}
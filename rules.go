@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	validator "github.com/avrebarra/minivalidator"
+	"github.com/rs/xid"
+)
+
+type RuleKind string
+
+const (
+	RuleKindDelinquency     RuleKind = "delinquency"      // bool, takes precedence over the delinquency policies
+	RuleKindLateFee         RuleKind = "late_fee"         // number, charged once per late installment besides the late fee rules
+	RuleKindCollectionStage RuleKind = "collection_stage" // string, reported by delinquency checks
+)
+
+func (k RuleKind) IsSupported() bool {
+	switch k {
+	case RuleKindDelinquency, RuleKindLateFee, RuleKindCollectionStage:
+		return true
+	}
+	return false
+}
+
+func (k RuleKind) resultType() exprType {
+	switch k {
+	case RuleKindLateFee:
+		return exprNumber
+	case RuleKindCollectionStage:
+		return exprString
+	}
+	return exprBool
+}
+
+// ruleVariablesOf returns the variables rules of the kind are written over.
+// Late fee rules also see the amount overdue on the installment charged.
+func ruleVariablesOf(kind RuleKind) map[string]exprType {
+	out := map[string]exprType{
+		"days_past_due":       exprNumber,
+		"missed_installments": exprNumber,
+		"consecutive_missed":  exprNumber,
+		"arrears":             exprNumber,
+		"installment_amount":  exprNumber,
+		"principal":           exprNumber,
+		"product":             exprString,
+	}
+	if kind == RuleKindLateFee {
+		out["overdue"] = exprNumber
+	}
+	return out
+}
+
+func ruleValuesOf(s DelinquencySnapshot) map[string]interface{} {
+	return map[string]interface{}{
+		"days_past_due":       float64(s.DaysPastDue),
+		"missed_installments": float64(s.MissedInstallments),
+		"consecutive_missed":  float64(s.ConsecutiveMissed),
+		"arrears":             float64(s.AmountInArrears),
+		"installment_amount":  float64(s.InstallmentAmount),
+		"principal":           float64(s.Principal),
+		"product":             s.Product,
+	}
+}
+
+func parseRule(kind RuleKind, src string) (out expression, err error) {
+	out, err = parseExpression(src, ruleVariablesOf(kind))
+	if err != nil {
+		return
+	}
+	if want := kind.resultType(); out.typ != want {
+		err = fmt.Errorf("%s rules must evaluate to a %s, got %s", kind, want, out.typ)
+		return
+	}
+	return
+}
+
+// activeRuleOf returns the parsed active rule of the kind, ok is false when
+// none is active.
+func activeRuleOf(repo BillerRepository, kind RuleKind) (out expression, ok bool, err error) {
+	rules, err := repo.ListRules()
+	if err != nil {
+		err = fmt.Errorf("error fetching rules: %w", err)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Kind != kind || !rule.Active {
+			continue
+		}
+		if out, err = parseRule(rule.Kind, rule.Expression); err != nil {
+			err = fmt.Errorf("bad rule %s: %w", rule.ID, err)
+			return
+		}
+		ok = true
+		return
+	}
+	return
+}
+
+// collectionStageOf returns the stage the active collection stage rule puts
+// the billable in, empty when no rule is active.
+func collectionStageOf(repo BillerRepository, s DelinquencySnapshot) (out string, err error) {
+	rule, ok, err := activeRuleOf(repo, RuleKindCollectionStage)
+	if err != nil || !ok {
+		return
+	}
+
+	value, err := rule.eval(ruleValuesOf(s))
+	if err != nil {
+		err = fmt.Errorf("failed to evaluate collection stage rule: %w", err)
+		return
+	}
+	out = value.(string)
+	return
+}
+
+// lateFeeOf returns what the late fee rule charges an installment with the
+// given overdue amount, in minor units rounded half away from zero.
+func lateFeeOf(rule expression, s DelinquencySnapshot, overdue int) (out int, err error) {
+	values := ruleValuesOf(s)
+	values["overdue"] = float64(overdue)
+	value, err := rule.eval(values)
+	if err != nil {
+		err = fmt.Errorf("failed to evaluate late fee rule: %w", err)
+		return
+	}
+	if fee := value.(float64); fee > 0 {
+		out = int(math.Round(fee))
+	}
+	return
+}
+
+func (b *BillerEngine) CreateRule(in InputCreateRule) (out Rule, err error) {
+	// validate inputs
+	if err = validator.Validate(in); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+	if !in.Kind.IsSupported() {
+		err = fmt.Errorf("bad input: unsupported rule kind %s", in.Kind)
+		return
+	}
+	if _, err = parseRule(in.Kind, in.Expression); err != nil {
+		err = fmt.Errorf("bad input: %w", err)
+		return
+	}
+
+	timestamp := b.Conf.GenerateCurrentDate()
+	out = Rule{
+		ID:         xid.New().String(),
+		Kind:       in.Kind,
+		Name:       in.Name,
+		Expression: in.Expression,
+		CreatedAt:  timestamp,
+		UpdatedAt:  timestamp,
+	}
+	if err = b.Conf.Store.InsertRule(out); err != nil {
+		err = fmt.Errorf("failed to save rule: %w", err)
+		return
+	}
+	return
+}
+
+func (b *BillerEngine) GetRules() (out []Rule, err error) {
+	out, err = b.Conf.Store.ListRules()
+	if err != nil {
+		err = fmt.Errorf("error fetching rules: %w", err)
+		return
+	}
+	return
+}
+
+// ActivateRule makes the rule the one deciding its kind, deactivating the
+// rule active before it.
+func (b *BillerEngine) ActivateRule(ruleID string) (out Rule, err error) {
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		out, err = tx.GetRule(ruleID)
+		if err != nil {
+			err = fmt.Errorf("rule not found: id %s", ruleID)
+			return
+		}
+
+		rules, err := tx.ListRules()
+		if err != nil {
+			err = fmt.Errorf("error fetching rules: %w", err)
+			return
+		}
+		timestamp := b.Conf.GenerateCurrentDate()
+		for _, rule := range rules {
+			if rule.Kind != out.Kind || !rule.Active || rule.ID == out.ID {
+				continue
+			}
+			rule.Active, rule.UpdatedAt = false, timestamp
+			if err = tx.UpdateRule(rule); err != nil {
+				err = fmt.Errorf("failed to deactivate rule: %w", err)
+				return
+			}
+		}
+
+		out.Active, out.UpdatedAt = true, timestamp
+		if err = tx.UpdateRule(out); err != nil {
+			err = fmt.Errorf("failed to activate rule: %w", err)
+			return
+		}
+		return
+	})
+	return
+}
+
+// DeactivateRule hands the decisions of the kind of the rule back to the
+// engine configuration.
+func (b *BillerEngine) DeactivateRule(ruleID string) (out Rule, err error) {
+	err = b.Conf.Store.Transact(func(tx BillerRepository) (err error) {
+		out, err = tx.GetRule(ruleID)
+		if err != nil {
+			err = fmt.Errorf("rule not found: id %s", ruleID)
+			return
+		}
+
+		out.Active, out.UpdatedAt = false, b.Conf.GenerateCurrentDate()
+		if err = tx.UpdateRule(out); err != nil {
+			err = fmt.Errorf("failed to deactivate rule: %w", err)
+			return
+		}
+		return
+	})
+	return
+}
+
+// DryRunRule evaluates the rule against billables as of asOf, the current
+// date when zero, without activating it or changing the billables. It runs
+// against every billable when no ids are given. Late fee rules are evaluated
+// for the oldest missed installment.
+func (b *BillerEngine) DryRunRule(ruleID string, in InputDryRunRule) (out []RuleDryRun, err error) {
+	rule, err := b.Conf.Store.GetRule(ruleID)
+	if err != nil {
+		err = fmt.Errorf("rule not found: id %s", ruleID)
+		return
+	}
+	expr, err := parseRule(rule.Kind, rule.Expression)
+	if err != nil {
+		err = fmt.Errorf("bad rule %s: %w", rule.ID, err)
+		return
+	}
+
+	asOf := in.AsOf
+	if asOf.IsZero() {
+		asOf = b.Conf.GenerateCurrentDate()
+	}
+	bIDs := in.BillableIDs
+	if len(bIDs) == 0 {
+		if bIDs, err = b.Conf.Store.ListEventStreams(); err != nil {
+			err = fmt.Errorf("error fetching billables: %w", err)
+			return
+		}
+	}
+
+	for _, bID := range bIDs {
+		result, errRun := b.dryRunRule(expr, rule.Kind, bID, asOf)
+		if errRun != nil {
+			result = RuleDryRun{BillableID: bID, Error: errRun.Error()}
+		}
+		out = append(out, result)
+	}
+	return
+}
+
+func (b *BillerEngine) dryRunRule(rule expression, kind RuleKind, bID string, asOf time.Time) (out RuleDryRun, err error) {
+	_, installments, details, snapshot, err := b.arrearsAsOf(b.Conf.Store, bID, asOf)
+	if err != nil {
+		return
+	}
+
+	out.BillableID = bID
+	out.Variables = ruleValuesOf(snapshot)
+	if kind == RuleKindLateFee {
+		overdue := 0
+		for _, inst := range installments {
+			if details.FirstMissedDueAt != nil && inst.DueAt.Equal(*details.FirstMissedDueAt) {
+				overdue = inst.AmountDue - inst.AmountPaid
+				break
+			}
+		}
+		out.Variables["overdue"] = float64(overdue)
+	}
+	out.Result, err = rule.eval(out.Variables)
+	return
+}
+
+// ***
+
+type InputCreateRule struct {
+	Kind       RuleKind `validate:"required"`
+	Name       string   `validate:"required"`
+	Expression string   `validate:"required"`
+}
+
+type InputDryRunRule struct {
+	BillableIDs []string  // every billable when empty
+	AsOf        time.Time // defaults to the current date
+}
+
+type RuleDryRun struct {
+	BillableID string
+	Variables  map[string]interface{} // values the rule was evaluated with
+	Result     interface{}            // bool, number or string by the rule kind
+	Error      string                 // why the rule could not be evaluated, if it could not
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBillerEngine_Rules(t *testing.T) {
+	curdate := time.Date(2024, 2, 5, 9, 0, 0, 0, time.UTC) // installments of 110_000 due every Monday from Feb 12
+	now := curdate
+	newEngine := func() *BillerEngine {
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               setupTestStore(),
+			GenerateCurrentDate: func() time.Time { return now },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 1,
+		})
+		require.NoError(t, err)
+		return b
+	}
+	newBillable := func(t *testing.T, b *BillerEngine, product string) string {
+		bid := xid.New().String()
+		_, err := b.CreateBorrower(InputCreateBorrower{ID: bid, Name: "Borrower " + bid}) // one each, earlier ones may be delinquent
+		require.NoError(t, err)
+		_, err = b.MakeBillable(InputMakeBillable{BID: bid, BorrowerID: bid, Principal: 5_000_000, Product: product})
+		require.NoError(t, err)
+		return bid
+	}
+	newRule := func(t *testing.T, b *BillerEngine, kind RuleKind, expression string) Rule {
+		rule, err := b.CreateRule(InputCreateRule{Kind: kind, Name: string(kind), Expression: expression})
+		require.NoError(t, err)
+		return rule
+	}
+
+	t.Run("delinquency_rule", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		bid := newBillable(t, b, "")
+		rule := newRule(t, b, RuleKindDelinquency, "days_past_due >= 5 && product != 'staff'")
+		now = curdate.AddDate(0, 0, 8)
+
+		// act
+		byPolicy, errPolicy := b.IsDelinquent(bid, time.Time{})
+		_, errActivate := b.ActivateRule(rule.ID)
+		byRule, errRule := b.IsDelinquent(bid, time.Time{})
+		later, errLater := b.IsDelinquent(bid, curdate.AddDate(0, 0, 12))
+		_, errDeactivate := b.DeactivateRule(rule.ID)
+		restored, errRestored := b.IsDelinquent(bid, time.Time{})
+
+		// assert
+		assert.NoError(t, errPolicy)
+		assert.Equal(t, true, byPolicy.Delinquency)
+		assert.NoError(t, errActivate)
+		assert.NoError(t, errRule)
+		assert.Equal(t, false, byRule.Delinquency)
+		assert.Equal(t, BillableStatusActive, byRule.Status)
+		assert.NoError(t, errLater)
+		assert.Equal(t, true, later.Delinquency)
+		assert.NoError(t, errDeactivate)
+		assert.NoError(t, errRestored)
+		assert.Equal(t, true, restored.Delinquency)
+	})
+
+	t.Run("collection_stage_rule", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		bid := newBillable(t, b, "")
+		rule := newRule(t, b, RuleKindCollectionStage, "days_past_due > 30 ? 'field' : missed_installments > 0 ? 'reminder' : 'none'")
+		_, err := b.ActivateRule(rule.ID)
+		require.NoError(t, err)
+
+		// act
+		current, errCurrent := b.IsDelinquent(bid, curdate.AddDate(0, 0, 1))
+		reminder, errReminder := b.IsDelinquent(bid, curdate.AddDate(0, 0, 8))
+		field, errField := b.IsDelinquent(bid, curdate.AddDate(0, 0, 40))
+
+		// assert
+		assert.NoError(t, errCurrent)
+		assert.Equal(t, "none", current.CollectionStage)
+		assert.NoError(t, errReminder)
+		assert.Equal(t, "reminder", reminder.CollectionStage)
+		assert.NoError(t, errField)
+		assert.Equal(t, "field", field.CollectionStage)
+	})
+
+	t.Run("late_fee_rule", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		bid := newBillable(t, b, "")
+		paylaterID := newBillable(t, b, "paylater")
+		rule := newRule(t, b, RuleKindLateFee, "product == 'paylater' ? 2_000 : min(overdue * 0.1, 5_000)")
+		_, err := b.ActivateRule(rule.ID)
+		require.NoError(t, err)
+		now = curdate.AddDate(0, 0, 8)
+
+		// act
+		fees, err := b.ChargeLateFees(bid, time.Time{})
+		again, errAgain := b.ChargeLateFees(bid, time.Time{})
+		paylaterFees, errPaylater := b.ChargeLateFees(paylaterID, time.Time{})
+
+		// assert
+		assert.NoError(t, err)
+		require.Len(t, fees, 1)
+		assert.Equal(t, LateFeeRuleExpression, fees[0].Kind)
+		assert.Equal(t, 1, fees[0].InstallmentSeq)
+		assert.Equal(t, NewMoney(5_000, CurrencyIDR), fees[0].Amount)
+		assert.NoError(t, errAgain)
+		assert.Empty(t, again)
+		assert.NoError(t, errPaylater)
+		require.Len(t, paylaterFees, 1)
+		assert.Equal(t, NewMoney(2_000, CurrencyIDR), paylaterFees[0].Amount)
+	})
+
+	t.Run("one_active_per_kind", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		first := newRule(t, b, RuleKindDelinquency, "missed_installments >= 2")
+		second := newRule(t, b, RuleKindDelinquency, "arrears > 0")
+		stage := newRule(t, b, RuleKindCollectionStage, "'none'")
+
+		// act
+		_, errFirst := b.ActivateRule(first.ID)
+		_, errStage := b.ActivateRule(stage.ID)
+		_, errSecond := b.ActivateRule(second.ID)
+		_, errMissing := b.ActivateRule("unknown")
+		rules, err := b.GetRules()
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errStage)
+		assert.NoError(t, errSecond)
+		assert.Error(t, errMissing)
+		assert.NoError(t, err)
+		require.Len(t, rules, 3)
+		assert.Equal(t, false, rules[0].Active)
+		assert.Equal(t, true, rules[1].Active)
+		assert.Equal(t, true, rules[2].Active)
+	})
+
+	t.Run("dry_run", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+		now = curdate
+		behindTwice := newBillable(t, b, "")
+		now = curdate.AddDate(0, 0, 7)
+		behindOnce := newBillable(t, b, "")
+		rule := newRule(t, b, RuleKindDelinquency, "arrears >= 200_000")
+		fee := newRule(t, b, RuleKindLateFee, "overdue * 0.05")
+		now = curdate.AddDate(0, 0, 15)
+
+		// act
+		selected, errSelected := b.DryRunRule(rule.ID, InputDryRunRule{BillableIDs: []string{behindTwice, behindOnce, "unknown"}})
+		all, errAll := b.DryRunRule(rule.ID, InputDryRunRule{})
+		fees, errFees := b.DryRunRule(fee.ID, InputDryRunRule{BillableIDs: []string{behindOnce}})
+		_, errMissing := b.DryRunRule("unknown", InputDryRunRule{})
+
+		// assert
+		assert.NoError(t, errSelected)
+		require.Len(t, selected, 3)
+		assert.Equal(t, true, selected[0].Result)
+		assert.Equal(t, float64(220_000), selected[0].Variables["arrears"])
+		assert.Equal(t, false, selected[1].Result)
+		assert.Empty(t, selected[1].Error)
+		assert.NotEmpty(t, selected[2].Error)
+		assert.NoError(t, errAll)
+		assert.Len(t, all, 2)
+		assert.NoError(t, errFees)
+		require.Len(t, fees, 1)
+		assert.Equal(t, float64(110_000), fees[0].Variables["overdue"])
+		assert.Equal(t, float64(5_500), fees[0].Result)
+		assert.Error(t, errMissing)
+
+		// dry runs change nothing
+		rules, err := b.GetRules()
+		assert.NoError(t, err)
+		assert.Equal(t, false, rules[0].Active)
+		billable, err := b.GetBillable(behindTwice)
+		assert.NoError(t, err)
+		assert.Equal(t, BillableStatusActive, billable.Status)
+	})
+
+	t.Run("bad_rules", func(t *testing.T) {
+		// arrange
+		b := newEngine()
+
+		for _, in := range []InputCreateRule{
+			{Kind: "interest", Name: "unsupported", Expression: "true"},
+			{Kind: RuleKindDelinquency, Name: "not a bool", Expression: "days_past_due"},
+			{Kind: RuleKindLateFee, Name: "not a number", Expression: "'fee'"},
+			{Kind: RuleKindCollectionStage, Name: "unknown variable", Expression: "overdue > 0 ? 'field' : 'none'"},
+			{Kind: RuleKindDelinquency, Name: "syntax", Expression: "days_past_due >"},
+			{Kind: RuleKindDelinquency, Expression: "true"},
+		} {
+			// act
+			_, err := b.CreateRule(in)
+
+			// assert
+			assert.Error(t, err, in.Name)
+		}
+	})
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"time"
+)
+
+// MigrationQuery is the schema the first release shipped with, later changes
+// are applied over it by Migrate.
+//
+//go:embed migration.sql
+var MigrationQuery string
+
+// schemaMigration upgrades the schema by one version. Applied versions are
+// recorded in schema_version, so a database only runs the steps it has not
+// seen yet.
+type schemaMigration struct {
+	Version int
+	Name    string
+	Apply   func(tx *sql.Tx) error
+}
+
+// schemaMigrations take a database from nothing to the schema the store
+// reads, in order. Databases set up from migration.sql before versions were
+// recorded start from the baseline, which leaves their tables as they are.
+var schemaMigrations = []schemaMigration{
+	{Version: 1, Name: "baseline", Apply: migrateBaseline},
+	{Version: 2, Name: "billable_terms", Apply: migrateBillableTerms},
+	{Version: 3, Name: "installments", Apply: migrateInstallments},
+	{Version: 4, Name: "unallocated_payments", Apply: migrateUnallocatedPayments},
+	{Version: 5, Name: "billable_status", Apply: migrateBillableStatus},
+	{Version: 6, Name: "billable_transitions", Apply: migrateBillableTransitions},
+	{Version: 7, Name: "payment_reversals", Apply: migratePaymentReversals},
+	{Version: 8, Name: "idempotency_keys", Apply: migrateIdempotencyKeys},
+	{Version: 9, Name: "payment_ledger_order", Apply: migratePaymentLedgerOrder},
+	{Version: 10, Name: "events", Apply: migrateEvents},
+	{Version: 11, Name: "journal", Apply: migrateJournal},
+	{Version: 12, Name: "currency", Apply: migrateCurrency},
+	{Version: 13, Name: "interest_models", Apply: migrateInterestModels},
+	{Version: 14, Name: "tenor", Apply: migrateTenor},
+	{Version: 15, Name: "timezone", Apply: migrateTimezone},
+	{Version: 16, Name: "fees", Apply: migrateFees},
+	{Version: 17, Name: "payment_allocation", Apply: migratePaymentAllocation},
+	{Version: 18, Name: "grace_periods", Apply: migrateGracePeriods},
+	{Version: 19, Name: "delinquency_episodes", Apply: migrateDelinquencyEpisodes},
+	{Version: 20, Name: "products", Apply: migrateProducts},
+	{Version: 21, Name: "rules", Apply: migrateRules},
+	{Version: 22, Name: "borrowers", Apply: migrateBorrowers},
+}
+
+const schemaVersionQuery = `CREATE TABLE IF NOT EXISTS schema_version (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(64),
+    applied_at DATETIME
+);`
+
+// Migrate brings the schema up to date, applying each migration the
+// database has not seen yet in its own transaction.
+func (s *SQLiteStore) Migrate() (err error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return
+	}
+
+	for _, m := range schemaMigrations {
+		if m.Version <= version {
+			continue
+		}
+		if err = s.migrateTo(m); err != nil {
+			err = fmt.Errorf("failed to migrate to version %d (%s): %w", m.Version, m.Name, err)
+			return
+		}
+	}
+	return
+}
+
+// SchemaVersion returns the latest migration applied to the database, zero
+// when it was never migrated.
+func (s *SQLiteStore) SchemaVersion() (out int, err error) {
+	if _, err = s.Conf.DB.Exec(schemaVersionQuery); err != nil {
+		err = fmt.Errorf("failed to create schema_version: %w", err)
+		return
+	}
+	err = s.Conf.DB.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&out)
+	if err != nil {
+		err = fmt.Errorf("failed to read schema version: %w", err)
+		return
+	}
+	return
+}
+
+func (s *SQLiteStore) migrateTo(m schemaMigration) (err error) {
+	tx, err := s.Conf.DB.Begin()
+	if err != nil {
+		err = fmt.Errorf("failed to begin transaction: %w", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err = m.Apply(tx); err != nil {
+		return
+	}
+	_, err = tx.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?);", m.Version, m.Name, time.Now())
+	if err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		err = fmt.Errorf("failed to commit transaction: %w", err)
+		return
+	}
+	return
+}
+
+func migrateBaseline(tx *sql.Tx) (err error) {
+	_, err = tx.Exec(MigrationQuery)
+	return
+}
+
+func migrateBillableTerms(tx *sql.Tx) (err error) {
+	// older billables were all weekly at the rate their amount was billed at
+	err = execAll(tx,
+		"ALTER TABLE billables ADD COLUMN interest_rate REAL;",
+		"ALTER TABLE billables ADD COLUMN frequency VARCHAR(16);",
+		"UPDATE billables SET interest_rate = ROUND(CAST(amount - principal AS REAL) / principal, 4) WHERE principal > 0;",
+		"UPDATE billables SET interest_rate = 0 WHERE interest_rate IS NULL;",
+		fmt.Sprintf("UPDATE billables SET frequency = '%s';", FrequencyWeekly),
+	)
+	return
+}
+
+func migrateInstallments(tx *sql.Tx) (err error) {
+	// lay out weekly installments of older billables with the remainder on the
+	// last one, paid in order by what the billable received so far. The
+	// billable falls due on its last installment.
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS installments (
+    billable_id VARCHAR(255),
+    seq INTEGER,
+    due_at DATETIME,
+    amount_due INTEGER,
+    amount_paid INTEGER,
+    status VARCHAR(16),
+    PRIMARY KEY (billable_id, seq),
+    FOREIGN KEY (billable_id) REFERENCES billables(id)
+);`,
+		"UPDATE billables SET due_at = strftime('%Y-%m-%d %H:%M:%f', created_at, '+' || (7 * dur_week) || ' days') WHERE dur_week > 0;",
+		`INSERT INTO installments (billable_id, seq, due_at, amount_due, amount_paid, status)
+WITH RECURSIVE seqs (billable_id, seq, tenor) AS (
+    SELECT id, 1, dur_week FROM billables WHERE dur_week > 0
+    UNION ALL
+    SELECT billable_id, seq + 1, tenor FROM seqs WHERE seq < tenor
+), schedule AS (
+    SELECT s.billable_id, s.seq,
+        strftime('%Y-%m-%d %H:%M:%f', b.created_at, '+' || (7 * s.seq) || ' days') AS due_at,
+        CASE WHEN s.seq = s.tenor THEN b.amount - (b.amount / s.tenor) * (s.tenor - 1) ELSE b.amount / s.tenor END AS amount_due,
+        MAX(0, (SELECT COALESCE(SUM(p.amount), 0) FROM payments p WHERE p.billable_id = b.id) - (b.amount / s.tenor) * (s.seq - 1)) AS available
+    FROM seqs s JOIN billables b ON b.id = s.billable_id
+)
+SELECT billable_id, seq, due_at, amount_due, MIN(amount_due, available),
+    CASE WHEN available >= amount_due THEN 'paid' ELSE 'unpaid' END
+FROM schedule;`,
+	)
+	return
+}
+
+func migrateUnallocatedPayments(tx *sql.Tx) (err error) {
+	// installments paid in part were left unpaid before partial payments
+	err = execAll(tx,
+		"ALTER TABLE payments ADD COLUMN amount_unallocated INTEGER DEFAULT 0;",
+		fmt.Sprintf("UPDATE installments SET status = '%s' WHERE amount_paid > 0 AND amount_paid < amount_due;", InstallmentStatusPartial),
+	)
+	return
+}
+
+func migrateBillableStatus(tx *sql.Tx) (err error) {
+	// older billables are paid off once they received their amount
+	err = execAll(tx,
+		"ALTER TABLE billables ADD COLUMN status VARCHAR(16);",
+		"ALTER TABLE payments ADD COLUMN amount_rebated INTEGER DEFAULT 0;",
+		fmt.Sprintf(
+			"UPDATE billables SET status = CASE WHEN (SELECT COALESCE(SUM(amount), 0) FROM payments WHERE payments.billable_id = billables.id) >= amount THEN '%s' ELSE '%s' END;",
+			BillableStatusPaidOff, BillableStatusActive,
+		),
+	)
+	return
+}
+
+func migrateBillableTransitions(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS billable_transitions (
+    id VARCHAR(255) PRIMARY KEY,
+    billable_id VARCHAR(255),
+    from_status VARCHAR(16),
+    to_status VARCHAR(16),
+    reason TEXT,
+    created_at DATETIME,
+    FOREIGN KEY (billable_id) REFERENCES billables(id)
+);`,
+		"CREATE INDEX IF NOT EXISTS idx_billable_transitions_billable_id ON billable_transitions (billable_id, created_at);",
+	)
+	return
+}
+
+func migratePaymentReversals(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		fmt.Sprintf("ALTER TABLE payments ADD COLUMN kind VARCHAR(16) DEFAULT '%s';", PaymentKindPayment),
+		"ALTER TABLE payments ADD COLUMN reverses_id VARCHAR(255) DEFAULT '';",
+		"ALTER TABLE payments ADD COLUMN reason TEXT DEFAULT '';",
+	)
+	return
+}
+
+func migrateIdempotencyKeys(tx *sql.Tx) (err error) {
+	err = execAll(tx, `CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    fingerprint VARCHAR(64),
+    response TEXT,
+    created_at DATETIME,
+    expires_at DATETIME
+);`)
+	return
+}
+
+func migratePaymentLedgerOrder(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		"DROP INDEX IF EXISTS idx_payment_billable_id_paid_at_desc;",
+		"CREATE INDEX IF NOT EXISTS idx_payment_billable_id_ledger_order ON payments (billable_id, paid_at, created_at, id);",
+	)
+	return
+}
+
+func migrateEvents(tx *sql.Tx) (err error) {
+	// running paid totals are derived from the payments in ledger order
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS events (
+    id VARCHAR(255) PRIMARY KEY,
+    billable_id VARCHAR(255),
+    seq INTEGER,
+    type VARCHAR(32),
+    payload TEXT,
+    prev_hash VARCHAR(64),
+    hash VARCHAR(64),
+    created_at DATETIME,
+    UNIQUE (billable_id, seq)
+);`,
+		`CREATE TRIGGER IF NOT EXISTS trg_events_no_update BEFORE UPDATE ON events
+BEGIN
+    SELECT RAISE(ABORT, 'events are append-only');
+END;`,
+		`CREATE TRIGGER IF NOT EXISTS trg_events_no_delete BEFORE DELETE ON events
+BEGIN
+    SELECT RAISE(ABORT, 'events are append-only');
+END;`,
+		"ALTER TABLE payments DROP COLUMN amount_accumulated;",
+	)
+	return
+}
+
+func migrateJournal(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS journal_entries (
+    id VARCHAR(255) PRIMARY KEY,
+    billable_id VARCHAR(255),
+    description TEXT,
+    reference VARCHAR(255),
+    posted_at DATETIME
+);`,
+		`CREATE TABLE IF NOT EXISTS journal_lines (
+    entry_id VARCHAR(255),
+    line_no INTEGER,
+    account VARCHAR(64),
+    debit INTEGER DEFAULT 0,
+    credit INTEGER DEFAULT 0,
+    PRIMARY KEY (entry_id, line_no),
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id)
+);`,
+		"CREATE INDEX IF NOT EXISTS idx_journal_entries_billable_id ON journal_entries (billable_id, posted_at);",
+	)
+	return
+}
+
+func migrateCurrency(tx *sql.Tx) (err error) {
+	// everything booked before currencies were tracked was in rupiah
+	for _, table := range []string{"billables", "payments", "journal_entries"} {
+		err = execAll(tx,
+			fmt.Sprintf("ALTER TABLE %s ADD COLUMN currency VARCHAR(3);", table),
+			fmt.Sprintf("UPDATE %s SET currency = '%s';", table, CurrencyIDR),
+		)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func migrateInterestModels(tx *sql.Tx) (err error) {
+	// older billables were priced flat, their interest spread like principal
+	err = execAll(tx,
+		"ALTER TABLE billables ADD COLUMN interest INTEGER;",
+		fmt.Sprintf("ALTER TABLE billables ADD COLUMN interest_model VARCHAR(32) DEFAULT '%s';", InterestModelFlat),
+		"ALTER TABLE billables ADD COLUMN effective_rate REAL;",
+		"ALTER TABLE installments ADD COLUMN interest_due INTEGER DEFAULT 0;",
+		"UPDATE billables SET interest = amount - principal;",
+		`UPDATE installments SET interest_due = (
+    SELECT CASE WHEN installments.seq = n.tenor THEN b.interest - (b.interest / n.tenor) * (n.tenor - 1) ELSE b.interest / n.tenor END
+    FROM billables b JOIN (SELECT billable_id, COUNT(*) AS tenor FROM installments GROUP BY billable_id) n ON n.billable_id = b.id
+    WHERE b.id = installments.billable_id
+);`,
+	)
+	if err != nil {
+		return
+	}
+	err = backfillEffectiveRates(tx)
+	return
+}
+
+func backfillEffectiveRates(tx *sql.Tx) (err error) {
+	bIDs, err := queryStrings(tx, "SELECT id FROM billables WHERE effective_rate IS NULL;")
+	if err != nil {
+		return
+	}
+
+	for _, bID := range bIDs {
+		var principal int
+		var createdAt time.Time
+		if err = tx.QueryRow("SELECT principal, created_at FROM billables WHERE id = ?;", bID).Scan(&principal, &createdAt); err != nil {
+			return
+		}
+
+		var installments []Installment
+		rows, err := tx.Query("SELECT due_at, amount_due FROM installments WHERE billable_id = ? ORDER BY seq ASC;", bID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var inst Installment
+			if err = rows.Scan(&inst.DueAt, &inst.AmountDue); err != nil {
+				rows.Close()
+				return err
+			}
+			installments = append(installments, inst)
+		}
+		rows.Close()
+
+		_, err = tx.Exec("UPDATE billables SET effective_rate = ? WHERE id = ?;", effectiveRateOf(principal, createdAt, installments), bID)
+		if err != nil {
+			return err
+		}
+	}
+	return
+}
+
+func migrateTenor(tx *sql.Tx) (err error) {
+	// installments are no longer weekly only, the duration counts installments
+	err = execAll(tx, "ALTER TABLE billables RENAME COLUMN dur_week TO tenor;")
+	return
+}
+
+func migrateTimezone(tx *sql.Tx) (err error) {
+	// older due dates were computed in UTC
+	err = execAll(tx, "ALTER TABLE billables ADD COLUMN timezone VARCHAR(64) DEFAULT 'UTC';")
+	return
+}
+
+func migrateFees(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS fees (
+    id VARCHAR(255) PRIMARY KEY,
+    billable_id VARCHAR(255),
+    installment_seq INTEGER,
+    kind VARCHAR(32),
+    currency VARCHAR(3),
+    amount INTEGER,
+    accrued_to DATETIME,
+    created_at DATETIME,
+    FOREIGN KEY (billable_id) REFERENCES billables(id)
+);`,
+		"CREATE INDEX IF NOT EXISTS idx_fees_billable_id ON fees (billable_id, accrued_to);",
+	)
+	return
+}
+
+func migratePaymentAllocation(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		"ALTER TABLE payments ADD COLUMN amount_principal INTEGER DEFAULT 0;",
+		"ALTER TABLE payments ADD COLUMN amount_interest INTEGER DEFAULT 0;",
+		"ALTER TABLE payments ADD COLUMN amount_fees INTEGER DEFAULT 0;",
+		"ALTER TABLE payments ADD COLUMN amount_penalties INTEGER DEFAULT 0;",
+	)
+	if err != nil {
+		return
+	}
+	err = backfillPaymentAllocations(tx)
+	return
+}
+
+// backfillPaymentAllocations splits entries booked before allocations were
+// recorded into the components they paid. Each entry gets what the running
+// total paid after it covers over what the total before it did, oldest
+// installment first in the default order.
+func backfillPaymentAllocations(tx *sql.Tx) (err error) {
+	bIDs, err := queryStrings(tx, "SELECT DISTINCT billable_id FROM payments;")
+	if err != nil {
+		return
+	}
+
+	for _, bID := range bIDs {
+		var installments []Installment
+		rows, err := tx.Query("SELECT amount_due, interest_due FROM installments WHERE billable_id = ? ORDER BY seq ASC;", bID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var inst Installment
+			if err = rows.Scan(&inst.AmountDue, &inst.InterestDue); err != nil {
+				rows.Close()
+				return err
+			}
+			installments = append(installments, inst)
+		}
+		rows.Close()
+
+		var fees []Fee
+		rows, err = tx.Query("SELECT installment_seq, kind, amount FROM fees WHERE billable_id = ?;", bID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var fee Fee
+			if err = rows.Scan(&fee.InstallmentSeq, &fee.Kind, &fee.Amount.Amount); err != nil {
+				rows.Close()
+				return err
+			}
+			fees = append(fees, fee)
+		}
+		rows.Close()
+
+		type entry struct {
+			id     string
+			amount int
+		}
+		var entries []entry
+		rows, err = tx.Query("SELECT id, amount FROM payments WHERE billable_id = ? ORDER BY paid_at ASC, created_at ASC, id ASC;", bID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var e entry
+			if err = rows.Scan(&e.id, &e.amount); err != nil {
+				rows.Close()
+				return err
+			}
+			entries = append(entries, e)
+		}
+		rows.Close()
+
+		owed := owedOf(installments, fees, Allocation{})
+		paid, before := 0, Allocation{}
+		for _, e := range entries {
+			paid += e.amount
+			after, _ := allocate(owed, DefaultAllocationOrder, paid)
+			_, err = tx.Exec(
+				"UPDATE payments SET amount_principal = ?, amount_interest = ?, amount_fees = ?, amount_penalties = ? WHERE id = ?;",
+				after.Principal-before.Principal, after.Interest-before.Interest, after.Fees-before.Fees, after.Penalties-before.Penalties, e.id,
+			)
+			if err != nil {
+				return err
+			}
+			before = after
+		}
+	}
+	return
+}
+
+func migrateGracePeriods(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		"ALTER TABLE billables ADD COLUMN grace_days INTEGER DEFAULT 0;",
+		"ALTER TABLE billables ADD COLUMN grace_cutoff VARCHAR(5) DEFAULT '';",
+	)
+	return
+}
+
+func migrateDelinquencyEpisodes(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS delinquency_episodes (
+    id VARCHAR(255) PRIMARY KEY,
+    billable_id VARCHAR(255),
+    started_at DATETIME,
+    ended_at DATETIME,
+    end_status VARCHAR(16),
+    max_days_past_due INTEGER,
+    max_arrears INTEGER
+);`,
+		"CREATE INDEX IF NOT EXISTS idx_delinquency_episodes_billable_id ON delinquency_episodes (billable_id, started_at);",
+	)
+	return
+}
+
+func migrateProducts(tx *sql.Tx) (err error) {
+	err = execAll(tx, "ALTER TABLE billables ADD COLUMN product VARCHAR(64) DEFAULT '';")
+	return
+}
+
+func migrateRules(tx *sql.Tx) (err error) {
+	err = execAll(tx, `CREATE TABLE IF NOT EXISTS rules (
+    id VARCHAR(255) PRIMARY KEY,
+    kind VARCHAR(32),
+    name VARCHAR(255),
+    expression TEXT,
+    active BOOLEAN DEFAULT FALSE,
+    created_at DATETIME,
+    updated_at DATETIME
+);`)
+	return
+}
+
+func migrateBorrowers(tx *sql.Tx) (err error) {
+	err = execAll(tx,
+		`CREATE TABLE IF NOT EXISTS borrowers (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255),
+    created_at DATETIME,
+    updated_at DATETIME
+);`,
+		"ALTER TABLE billables ADD COLUMN borrower_id VARCHAR(255) DEFAULT '';",
+		"CREATE INDEX IF NOT EXISTS idx_billables_borrower_id ON billables (borrower_id, created_at);",
+	)
+	return
+}
+
+func execAll(tx *sql.Tx, queries ...string) (err error) {
+	for _, query := range queries {
+		if _, err = tx.Exec(query); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func queryStrings(tx *sql.Tx, query string, args ...any) (out []string, err error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return
+		}
+		out = append(out, v)
+	}
+	err = rows.Err()
+	return
+}
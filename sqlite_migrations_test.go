@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore_Migrate(t *testing.T) {
+	newStore := func(t *testing.T) (*sql.DB, *SQLiteStore) {
+		db, err := sql.Open("sqlite3", ":memory:")
+		require.NoError(t, err)
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+
+		store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+		require.NoError(t, err)
+		return db, store
+	}
+
+	t.Run("fresh_database", func(t *testing.T) {
+		// arrange
+		_, store := newStore(t)
+
+		// act
+		errFirst := store.Migrate()
+		errAgain := store.Migrate()
+		version, err := store.SchemaVersion()
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errAgain)
+		assert.NoError(t, err)
+		assert.Equal(t, schemaMigrations[len(schemaMigrations)-1].Version, version)
+	})
+
+	t.Run("legacy_database", func(t *testing.T) {
+		// arrange
+		db, store := newStore(t)
+		createdAt := time.Date(2024, 5, 24, 10, 34, 23, 0, time.FixedZone("WIB", 7*60*60))
+		_, err := db.Exec(MigrationQuery)
+		require.NoError(t, err)
+		_, err = db.Exec(
+			"INSERT INTO billables (id, amount, principal, dur_week, created_at, due_at) VALUES (?, ?, ?, ?, ?, ?);",
+			"ABC000001", 5_500_000, 5_000_000, 50, createdAt, createdAt.AddDate(0, 50, 0),
+		)
+		require.NoError(t, err)
+		accumulated := 0
+		for i, amount := range []int{110_000, 110_000, 110_000, 50_000} {
+			accumulated += amount
+			_, err = db.Exec(
+				"INSERT INTO payments (id, billable_id, amount, amount_accumulated, paid_at, created_at) VALUES (?, ?, ?, ?, ?, ?);",
+				fmt.Sprintf("P%d", i), "ABC000001", amount, accumulated, createdAt, createdAt,
+			)
+			require.NoError(t, err)
+		}
+
+		// act
+		err = store.Migrate()
+
+		// assert
+		require.NoError(t, err)
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               store,
+			GenerateCurrentDate: func() time.Time { return createdAt.AddDate(0, 0, 8) },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+		})
+		require.NoError(t, err)
+
+		billable, err := b.GetBillable("ABC000001")
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(5_500_000, CurrencyIDR), billable.Amount)
+		assert.Equal(t, 50, billable.Tenor)
+		assert.Equal(t, .1, billable.InterestRate)
+		assert.Equal(t, FrequencyWeekly, billable.Frequency)
+		assert.Equal(t, BillableStatusActive, billable.Status)
+		assert.True(t, createdAt.AddDate(0, 0, 7*50).Equal(billable.DueAt))
+
+		schedule, err := b.GetSchedule("ABC000001")
+		assert.NoError(t, err)
+		require.Len(t, schedule, 50)
+		assert.True(t, createdAt.AddDate(0, 0, 7).Equal(schedule[0].DueAt))
+		assert.Equal(t, InstallmentStatusPaid, schedule[2].Status)
+		assert.Equal(t, 50_000, schedule[3].AmountPaid)
+		assert.Equal(t, InstallmentStatusPartial, schedule[3].Status)
+		total := 0
+		for _, inst := range schedule {
+			total += inst.AmountDue
+		}
+		assert.Equal(t, 5_500_000, total)
+
+		recorded, err := b.BackfillEvents()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, recorded)
+		assert.NoError(t, b.RebuildProjection("ABC000001"))
+		rebuilt, err := b.GetSchedule("ABC000001")
+		assert.NoError(t, err)
+		assert.Equal(t, schedule, rebuilt)
+
+		_, err = b.MakePayment("ABC000001", InputMakePayment{Amount: 60_000, PaidAt: createdAt.AddDate(0, 0, 8)})
+		assert.NoError(t, err)
+		schedule, err = b.GetSchedule("ABC000001")
+		assert.NoError(t, err)
+		assert.Equal(t, InstallmentStatusPaid, schedule[3].Status)
+	})
+
+	t.Run("committed_database", func(t *testing.T) {
+		// arrange
+		committed, err := os.ReadFile("db.sqlite")
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "db.sqlite")
+		require.NoError(t, os.WriteFile(path, committed, 0o644))
+		db, err := sql.Open("sqlite3", path)
+		require.NoError(t, err)
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+		require.NoError(t, err)
+
+		// act
+		err = store.Migrate()
+
+		// assert
+		require.NoError(t, err)
+		b, err := NewBillerEngine(BillerEngineConfig{
+			Store:               store,
+			GenerateCurrentDate: func() time.Time { return time.Now() },
+
+			DefaultLoanDurationWeeks:            50,
+			DefaultInterestRatePercentage:       .1,
+			PaymentSkipCountDeliquencyThreshold: 2,
+		})
+		require.NoError(t, err)
+
+		outstanding, err := b.GetOutstanding("ABC000002", time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(440_000, CurrencyIDR), outstanding.Paid)
+		_, err = b.CreateBorrower(InputCreateBorrower{ID: "ani", Name: "Ani"})
+		assert.NoError(t, err)
+		_, err = b.MakeBillable(InputMakeBillable{BID: "ABC000004", BorrowerID: "ani", Principal: 5_000_000})
+		assert.NoError(t, err)
+	})
+}
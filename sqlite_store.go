@@ -0,0 +1,637 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	validator "github.com/avrebarra/minivalidator"
+	"github.com/mattn/go-sqlite3"
+)
+
+type SQLiteStoreConfig struct {
+	DB *sql.DB `validate:"required"`
+}
+
+type SQLiteStore struct {
+	sqliteRepository
+	Conf SQLiteStoreConfig
+}
+
+func NewSQLiteStore(conf SQLiteStoreConfig) (out *SQLiteStore, err error) {
+	if err = validator.Validate(conf); err != nil {
+		err = fmt.Errorf("bad config: %w", err)
+		return
+	}
+	out = &SQLiteStore{Conf: conf, sqliteRepository: sqliteRepository{q: conf.DB}}
+	return
+}
+
+func (s *SQLiteStore) Transact(fn func(tx BillerRepository) error) (err error) {
+	tx, err := s.Conf.DB.Begin()
+	if err != nil {
+		err = fmt.Errorf("failed to begin transaction: %w", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err = fn(sqliteRepository{q: tx}); err != nil {
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		err = fmt.Errorf("failed to commit transaction: %w", err)
+		return
+	}
+	return
+}
+
+// sqliteQuerier is satisfied by both *sql.DB and *sql.Tx
+type sqliteQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type sqliteRepository struct {
+	q sqliteQuerier
+}
+
+func (r sqliteRepository) InsertBillable(billable Billable) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO billables (id, borrower_id, currency, amount, principal, interest, tenor, interest_rate, interest_model, effective_rate, frequency, timezone, grace_days, grace_cutoff, product, status, created_at, due_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		billable.ID, billable.BorrowerID, billable.Amount.Currency, billable.Amount.Amount, billable.Principal.Amount, billable.Interest.Amount, billable.Tenor, billable.InterestRate, billable.InterestModel, billable.EffectiveRate, billable.Frequency, billable.Timezone, billable.GraceDays, billable.GraceCutoff, billable.Product, billable.Status, billable.CreatedAt, billable.DueAt,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+const sqliteBillableColumns = "id, borrower_id, currency, amount, principal, interest, tenor, interest_rate, interest_model, effective_rate, frequency, timezone, grace_days, grace_cutoff, product, status, created_at, due_at"
+
+func (r sqliteRepository) GetBillable(bID string) (out Billable, err error) {
+	out, err = scanBillable(r.q.QueryRow("SELECT "+sqliteBillableColumns+" FROM billables WHERE id = ?", bID))
+	err = notFoundOf(err)
+	return
+}
+
+func scanBillable(row interface{ Scan(dest ...any) error }) (out Billable, err error) {
+	var currency Currency
+	err = row.Scan(&out.ID, &out.BorrowerID, &currency, &out.Amount.Amount, &out.Principal.Amount, &out.Interest.Amount, &out.Tenor, &out.InterestRate, &out.InterestModel, &out.EffectiveRate, &out.Frequency, &out.Timezone, &out.GraceDays, &out.GraceCutoff, &out.Product, &out.Status, &out.CreatedAt, &out.DueAt)
+	if err != nil {
+		return
+	}
+	out.Amount.Currency, out.Principal.Currency, out.Interest.Currency = currency, currency, currency
+	return
+}
+
+func (r sqliteRepository) UpdateBillableStatus(bID string, from, to BillableStatus) (err error) {
+	res, err := r.q.Exec("UPDATE billables SET status = ? WHERE id = ? AND status = ?;", to, bID, from)
+	if err != nil {
+		return
+	}
+	err = conflictOf(res)
+	return
+}
+
+func (r sqliteRepository) InsertBorrower(borrower Borrower) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO borrowers (id, name, created_at, updated_at) VALUES (?, ?, ?, ?);",
+		borrower.ID, borrower.Name, borrower.CreatedAt, borrower.UpdatedAt,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+func (r sqliteRepository) GetBorrower(borrowerID string) (out Borrower, err error) {
+	err = r.q.QueryRow("SELECT id, name, created_at, updated_at FROM borrowers WHERE id = ?", borrowerID).
+		Scan(&out.ID, &out.Name, &out.CreatedAt, &out.UpdatedAt)
+	err = notFoundOf(err)
+	return
+}
+
+func (r sqliteRepository) ListBorrowers() (out []Borrower, err error) {
+	rows, err := r.q.Query("SELECT id, name, created_at, updated_at FROM borrowers ORDER BY created_at ASC, id ASC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var borrower Borrower
+		if err = rows.Scan(&borrower.ID, &borrower.Name, &borrower.CreatedAt, &borrower.UpdatedAt); err != nil {
+			return
+		}
+		out = append(out, borrower)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) UpdateBorrower(borrower Borrower) (err error) {
+	res, err := r.q.Exec("UPDATE borrowers SET name = ?, updated_at = ? WHERE id = ?;", borrower.Name, borrower.UpdatedAt, borrower.ID)
+	if err != nil {
+		return
+	}
+	err = notFoundOfResult(res)
+	return
+}
+
+func (r sqliteRepository) DeleteBorrower(borrowerID string) (err error) {
+	res, err := r.q.Exec("DELETE FROM borrowers WHERE id = ?;", borrowerID)
+	if err != nil {
+		return
+	}
+	err = notFoundOfResult(res)
+	return
+}
+
+func (r sqliteRepository) ListBorrowerBillables(borrowerID string) (out []Billable, err error) {
+	rows, err := r.q.Query("SELECT "+sqliteBillableColumns+" FROM billables WHERE borrower_id = ? ORDER BY created_at ASC, id ASC", borrowerID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var billable Billable
+		if billable, err = scanBillable(rows); err != nil {
+			return
+		}
+		out = append(out, billable)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) InsertTransition(t BillableTransition) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO billable_transitions (id, billable_id, from_status, to_status, reason, created_at) VALUES (?, ?, ?, ?, ?, ?);",
+		t.ID, t.BillableID, t.FromStatus, t.ToStatus, t.Reason, t.CreatedAt,
+	)
+	return
+}
+
+func (r sqliteRepository) ListTransitions(bID string) (out []BillableTransition, err error) {
+	rows, err := r.q.Query("SELECT id, billable_id, from_status, to_status, reason, created_at FROM billable_transitions WHERE billable_id = ? ORDER BY created_at ASC, id ASC", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t BillableTransition
+		if err = rows.Scan(&t.ID, &t.BillableID, &t.FromStatus, &t.ToStatus, &t.Reason, &t.CreatedAt); err != nil {
+			return
+		}
+		out = append(out, t)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) InsertInstallments(installments []Installment) (err error) {
+	for _, inst := range installments {
+		_, err = r.q.Exec(
+			"INSERT INTO installments (billable_id, seq, due_at, amount_due, interest_due, amount_paid, status) VALUES (?, ?, ?, ?, ?, ?, ?);",
+			inst.BillableID, inst.Seq, inst.DueAt, inst.AmountDue, inst.InterestDue, inst.AmountPaid, inst.Status,
+		)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r sqliteRepository) ListInstallments(bID string) (out []Installment, err error) {
+	rows, err := r.q.Query("SELECT billable_id, seq, due_at, amount_due, interest_due, amount_paid, status FROM installments WHERE billable_id = ? ORDER BY seq ASC", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inst Installment
+		if err = rows.Scan(&inst.BillableID, &inst.Seq, &inst.DueAt, &inst.AmountDue, &inst.InterestDue, &inst.AmountPaid, &inst.Status); err != nil {
+			return
+		}
+		out = append(out, inst)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) UpdateInstallment(inst Installment) (err error) {
+	res, err := r.q.Exec(
+		"UPDATE installments SET amount_paid = ?, status = ? WHERE billable_id = ? AND seq = ?;",
+		inst.AmountPaid, inst.Status, inst.BillableID, inst.Seq,
+	)
+	if err != nil {
+		return
+	}
+	err = notFoundOfResult(res)
+	return
+}
+
+func (r sqliteRepository) InsertPayment(p Payment) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO payments (id, billable_id, kind, currency, amount, amount_principal, amount_interest, amount_fees, amount_penalties, amount_unallocated, amount_rebated, reverses_id, reason, paid_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);",
+		p.ID, p.BillableID, p.Kind, p.Amount.Currency, p.Amount.Amount, p.AmountPrincipal.Amount, p.AmountInterest.Amount, p.AmountFees.Amount, p.AmountPenalties.Amount, p.AmountUnallocated.Amount, p.AmountRebated.Amount, p.ReversesID, p.Reason, p.PaidAt, p.CreatedAt,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+const sqlitePaymentColumns = "id, billable_id, kind, currency, amount, amount_principal, amount_interest, amount_fees, amount_penalties, amount_unallocated, amount_rebated, reverses_id, reason, paid_at, created_at"
+
+// scanPayment reads a row of sqlitePaymentColumns, every amount of a payment
+// shares its currency.
+func scanPayment(row interface{ Scan(dest ...any) error }) (out Payment, err error) {
+	var currency Currency
+	err = row.Scan(&out.ID, &out.BillableID, &out.Kind, &currency, &out.Amount.Amount, &out.AmountPrincipal.Amount, &out.AmountInterest.Amount, &out.AmountFees.Amount, &out.AmountPenalties.Amount, &out.AmountUnallocated.Amount, &out.AmountRebated.Amount, &out.ReversesID, &out.Reason, &out.PaidAt, &out.CreatedAt)
+	if err != nil {
+		return
+	}
+	for _, amount := range []*Money{&out.Amount, &out.AmountAccumulated, &out.AmountPrincipal, &out.AmountInterest, &out.AmountFees, &out.AmountPenalties, &out.AmountUnallocated, &out.AmountRebated} {
+		amount.Currency = currency
+	}
+	return
+}
+
+func (r sqliteRepository) GetPayment(paymentID string) (out Payment, err error) {
+	out, err = scanPayment(r.q.QueryRow("SELECT "+sqlitePaymentColumns+" FROM payments WHERE id = ?", paymentID))
+	err = notFoundOf(err)
+	return
+}
+
+func (r sqliteRepository) ListPayments(bID string) (out []Payment, err error) {
+	rows, err := r.q.Query("SELECT "+sqlitePaymentColumns+" FROM payments WHERE billable_id = ?", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Payment
+		if p, err = scanPayment(rows); err != nil {
+			return
+		}
+		out = append(out, p)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) InsertFee(fee Fee) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO fees (id, billable_id, installment_seq, kind, currency, amount, accrued_to, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);",
+		fee.ID, fee.BillableID, fee.InstallmentSeq, fee.Kind, fee.Amount.Currency, fee.Amount.Amount, fee.AccruedTo, fee.CreatedAt,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+func (r sqliteRepository) ListFees(bID string) (out []Fee, err error) {
+	rows, err := r.q.Query("SELECT id, billable_id, installment_seq, kind, currency, amount, accrued_to, created_at FROM fees WHERE billable_id = ? ORDER BY accrued_to ASC, created_at ASC, id ASC", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var fee Fee
+		if err = rows.Scan(&fee.ID, &fee.BillableID, &fee.InstallmentSeq, &fee.Kind, &fee.Amount.Currency, &fee.Amount.Amount, &fee.AccruedTo, &fee.CreatedAt); err != nil {
+			return
+		}
+		out = append(out, fee)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) InsertDelinquencyEpisode(ep DelinquencyEpisode) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO delinquency_episodes (id, billable_id, started_at, ended_at, end_status, max_days_past_due, max_arrears) VALUES (?, ?, ?, ?, ?, ?, ?);",
+		ep.ID, ep.BillableID, ep.StartedAt, nullTimeOf(ep.EndedAt), ep.EndStatus, ep.MaxDaysPastDue, ep.MaxArrears,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+func (r sqliteRepository) UpdateDelinquencyEpisode(ep DelinquencyEpisode) (err error) {
+	res, err := r.q.Exec(
+		"UPDATE delinquency_episodes SET ended_at = ?, end_status = ?, max_days_past_due = ?, max_arrears = ? WHERE id = ?;",
+		nullTimeOf(ep.EndedAt), ep.EndStatus, ep.MaxDaysPastDue, ep.MaxArrears, ep.ID,
+	)
+	if err != nil {
+		return
+	}
+	err = notFoundOfResult(res)
+	return
+}
+
+func (r sqliteRepository) ListDelinquencyEpisodes(bID string) (out []DelinquencyEpisode, err error) {
+	rows, err := r.q.Query("SELECT id, billable_id, started_at, ended_at, end_status, max_days_past_due, max_arrears FROM delinquency_episodes WHERE billable_id = ? ORDER BY started_at ASC, id ASC", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ep DelinquencyEpisode
+		var endedAt sql.NullTime
+		if err = rows.Scan(&ep.ID, &ep.BillableID, &ep.StartedAt, &endedAt, &ep.EndStatus, &ep.MaxDaysPastDue, &ep.MaxArrears); err != nil {
+			return
+		}
+		if endedAt.Valid {
+			ep.EndedAt = &endedAt.Time
+		}
+		out = append(out, ep)
+	}
+	err = rows.Err()
+	return
+}
+
+func nullTimeOf(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+func (r sqliteRepository) InsertRule(rule Rule) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO rules (id, kind, name, expression, active, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?);",
+		rule.ID, rule.Kind, rule.Name, rule.Expression, rule.Active, rule.CreatedAt, rule.UpdatedAt,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+const sqliteRuleColumns = "id, kind, name, expression, active, created_at, updated_at"
+
+func (r sqliteRepository) GetRule(ruleID string) (out Rule, err error) {
+	err = r.q.QueryRow("SELECT "+sqliteRuleColumns+" FROM rules WHERE id = ?", ruleID).
+		Scan(&out.ID, &out.Kind, &out.Name, &out.Expression, &out.Active, &out.CreatedAt, &out.UpdatedAt)
+	err = notFoundOf(err)
+	return
+}
+
+func (r sqliteRepository) ListRules() (out []Rule, err error) {
+	rows, err := r.q.Query("SELECT " + sqliteRuleColumns + " FROM rules ORDER BY created_at ASC, id ASC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule Rule
+		if err = rows.Scan(&rule.ID, &rule.Kind, &rule.Name, &rule.Expression, &rule.Active, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return
+		}
+		out = append(out, rule)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) UpdateRule(rule Rule) (err error) {
+	res, err := r.q.Exec("UPDATE rules SET active = ?, updated_at = ? WHERE id = ?;", rule.Active, rule.UpdatedAt, rule.ID)
+	if err != nil {
+		return
+	}
+	err = notFoundOfResult(res)
+	return
+}
+
+func (r sqliteRepository) AppendEvent(e BillableEvent) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO events (id, billable_id, seq, type, payload, prev_hash, hash, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);",
+		e.ID, e.BillableID, e.Seq, e.Type, e.Payload, e.PrevHash, e.Hash, e.CreatedAt,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+const sqliteEventColumns = "id, billable_id, seq, type, payload, prev_hash, hash, created_at"
+
+func (r sqliteRepository) ListEvents(bID string) (out []BillableEvent, err error) {
+	rows, err := r.q.Query("SELECT "+sqliteEventColumns+" FROM events WHERE billable_id = ? ORDER BY seq ASC", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e BillableEvent
+		if err = rows.Scan(&e.ID, &e.BillableID, &e.Seq, &e.Type, &e.Payload, &e.PrevHash, &e.Hash, &e.CreatedAt); err != nil {
+			return
+		}
+		out = append(out, e)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) LastEvent(bID string) (out BillableEvent, err error) {
+	err = r.q.QueryRow("SELECT "+sqliteEventColumns+" FROM events WHERE billable_id = ? ORDER BY seq DESC LIMIT 1", bID).
+		Scan(&out.ID, &out.BillableID, &out.Seq, &out.Type, &out.Payload, &out.PrevHash, &out.Hash, &out.CreatedAt)
+	err = notFoundOf(err)
+	return
+}
+
+func (r sqliteRepository) ListEventStreams() (out []string, err error) {
+	rows, err := r.q.Query("SELECT DISTINCT billable_id FROM events ORDER BY billable_id ASC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bID string
+		if err = rows.Scan(&bID); err != nil {
+			return
+		}
+		out = append(out, bID)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) ListBillablesWithoutEvents() (out []string, err error) {
+	rows, err := r.q.Query("SELECT id FROM billables WHERE id NOT IN (SELECT DISTINCT billable_id FROM events) ORDER BY created_at ASC, id ASC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bID string
+		if err = rows.Scan(&bID); err != nil {
+			return
+		}
+		out = append(out, bID)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) DeleteProjections(bID string) (err error) {
+	for _, query := range []string{
+		"DELETE FROM payments WHERE billable_id = ?;",
+		"DELETE FROM fees WHERE billable_id = ?;",
+		"DELETE FROM installments WHERE billable_id = ?;",
+		"DELETE FROM billable_transitions WHERE billable_id = ?;",
+		"DELETE FROM billables WHERE id = ?;",
+	} {
+		if _, err = r.q.Exec(query, bID); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r sqliteRepository) InsertJournalEntry(entry JournalEntry) (err error) {
+	_, err = r.q.Exec(
+		"INSERT INTO journal_entries (id, billable_id, description, reference, currency, posted_at) VALUES (?, ?, ?, ?, ?, ?);",
+		entry.ID, entry.BillableID, entry.Description, entry.Reference, entry.Currency, entry.PostedAt,
+	)
+	if err = duplicateOf(err); err != nil {
+		return
+	}
+	for i, line := range entry.Lines {
+		_, err = r.q.Exec(
+			"INSERT INTO journal_lines (entry_id, line_no, account, debit, credit) VALUES (?, ?, ?, ?, ?);",
+			entry.ID, i+1, line.Account, line.Debit, line.Credit,
+		)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (r sqliteRepository) ListJournalEntries(bID string) (out []JournalEntry, err error) {
+	rows, err := r.q.Query(
+		"SELECT e.id, e.billable_id, e.description, e.reference, e.currency, e.posted_at, l.account, l.debit, l.credit "+
+			"FROM journal_entries e JOIN journal_lines l ON l.entry_id = e.id "+
+			"WHERE e.billable_id = ? ORDER BY e.posted_at ASC, e.id ASC, l.line_no ASC", bID)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry JournalEntry
+		var line JournalLine
+		if err = rows.Scan(&entry.ID, &entry.BillableID, &entry.Description, &entry.Reference, &entry.Currency, &entry.PostedAt, &line.Account, &line.Debit, &line.Credit); err != nil {
+			return
+		}
+		if len(out) == 0 || out[len(out)-1].ID != entry.ID {
+			out = append(out, entry)
+		}
+		last := &out[len(out)-1]
+		last.Lines = append(last.Lines, line)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) ListAccountTotals() (out []AccountBalance, err error) {
+	rows, err := r.q.Query(
+		"SELECT l.account, e.currency, SUM(l.debit), SUM(l.credit) " +
+			"FROM journal_lines l JOIN journal_entries e ON e.id = l.entry_id " +
+			"GROUP BY l.account, e.currency ORDER BY l.account ASC, e.currency ASC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var balance AccountBalance
+		if err = rows.Scan(&balance.Account, &balance.Currency, &balance.Debit, &balance.Credit); err != nil {
+			return
+		}
+		out = append(out, balance)
+	}
+	err = rows.Err()
+	return
+}
+
+func (r sqliteRepository) InsertIdempotencyKey(record IdempotencyRecord) (err error) {
+	var expires sql.NullTime
+	if !record.ExpiresAt.IsZero() {
+		expires = sql.NullTime{Time: record.ExpiresAt, Valid: true}
+	}
+	var response sql.NullString
+	if record.Response != "" {
+		response = sql.NullString{String: record.Response, Valid: true}
+	}
+	_, err = r.q.Exec(
+		"INSERT INTO idempotency_keys (key, fingerprint, response, created_at, expires_at) VALUES (?, ?, ?, ?, ?);",
+		record.Key, record.Fingerprint, response, record.CreatedAt, expires,
+	)
+	err = duplicateOf(err)
+	return
+}
+
+func (r sqliteRepository) GetIdempotencyKey(key string) (out IdempotencyRecord, err error) {
+	var response sql.NullString
+	var expires sql.NullTime
+	err = r.q.QueryRow("SELECT key, fingerprint, response, created_at, expires_at FROM idempotency_keys WHERE key = ?", key).
+		Scan(&out.Key, &out.Fingerprint, &response, &out.CreatedAt, &expires)
+	if err = notFoundOf(err); err != nil {
+		return
+	}
+	out.Response = response.String
+	out.ExpiresAt = expires.Time
+	return
+}
+
+func (r sqliteRepository) UpdateIdempotencyResponse(key string, response string) (err error) {
+	res, err := r.q.Exec("UPDATE idempotency_keys SET response = ? WHERE key = ?;", response, key)
+	if err != nil {
+		return
+	}
+	err = notFoundOfResult(res)
+	return
+}
+
+func (r sqliteRepository) DeleteIdempotencyKey(key string) (err error) {
+	_, err = r.q.Exec("DELETE FROM idempotency_keys WHERE key = ?;", key)
+	return
+}
+
+// duplicateOf reports constraint violations on insert as ErrStoreDuplicateID.
+func duplicateOf(err error) error {
+	var dbErr sqlite3.Error
+	if errors.As(err, &dbErr) && dbErr.Code == sqlite3.ErrConstraint {
+		return fmt.Errorf("%w: %s", ErrStoreDuplicateID, err)
+	}
+	return err
+}
+
+func notFoundOf(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrStoreNotFound
+	}
+	return err
+}
+
+func notFoundOfResult(res sql.Result) error {
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrStoreNotFound
+	}
+	return nil
+}
+
+func conflictOf(res sql.Result) error {
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrStoreConflict
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestDB() *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		panic(err)
+	}
+	db.SetMaxOpenConns(1) // every connection to :memory: gets its own database
+
+	store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+	if err != nil {
+		panic(err)
+	}
+	if err = store.Migrate(); err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+// setupTestFileDB opens a migrated database file with a pool of connections,
+// so concurrent writers race the way they do against a real deployment.
+func setupTestFileDB(t *testing.T) *sql.DB {
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=10000&_journal_mode=WAL", filepath.Join(t.TempDir(), "db.sqlite"))
+	db, err := sql.Open("sqlite3", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+	require.NoError(t, err)
+	require.NoError(t, store.Migrate())
+	return db
+}
+
+func TestNewSQLiteStore(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		// arrange
+		db := setupTestDB()
+		defer db.Close()
+
+		// act
+		store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+
+		// assert
+		assert.NotEmpty(t, store)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid_config", func(t *testing.T) {
+		// act
+		store, err := NewSQLiteStore(SQLiteStoreConfig{})
+
+		// assert
+		assert.Empty(t, store)
+		assert.Error(t, err)
+	})
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testBillerStore(t, func() BillerStore {
+		db := setupTestDB()
+		t.Cleanup(func() { db.Close() })
+
+		store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestSQLiteStore_EngineFlows(t *testing.T) {
+	db := setupTestFileDB(t)
+
+	store, err := NewSQLiteStore(SQLiteStoreConfig{DB: db})
+	require.NoError(t, err)
+	seedTestBorrower(store)
+
+	testBillerEngineFlows(t, store)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrStoreNotFound    = errors.New("record not found")
+	ErrStoreDuplicateID = errors.New("duplicate id")
+	ErrStoreConflict    = errors.New("record changed concurrently")
+)
+
+// BillerStore persists billables, their schedules and payments. Writes that
+// must happen together go through Transact, everything else may use the store
+// directly.
+type BillerStore interface {
+	BillerRepository
+
+	// Transact runs fn against a transactional view of the store, committing
+	// when fn returns nil and discarding every change otherwise.
+	Transact(fn func(tx BillerRepository) error) error
+}
+
+// BillerRepository lists the persistence operations available both on a
+// store and within one of its transactions. Lookups of missing records fail
+// with ErrStoreNotFound.
+type BillerRepository interface {
+	InsertBillable(billable Billable) error // fails with ErrStoreDuplicateID on reused ids
+	GetBillable(bID string) (Billable, error)
+	UpdateBillableStatus(bID string, from, to BillableStatus) error // fails with ErrStoreConflict unless status is from
+
+	InsertBorrower(borrower Borrower) error // fails with ErrStoreDuplicateID on reused ids
+	GetBorrower(borrowerID string) (Borrower, error)
+	ListBorrowers() ([]Borrower, error)                          // oldest first
+	UpdateBorrower(borrower Borrower) error                      // saves name and update time
+	DeleteBorrower(borrowerID string) error                      // callers check the borrower has no billables
+	ListBorrowerBillables(borrowerID string) ([]Billable, error) // oldest first
+
+	InsertTransition(transition BillableTransition) error
+	ListTransitions(bID string) ([]BillableTransition, error) // oldest first
+
+	InsertInstallments(installments []Installment) error
+	ListInstallments(bID string) ([]Installment, error) // by sequence
+	UpdateInstallment(installment Installment) error    // saves amount paid and status
+
+	InsertPayment(payment Payment) error
+	GetPayment(paymentID string) (Payment, error)
+	ListPayments(bID string) ([]Payment, error) // unordered, see getPayments for ledger order
+
+	InsertFee(fee Fee) error
+	ListFees(bID string) ([]Fee, error) // by accrual date
+
+	InsertDelinquencyEpisode(episode DelinquencyEpisode) error
+	UpdateDelinquencyEpisode(episode DelinquencyEpisode) error        // saves the end and maxima
+	ListDelinquencyEpisodes(bID string) ([]DelinquencyEpisode, error) // oldest first
+
+	InsertRule(rule Rule) error
+	GetRule(ruleID string) (Rule, error)
+	ListRules() ([]Rule, error) // oldest first
+	UpdateRule(rule Rule) error // saves the active flag and update time
+
+	AppendEvent(event BillableEvent) error          // fails with ErrStoreDuplicateID when the position is taken
+	ListEvents(bID string) ([]BillableEvent, error) // by position
+	LastEvent(bID string) (BillableEvent, error)
+	ListEventStreams() ([]string, error)           // ids of billables having events
+	ListBillablesWithoutEvents() ([]string, error) // ids of billables stored before events were, oldest first
+	DeleteProjections(bID string) error            // drops the billable rows that are rebuilt from its events
+
+	InsertJournalEntry(entry JournalEntry) error
+	ListJournalEntries(bID string) ([]JournalEntry, error) // oldest first, with their lines
+	ListAccountTotals() ([]AccountBalance, error)          // debits and credits summed per account
+
+	InsertIdempotencyKey(record IdempotencyRecord) error
+	GetIdempotencyKey(key string) (IdempotencyRecord, error)
+	UpdateIdempotencyResponse(key string, response string) error
+	DeleteIdempotencyKey(key string) error
+}
+
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	Response    string // empty while the request is in progress
+	CreatedAt   time.Time
+	ExpiresAt   time.Time // zero keeps the key forever
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBillerStore checks the behavior every BillerStore implementation shares.
+func testBillerStore(t *testing.T, newStore func() BillerStore) {
+	curdate := time.Now().UTC().Truncate(time.Second)
+	newBillable := func() Billable {
+		return Billable{
+			ID:            xid.New().String(),
+			BorrowerID:    "borrower",
+			Amount:        NewMoney(5_500_000, CurrencyUSD),
+			Principal:     NewMoney(5_000_000, CurrencyUSD),
+			Interest:      NewMoney(500_000, CurrencyUSD),
+			Tenor:         50,
+			InterestRate:  .1,
+			InterestModel: InterestModelFlat,
+			EffectiveRate: .105,
+			Frequency:     FrequencyWeekly,
+			Timezone:      "Asia/Jakarta",
+			GraceDays:     3,
+			GraceCutoff:   "17:00",
+			Product:       "paylater",
+			Status:        BillableStatusActive,
+			CreatedAt:     curdate,
+			DueAt:         curdate.AddDate(0, 0, 350),
+		}
+	}
+	newInstallments := func(billable Billable) []Installment {
+		out, err := makeInstallments(billable, dueDatesOf(t, billable))
+		require.NoError(t, err)
+		return out
+	}
+
+	t.Run("billables", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		billable := newBillable()
+
+		// act
+		errInsert := store.InsertBillable(billable)
+		errDuplicate := store.InsertBillable(billable)
+		errUpdate := store.UpdateBillableStatus(billable.ID, BillableStatusActive, BillableStatusDelinquent)
+		errStale := store.UpdateBillableStatus(billable.ID, BillableStatusActive, BillableStatusPaidOff)
+		_, errMissing := store.GetBillable("unknown")
+
+		// assert
+		assert.NoError(t, errInsert)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+		assert.NoError(t, errUpdate)
+		assert.ErrorIs(t, errStale, ErrStoreConflict)
+		assert.ErrorIs(t, errMissing, ErrStoreNotFound)
+
+		stored, err := store.GetBillable(billable.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, billable.ID, stored.ID)
+		assert.Equal(t, billable.BorrowerID, stored.BorrowerID)
+		assert.Equal(t, billable.Amount, stored.Amount)
+		assert.Equal(t, billable.Frequency, stored.Frequency)
+		assert.Equal(t, billable.Timezone, stored.Timezone)
+		assert.Equal(t, billable.GraceDays, stored.GraceDays)
+		assert.Equal(t, billable.GraceCutoff, stored.GraceCutoff)
+		assert.Equal(t, billable.Product, stored.Product)
+		assert.Equal(t, BillableStatusDelinquent, stored.Status)
+		assert.True(t, billable.DueAt.Equal(stored.DueAt))
+	})
+
+	t.Run("borrowers", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		borrower := Borrower{ID: xid.New().String(), Name: "Ani", CreatedAt: curdate, UpdatedAt: curdate}
+		later := Borrower{ID: xid.New().String(), Name: "Budi", CreatedAt: curdate.Add(time.Hour), UpdatedAt: curdate.Add(time.Hour)}
+		billable, other := newBillable(), newBillable()
+		billable.BorrowerID, other.BorrowerID = borrower.ID, later.ID
+		require.NoError(t, store.InsertBillable(billable))
+		require.NoError(t, store.InsertBillable(other))
+
+		// act
+		errInsert := store.InsertBorrower(borrower)
+		errLater := store.InsertBorrower(later)
+		errDuplicate := store.InsertBorrower(borrower)
+		borrower.Name, borrower.UpdatedAt = "Ani Wijaya", curdate.Add(2*time.Hour)
+		errUpdate := store.UpdateBorrower(borrower)
+		errUpdateMissing := store.UpdateBorrower(Borrower{ID: "unknown"})
+		errDelete := store.DeleteBorrower(later.ID)
+		errDeleteMissing := store.DeleteBorrower(later.ID)
+		_, errGetMissing := store.GetBorrower(later.ID)
+
+		// assert
+		assert.NoError(t, errInsert)
+		assert.NoError(t, errLater)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+		assert.NoError(t, errUpdate)
+		assert.ErrorIs(t, errUpdateMissing, ErrStoreNotFound)
+		assert.NoError(t, errDelete)
+		assert.ErrorIs(t, errDeleteMissing, ErrStoreNotFound)
+		assert.ErrorIs(t, errGetMissing, ErrStoreNotFound)
+
+		stored, err := store.GetBorrower(borrower.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ani Wijaya", stored.Name)
+		assert.True(t, curdate.Equal(stored.CreatedAt))
+		assert.True(t, borrower.UpdatedAt.Equal(stored.UpdatedAt))
+
+		borrowers, err := store.ListBorrowers()
+		assert.NoError(t, err)
+		require.Len(t, borrowers, 1)
+		assert.Equal(t, borrower.ID, borrowers[0].ID)
+
+		billables, err := store.ListBorrowerBillables(borrower.ID)
+		assert.NoError(t, err)
+		require.Len(t, billables, 1)
+		assert.Equal(t, billable.ID, billables[0].ID)
+		assert.Equal(t, borrower.ID, billables[0].BorrowerID)
+	})
+
+	t.Run("installments", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		billable := newBillable()
+		require.NoError(t, store.InsertBillable(billable))
+		installments := newInstallments(billable)
+
+		// act
+		errInsert := store.InsertInstallments(installments)
+		installments[1].AmountPaid = 50_000
+		installments[1].Status = InstallmentStatusPartial
+		errUpdate := store.UpdateInstallment(installments[1])
+		errMissing := store.UpdateInstallment(Installment{BillableID: billable.ID, Seq: 99})
+
+		// assert
+		assert.NoError(t, errInsert)
+		assert.NoError(t, errUpdate)
+		assert.ErrorIs(t, errMissing, ErrStoreNotFound)
+
+		stored, err := store.ListInstallments(billable.ID)
+		assert.NoError(t, err)
+		require.Len(t, stored, 50)
+		assert.Equal(t, 1, stored[0].Seq)
+		assert.Equal(t, 50_000, stored[1].AmountPaid)
+		assert.Equal(t, InstallmentStatusPartial, stored[1].Status)
+		assert.Equal(t, InstallmentStatusUnpaid, stored[2].Status)
+	})
+
+	t.Run("payments", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		billable := newBillable()
+		require.NoError(t, store.InsertBillable(billable))
+		payment := Payment{
+			ID:                xid.New().String(),
+			BillableID:        billable.ID,
+			Kind:              PaymentKindPayment,
+			Amount:            NewMoney(110_000, CurrencyUSD),
+			AmountAccumulated: NewMoney(0, CurrencyUSD),
+			AmountPrincipal:   NewMoney(100_000, CurrencyUSD),
+			AmountInterest:    NewMoney(10_000, CurrencyUSD),
+			AmountFees:        NewMoney(0, CurrencyUSD),
+			AmountPenalties:   NewMoney(0, CurrencyUSD),
+			AmountUnallocated: NewMoney(0, CurrencyUSD),
+			AmountRebated:     NewMoney(0, CurrencyUSD),
+			PaidAt:            curdate,
+			CreatedAt:         curdate,
+		}
+
+		// act
+		errInsert := store.InsertPayment(payment)
+		errDuplicate := store.InsertPayment(payment)
+		_, errMissing := store.GetPayment("unknown")
+
+		// assert
+		assert.NoError(t, errInsert)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+		assert.ErrorIs(t, errMissing, ErrStoreNotFound)
+
+		stored, err := store.GetPayment(payment.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, NewMoney(110_000, CurrencyUSD), stored.Amount)
+		assert.Equal(t, NewMoney(0, CurrencyUSD), stored.AmountRebated)
+		assert.Equal(t, NewMoney(100_000, CurrencyUSD), stored.AmountPrincipal)
+		assert.Equal(t, NewMoney(10_000, CurrencyUSD), stored.AmountInterest)
+		assert.True(t, payment.PaidAt.Equal(stored.PaidAt))
+
+		payments, err := store.ListPayments(billable.ID)
+		assert.NoError(t, err)
+		assert.Len(t, payments, 1)
+	})
+
+	t.Run("fees", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		billable := newBillable()
+		require.NoError(t, store.InsertBillable(billable))
+		later := Fee{ID: xid.New().String(), BillableID: billable.ID, InstallmentSeq: 1, Kind: LateFeePenaltyInterest, Amount: NewMoney(300, CurrencyUSD), AccruedTo: curdate.AddDate(0, 0, 3), CreatedAt: curdate}
+		earlier := Fee{ID: xid.New().String(), BillableID: billable.ID, InstallmentSeq: 1, Kind: LateFeeFixed, Amount: NewMoney(10_000, CurrencyUSD), AccruedTo: curdate, CreatedAt: curdate}
+
+		// act
+		errLater := store.InsertFee(later)
+		errEarlier := store.InsertFee(earlier)
+		errDuplicate := store.InsertFee(earlier)
+
+		// assert
+		assert.NoError(t, errLater)
+		assert.NoError(t, errEarlier)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+
+		stored, err := store.ListFees(billable.ID)
+		assert.NoError(t, err)
+		require.Len(t, stored, 2)
+		assert.Equal(t, earlier.ID, stored[0].ID)
+		assert.Equal(t, NewMoney(10_000, CurrencyUSD), stored[0].Amount)
+		assert.Equal(t, LateFeePenaltyInterest, stored[1].Kind)
+		assert.True(t, later.AccruedTo.Equal(stored[1].AccruedTo))
+	})
+
+	t.Run("delinquency_episodes", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		bid := xid.New().String()
+		later := DelinquencyEpisode{ID: xid.New().String(), BillableID: bid, StartedAt: curdate.AddDate(0, 0, 7), MaxDaysPastDue: 1, MaxArrears: 110_000}
+		earlier := DelinquencyEpisode{ID: xid.New().String(), BillableID: bid, StartedAt: curdate, MaxDaysPastDue: 1, MaxArrears: 110_000}
+		endedAt := curdate.AddDate(0, 0, 3)
+
+		// act
+		errLater := store.InsertDelinquencyEpisode(later)
+		errEarlier := store.InsertDelinquencyEpisode(earlier)
+		errDuplicate := store.InsertDelinquencyEpisode(earlier)
+		earlier.EndedAt = &endedAt
+		earlier.EndStatus = BillableStatusActive
+		earlier.MaxDaysPastDue = 3
+		errUpdate := store.UpdateDelinquencyEpisode(earlier)
+		errMissing := store.UpdateDelinquencyEpisode(DelinquencyEpisode{ID: "unknown", BillableID: bid})
+
+		// assert
+		assert.NoError(t, errLater)
+		assert.NoError(t, errEarlier)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+		assert.NoError(t, errUpdate)
+		assert.ErrorIs(t, errMissing, ErrStoreNotFound)
+
+		stored, err := store.ListDelinquencyEpisodes(bid)
+		assert.NoError(t, err)
+		require.Len(t, stored, 2)
+		assert.Equal(t, earlier.ID, stored[0].ID)
+		require.NotNil(t, stored[0].EndedAt)
+		assert.True(t, endedAt.Equal(*stored[0].EndedAt))
+		assert.Equal(t, BillableStatusActive, stored[0].EndStatus)
+		assert.Equal(t, 3, stored[0].MaxDaysPastDue)
+		assert.Equal(t, 110_000, stored[0].MaxArrears)
+		assert.Equal(t, later.ID, stored[1].ID)
+		assert.Nil(t, stored[1].EndedAt)
+	})
+
+	t.Run("rules", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		rule := Rule{ID: xid.New().String(), Kind: RuleKindDelinquency, Name: "dpd", Expression: "days_past_due >= 30", CreatedAt: curdate, UpdatedAt: curdate}
+		later := Rule{ID: xid.New().String(), Kind: RuleKindLateFee, Name: "flat", Expression: "10_000", CreatedAt: curdate.Add(time.Hour), UpdatedAt: curdate.Add(time.Hour)}
+
+		// act
+		errInsert := store.InsertRule(rule)
+		errLater := store.InsertRule(later)
+		errDuplicate := store.InsertRule(rule)
+		rule.Active, rule.UpdatedAt = true, curdate.Add(2*time.Hour)
+		errUpdate := store.UpdateRule(rule)
+		errMissing := store.UpdateRule(Rule{ID: "unknown"})
+		_, errGetMissing := store.GetRule("unknown")
+
+		// assert
+		assert.NoError(t, errInsert)
+		assert.NoError(t, errLater)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+		assert.NoError(t, errUpdate)
+		assert.ErrorIs(t, errMissing, ErrStoreNotFound)
+		assert.ErrorIs(t, errGetMissing, ErrStoreNotFound)
+
+		stored, err := store.GetRule(rule.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, RuleKindDelinquency, stored.Kind)
+		assert.Equal(t, "days_past_due >= 30", stored.Expression)
+		assert.Equal(t, true, stored.Active)
+		assert.True(t, rule.UpdatedAt.Equal(stored.UpdatedAt))
+
+		rules, err := store.ListRules()
+		assert.NoError(t, err)
+		require.Len(t, rules, 2)
+		assert.Equal(t, rule.ID, rules[0].ID)
+		assert.Equal(t, later.ID, rules[1].ID)
+		assert.Equal(t, false, rules[1].Active)
+	})
+
+	t.Run("transitions", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		bid := xid.New().String()
+		later := BillableTransition{ID: xid.New().String(), BillableID: bid, FromStatus: BillableStatusActive, ToStatus: BillableStatusDelinquent, CreatedAt: curdate.Add(time.Hour)}
+		earlier := BillableTransition{ID: xid.New().String(), BillableID: bid, ToStatus: BillableStatusActive, CreatedAt: curdate}
+
+		// act
+		errLater := store.InsertTransition(later)
+		errEarlier := store.InsertTransition(earlier)
+
+		// assert
+		assert.NoError(t, errLater)
+		assert.NoError(t, errEarlier)
+
+		stored, err := store.ListTransitions(bid)
+		assert.NoError(t, err)
+		require.Len(t, stored, 2)
+		assert.Equal(t, earlier.ID, stored[0].ID)
+		assert.Equal(t, later.ID, stored[1].ID)
+	})
+
+	t.Run("events", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		recorded, legacy := newBillable(), newBillable()
+		legacy.CreatedAt = curdate.Add(-time.Hour)
+		require.NoError(t, store.InsertBillable(recorded))
+		require.NoError(t, store.InsertBillable(legacy))
+		first := BillableEvent{ID: xid.New().String(), BillableID: recorded.ID, Seq: 1, Type: EventBillableCreated, Payload: "{}", Hash: "h1", CreatedAt: curdate}
+		second := BillableEvent{ID: xid.New().String(), BillableID: recorded.ID, Seq: 2, Type: EventStatusChanged, Payload: "{}", PrevHash: "h1", Hash: "h2", CreatedAt: curdate}
+
+		// act
+		errFirst := store.AppendEvent(first)
+		errSecond := store.AppendEvent(second)
+		errTaken := store.AppendEvent(second)
+		unrecorded, errUnrecorded := store.ListBillablesWithoutEvents()
+
+		// assert
+		assert.NoError(t, errFirst)
+		assert.NoError(t, errSecond)
+		assert.ErrorIs(t, errTaken, ErrStoreDuplicateID)
+		assert.NoError(t, errUnrecorded)
+		assert.Equal(t, []string{legacy.ID}, unrecorded)
+
+		events, err := store.ListEvents(recorded.ID)
+		assert.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, second.ID, events[1].ID)
+		last, err := store.LastEvent(recorded.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "h2", last.Hash)
+		_, err = store.LastEvent(legacy.ID)
+		assert.ErrorIs(t, err, ErrStoreNotFound)
+	})
+
+	t.Run("journal", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		bid := xid.New().String()
+		later := JournalEntry{ID: xid.New().String(), BillableID: bid, Description: "payment received", Reference: "p1", PostedAt: curdate.Add(time.Hour), Lines: []JournalLine{
+			{Account: "cash", Debit: 300},
+			{Account: "loan_receivable", Credit: 300},
+		}}
+		earlier := JournalEntry{ID: xid.New().String(), BillableID: bid, Description: "status changed to active", Reference: "t1", PostedAt: curdate, Lines: []JournalLine{
+			{Account: "loan_receivable", Debit: 1000},
+			{Account: "cash", Credit: 1000},
+		}}
+
+		// act
+		errLater := store.InsertJournalEntry(later)
+		errEarlier := store.InsertJournalEntry(earlier)
+		errDuplicate := store.InsertJournalEntry(earlier)
+
+		// assert
+		assert.NoError(t, errLater)
+		assert.NoError(t, errEarlier)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+
+		stored, err := store.ListJournalEntries(bid)
+		assert.NoError(t, err)
+		assert.Equal(t, []JournalEntry{earlier, later}, stored)
+
+		totals, err := store.ListAccountTotals()
+		assert.NoError(t, err)
+		assert.Equal(t, []AccountBalance{
+			{Account: "cash", Debit: 300, Credit: 1000},
+			{Account: "loan_receivable", Debit: 1000, Credit: 300},
+		}, totals)
+	})
+
+	t.Run("idempotency_keys", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		record := IdempotencyRecord{Key: xid.New().String(), Fingerprint: "abc", CreatedAt: curdate}
+
+		// act
+		errInsert := store.InsertIdempotencyKey(record)
+		errDuplicate := store.InsertIdempotencyKey(record)
+		pending, errPending := store.GetIdempotencyKey(record.Key)
+		errUpdate := store.UpdateIdempotencyResponse(record.Key, `{"ok":true}`)
+		completed, errCompleted := store.GetIdempotencyKey(record.Key)
+		errDelete := store.DeleteIdempotencyKey(record.Key)
+		_, errDeleted := store.GetIdempotencyKey(record.Key)
+
+		// assert
+		assert.NoError(t, errInsert)
+		assert.ErrorIs(t, errDuplicate, ErrStoreDuplicateID)
+		assert.NoError(t, errPending)
+		assert.Empty(t, pending.Response)
+		assert.True(t, pending.ExpiresAt.IsZero())
+		assert.NoError(t, errUpdate)
+		assert.NoError(t, errCompleted)
+		assert.Equal(t, `{"ok":true}`, completed.Response)
+		assert.NoError(t, errDelete)
+		assert.ErrorIs(t, errDeleted, ErrStoreNotFound)
+	})
+
+	t.Run("transact_commits", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		billable := newBillable()
+
+		// act
+		err := store.Transact(func(tx BillerRepository) error {
+			if err := tx.InsertBillable(billable); err != nil {
+				return err
+			}
+			return tx.InsertInstallments(newInstallments(billable))
+		})
+
+		// assert
+		assert.NoError(t, err)
+		_, err = store.GetBillable(billable.ID)
+		assert.NoError(t, err)
+		installments, err := store.ListInstallments(billable.ID)
+		assert.NoError(t, err)
+		assert.Len(t, installments, 50)
+	})
+
+	t.Run("transact_rolls_back", func(t *testing.T) {
+		// arrange
+		store := newStore()
+		billable := newBillable()
+		failure := errors.New("failure")
+
+		// act
+		err := store.Transact(func(tx BillerRepository) error {
+			if err := tx.InsertBillable(billable); err != nil {
+				return err
+			}
+			if _, err := tx.GetBillable(billable.ID); err != nil {
+				return err
+			}
+			return failure
+		})
+
+		// assert
+		assert.ErrorIs(t, err, failure)
+		_, err = store.GetBillable(billable.ID)
+		assert.ErrorIs(t, err, ErrStoreNotFound)
+	})
+}
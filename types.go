@@ -1,21 +1,247 @@
 package main
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 type Billable struct {
-	ID        string
-	Amount    int
-	Principal int
-	DurWeek   int
-	CreatedAt time.Time
-	DueAt     time.Time
+	ID            string
+	BorrowerID    string
+	Amount        Money // principal and interest, in the currency of the billable
+	Principal     Money
+	Interest      Money // total interest charged over the schedule
+	Tenor         int   // number of installments at the billable frequency
+	InterestRate  float64
+	InterestModel InterestModelKind
+	EffectiveRate float64 // yearly compounded rate the schedule works out to
+	Frequency     InstallmentFrequency
+	Timezone      string // IANA name of the zone its due dates fall in
+	GraceDays     int    // days past a due date the installment may still be paid in
+	GraceCutoff   string // local time of day, HH:MM, the grace period ends at on its last day, none when empty
+	Product       string // loan product the billable was sold under, picks its delinquency policy
+	Status        BillableStatus
+	CreatedAt     time.Time
+	DueAt         time.Time
 }
 
 type Payment struct {
 	ID                string
 	BillableID        string
-	Amount            int
-	AmountAccumulated int
+	Kind              PaymentKind
+	Amount            Money
+	AmountAccumulated Money // running paid total in ledger order, derived when payments are read
+	AmountPrincipal   Money // portion applied to principal
+	AmountInterest    Money // portion applied to interest
+	AmountFees        Money // portion applied to fixed and percentage late fees
+	AmountPenalties   Money // portion applied to penalty interest
+	AmountUnallocated Money // overpaid portion not covered by anything owed
+	AmountRebated     Money // interest waived when the payment settled the billable
+	ReversesID        string
+	Reason            string
 	PaidAt            time.Time
 	CreatedAt         time.Time
 }
+
+// Fee is a charge for paying an installment late, owed on top of the bill.
+type Fee struct {
+	ID             string
+	BillableID     string
+	InstallmentSeq int // installment paid late
+	Kind           LateFeeKind
+	Amount         Money
+	AccruedTo      time.Time // date the fee was charged as of, penalty interest accrued up to it
+	CreatedAt      time.Time
+}
+
+// DelinquencyEpisode is a stretch of time a billable spent delinquent, with
+// the worst arrears seen while it lasted.
+type DelinquencyEpisode struct {
+	ID             string
+	BillableID     string
+	StartedAt      time.Time      // grace end of the first missed installment
+	EndedAt        *time.Time     // nil while the billable is still delinquent
+	EndStatus      BillableStatus // status the billable left delinquency for, active when cured
+	MaxDaysPastDue int
+	MaxArrears     int
+}
+
+// Borrower owns billables. Borrowers with a delinquent billable are not
+// given new ones.
+type Borrower struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Rule is an expression deciding delinquency, late fee amounts or collection
+// stages, kept in the store so it can change without a deploy. At most one
+// rule of each kind is active.
+type Rule struct {
+	ID         string
+	Kind       RuleKind
+	Name       string
+	Expression string
+	Active     bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time // last activated or deactivated
+}
+
+type BillableStatus string
+
+const (
+	BillableStatusPending    BillableStatus = "pending"
+	BillableStatusActive     BillableStatus = "active"
+	BillableStatusDelinquent BillableStatus = "delinquent"
+	BillableStatusPaidOff    BillableStatus = "paid_off"
+	BillableStatusWrittenOff BillableStatus = "written_off"
+	BillableStatusCancelled  BillableStatus = "cancelled"
+)
+
+// IsOpen tells whether the billable is still being repaid.
+func (s BillableStatus) IsOpen() bool {
+	return s == BillableStatusActive || s == BillableStatusDelinquent
+}
+
+type BillableTransition struct {
+	ID         string
+	BillableID string
+	FromStatus BillableStatus
+	ToStatus   BillableStatus
+	Reason     string
+	CreatedAt  time.Time
+}
+
+type Installment struct {
+	BillableID  string
+	Seq         int
+	DueAt       time.Time
+	AmountDue   int
+	InterestDue int // interest portion of AmountDue
+	AmountPaid  int
+	Status      InstallmentStatus
+}
+
+type InstallmentStatus string
+
+const (
+	InstallmentStatusUnpaid  InstallmentStatus = "unpaid"
+	InstallmentStatusPartial InstallmentStatus = "partially_paid"
+	InstallmentStatusPaid    InstallmentStatus = "paid"
+)
+
+type InstallmentFrequency string
+
+const (
+	FrequencyDaily    InstallmentFrequency = "daily"
+	FrequencyWeekly   InstallmentFrequency = "weekly"
+	FrequencyBiweekly InstallmentFrequency = "biweekly"
+	FrequencyMonthly  InstallmentFrequency = "monthly"
+)
+
+func (f InstallmentFrequency) IsSupported() bool {
+	switch f {
+	case FrequencyDaily, FrequencyWeekly, FrequencyBiweekly, FrequencyMonthly:
+		return true
+	}
+	return false
+}
+
+// DueAt returns the due date of the seq-th installment of a schedule starting
+// at start. Monthly dates keep the day of month of start, falling back to the
+// last day of shorter months, so a loan made on the 31st is due on Feb 28 or
+// 29 and again on Mar 31.
+func (f InstallmentFrequency) DueAt(start time.Time, seq int) time.Time {
+	switch f {
+	case FrequencyDaily:
+		return start.AddDate(0, 0, seq)
+	case FrequencyBiweekly:
+		return start.AddDate(0, 0, 14*seq)
+	case FrequencyMonthly:
+		year, month, day := start.Date()
+		lastDay := time.Date(year, month+time.Month(seq)+1, 0, 0, 0, 0, 0, start.Location()).Day()
+		if day > lastDay {
+			day = lastDay
+		}
+		hour, minute, sec := start.Clock()
+		return time.Date(year, month+time.Month(seq), day, hour, minute, sec, start.Nanosecond(), start.Location())
+	default:
+		return start.AddDate(0, 0, 7*seq)
+	}
+}
+
+// InstallmentsIn returns how many installments of the frequency span a loan
+// of the given weeks, at least one.
+func (f InstallmentFrequency) InstallmentsIn(weeks int) (out int) {
+	switch f {
+	case FrequencyDaily:
+		out = 7 * weeks
+	case FrequencyBiweekly:
+		out = (weeks + 1) / 2
+	case FrequencyMonthly:
+		out = int(math.Round(float64(weeks) * 12 / 52))
+	default:
+		out = weeks
+	}
+	if out < 1 {
+		out = 1
+	}
+	return
+}
+
+type PaymentKind string
+
+const (
+	PaymentKindPayment  PaymentKind = "payment"
+	PaymentKindReversal PaymentKind = "reversal" // compensates a payment, dated at the original
+	PaymentKindRefund   PaymentKind = "refund"   // returns overpaid credit to the borrower
+)
+
+// BillableEvent is an immutable entry of a billable's history. Each event
+// hashes its content together with the previous event of the billable, so
+// editing or dropping one breaks the chain.
+type BillableEvent struct {
+	ID         string
+	BillableID string
+	Seq        int // position in the billable's history, starting at 1
+	Type       EventType
+	Payload    string // JSON encoded, see the payload of each event type
+	PrevHash   string
+	Hash       string
+	CreatedAt  time.Time
+}
+
+type EventType string
+
+const (
+	EventBillableCreated EventType = "billable_created" // BillableCreatedPayload
+	EventPaymentReceived EventType = "payment_received" // Payment, including early settlements
+	EventPaymentReversed EventType = "payment_reversed" // Payment compensating the reversed one
+	EventPaymentRefunded EventType = "payment_refunded" // Payment returning overpaid credit
+	EventFeeCharged      EventType = "fee_charged"      // Fee
+	EventStatusChanged   EventType = "status_changed"   // BillableTransition
+)
+
+type BillableCreatedPayload struct {
+	Billable     Billable
+	Installments []Installment
+}
+
+// JournalEntry is a balanced double-entry posting made on behalf of a
+// billable, its lines debit exactly as much as they credit.
+type JournalEntry struct {
+	ID          string
+	BillableID  string
+	Description string
+	Reference   string // id of the payment or transition behind the posting
+	Currency    Currency
+	PostedAt    time.Time
+	Lines       []JournalLine
+}
+
+type JournalLine struct {
+	Account string
+	Debit   int
+	Credit  int
+}